@@ -1,26 +1,36 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq" // PostgreSQL driver
 
 	"github.com/stevenpstansberry/AquaMind-AI/internal/auth"
+	"github.com/stevenpstansberry/AquaMind-AI/internal/mail"
+	"github.com/stevenpstansberry/AquaMind-AI/internal/migrate"
 	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+	"github.com/stevenpstansberry/AquaMind-AI/internal/oidc"
+	utils "github.com/stevenpstansberry/AquaMind-AI/internal/util"
 )
 
+// defaultQueryTimeout bounds store calls when DB_QUERY_TIMEOUT is not set.
+const defaultQueryTimeout = 5 * time.Second
+
 func enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Api-Key, X-Detail-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Api-Key, X-Detail-Type, If-Match")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 		// Handle preflight OPTIONS request
 		if r.Method == http.MethodOptions {
@@ -88,47 +98,125 @@ func main() {
 
 	log.Println("Successfully connected to PostgreSQL!")
 
-	// Initialize the database in the models package
-	log.Println("Initializing database with models package...")
-	models.InitDB(db)
-	log.Println("Database initialization complete.")
+	// Apply schema migrations if MIGRATE_ON_STARTUP is set; otherwise only report pending ones
+	migrator, err := migrate.New(db)
+	if err != nil {
+		log.Fatalf("Unable to load schema migrations: %v", err)
+	}
+	if os.Getenv("MIGRATE_ON_STARTUP") == "true" {
+		applied, err := migrator.Up(context.Background(), 0)
+		for _, migration := range applied {
+			log.Printf("Applied migration %04d_%s", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatalf("Unable to migrate the database: %v", err)
+		}
+		log.Printf("Database schema is at version %d", migrator.Latest())
+	} else {
+		statuses, err := migrator.Status(context.Background())
+		if err != nil {
+			log.Fatalf("Unable to read schema migration status: %v", err)
+		}
+		pending := 0
+		for _, status := range statuses {
+			if status.AppliedAt == nil {
+				pending++
+			}
+		}
+		if pending > 0 {
+			log.Printf("Warning: %d schema migrations are pending; run \"migrate up\" or set MIGRATE_ON_STARTUP=true", pending)
+		}
+	}
 
-	// Initialize the router
-	log.Println("Initializing router...")
-	router := mux.NewRouter()
+	// Bound every store call by DB_QUERY_TIMEOUT, 5 seconds unless set
+	queryTimeout := defaultQueryTimeout
+	if value := os.Getenv("DB_QUERY_TIMEOUT"); value != "" {
+		queryTimeout, err = time.ParseDuration(value)
+		if err != nil {
+			log.Fatalf("Invalid DB_QUERY_TIMEOUT %q: %v", value, err)
+		}
+	}
+	log.Printf("Database queries time out after %v", queryTimeout)
 
-	log.Println("Setting up routes...")
+	// Load the keys tokens are signed and verified with from JWT_KEY_DIR
+	keyDir := os.Getenv("JWT_KEY_DIR")
+	if keyDir == "" {
+		log.Fatal("JWT_KEY_DIR is not set in the environment")
+	}
+	keys, err := utils.LoadKeySet(keyDir, os.Getenv("JWT_SIGNING_KEY_ID"))
+	if err != nil {
+		log.Fatalf("Error loading JWT keys: %v", err)
+	}
+	log.Printf("Loaded JWT keys, signing with key %s", keys.SigningKeyID())
 
-	// Health check route
-	router.HandleFunc("/auth/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	}).Methods("GET")
+	// Serve the API from the PostgreSQL store
+	store := models.NewPostgresStore(db, queryTimeout)
+	server := auth.NewServer(store, keys)
 
-	// Routes for user registration and login using the auth package
-	router.HandleFunc("/register", auth.RegisterUser).Methods("POST")
-	router.HandleFunc("/login", auth.LoginUser).Methods("POST")
+	// Limit how many parameter entries are listed per aquarium, if AQUARIUM_LIST_PARAMETER_LIMIT is set
+	if value := os.Getenv("AQUARIUM_LIST_PARAMETER_LIMIT"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			log.Fatalf("Invalid AQUARIUM_LIST_PARAMETER_LIMIT %q", value)
+		}
+		server.AquariumListParameterLimit = limit
+	}
 
-	// Google OAuth login route
-	router.HandleFunc("/oauth", auth.HandleGoogleOAuth).Methods("POST")
+	// Set up outgoing email
+	server.Mailer, err = mail.NewMailerFromEnv()
+	if err != nil {
+		log.Fatalf("Unable to configure mail delivery: %v", err)
+	}
+
+	// Set up the external identity providers users can sign in with
+	server.IdentityProviders, err = oidc.ProvidersFromEnv()
+	if err != nil {
+		log.Fatalf("Unable to configure identity providers: %v", err)
+	}
+
+	// Configure which endpoints accounts with an unverified email may call
+	var unverifiedPaths []string
+	for _, path := range strings.Split(os.Getenv("UNVERIFIED_ALLOWED_PATHS"), ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			unverifiedPaths = append(unverifiedPaths, path)
+		}
+	}
+	server.VerificationPolicy, err = auth.NewVerificationPolicy(os.Getenv("EMAIL_VERIFICATION_POLICY"), unverifiedPaths)
+	if err != nil {
+		log.Fatalf("Invalid email verification policy: %v", err)
+	}
 
-	// Aquarium routes with JWT authentication middleware
-	router.Handle("/aquariums", auth.JWTAuthMiddleware(http.HandlerFunc(auth.CreateAquariumHandler))).Methods("POST")
-	router.Handle("/user/aquariums", auth.JWTAuthMiddleware(http.HandlerFunc(auth.GetUserAquariumsHandler))).Methods("GET")
-	router.Handle("/aquariums/{id}", auth.JWTAuthMiddleware(http.HandlerFunc(auth.GetAquariumHandler))).Methods("GET")
-	router.Handle("/aquariums/{id}", auth.JWTAuthMiddleware(http.HandlerFunc(auth.UpdateAquariumHandler))).Methods("PUT")
-	router.Handle("/aquariums/{id}", auth.JWTAuthMiddleware(http.HandlerFunc(auth.DeleteAquariumHandler))).Methods("DELETE")
+	// Believe the client address reported by the proxies listed in TRUSTED_PROXIES
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	server.TrustedProxies, err = auth.ParseTrustedProxies(proxies)
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
-	// Detail routes with JWT authentication middleware
-	router.Handle("/details/{id}", auth.JWTAuthMiddleware(http.HandlerFunc(auth.GetDetailHandler))).Methods("GET")
-	router.Handle("/details/all/{type}", auth.JWTAuthMiddleware(http.HandlerFunc(auth.GetAllDetailsHandler))).Methods("GET")
+	// Grant the admin role to the accounts listed in ADMIN_EMAILS
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		email = strings.TrimSpace(email)
+		if email == "" {
+			continue
+		}
+		if err := store.GrantRoleByEmail(context.Background(), email, models.RoleAdmin); err != nil {
+			log.Printf("Unable to grant admin role to %s: %v", email, err)
+		} else {
+			log.Printf("Granted admin role to %s", email)
+		}
+	}
 
-	// Parameter entry routes with JWT authentication middleware
-	router.Handle("/aquariums/{aquariumId}/parameter-entries", auth.JWTAuthMiddleware(http.HandlerFunc(auth.CreateParameterEntryHandler))).Methods("POST")
-	router.Handle("/aquariums/{aquariumId}/parameter-entries", auth.JWTAuthMiddleware(http.HandlerFunc(auth.GetParameterEntriesHandler))).Methods("GET")
+	// Initialize the router
+	log.Println("Setting up routes...")
+	router := server.Routes()
 
 	// Apply the Logging and CORS middleware to all routes
-	loggingHandler := auth.LoggingMiddleware(enableCORS(router))
+	loggingHandler := server.LoggingMiddleware(enableCORS(router))
 
 	log.Println("Starting the server on port 80...")
 	err = http.ListenAndServe(":80", loggingHandler)
@@ -0,0 +1,116 @@
+// Command migrate inspects and changes the version of the database schema.
+//
+// Usage:
+//
+//	migrate status          list every migration and whether it has been applied
+//	migrate up [VERSION]    apply pending migrations, up to VERSION if given
+//	migrate down [STEPS]    revert the last STEPS applied migrations (default 1)
+//
+// The database is configured with the same DB_* environment variables as the auth
+// service, read from a .env file if one is present.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq" // PostgreSQL driver
+
+	"github.com/stevenpstansberry/AquaMind-AI/internal/migrate"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: migrate status | up [VERSION] | down [STEPS]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 || len(os.Args) > 3 {
+		usage()
+	}
+	command := os.Args[1]
+	arg := 0
+	if len(os.Args) == 3 {
+		n, err := strconv.Atoi(os.Args[2])
+		if err != nil || n < 1 {
+			usage()
+		}
+		arg = n
+	}
+
+	// The environment may also be set directly, so a missing .env file is not an error
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
+
+	connStr := fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		os.Getenv("DB_HOST"),
+		os.Getenv("DB_PORT"),
+		os.Getenv("DB_USER"),
+		os.Getenv("DB_PASSWORD"),
+		os.Getenv("DB_NAME"),
+		os.Getenv("DB_SSLMODE"),
+	)
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		log.Fatalf("Unable to connect to the database: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(db)
+	if err != nil {
+		log.Fatalf("Unable to load migrations: %v", err)
+	}
+	ctx := context.Background()
+
+	switch command {
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("Unable to read migration status: %v", err)
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Printf("%04d  %-32s %s\n", status.Version, status.Name, applied)
+		}
+
+	case "up":
+		applied, err := migrator.Up(ctx, arg)
+		for _, migration := range applied {
+			fmt.Printf("Applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("Schema is up to date")
+		}
+
+	case "down":
+		if arg == 0 {
+			arg = 1
+		}
+		reverted, err := migrator.Down(ctx, arg)
+		for _, migration := range reverted {
+			fmt.Printf("Reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No applied migrations to revert")
+		}
+
+	default:
+		usage()
+	}
+}
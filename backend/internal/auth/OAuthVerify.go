@@ -3,38 +3,59 @@ package auth
 import (
 	"context"
 	"crypto/rand"
+	"database/sql"
 	"encoding/hex"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
-	"os"
+	"sort"
 	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
-	utils "github.com/stevenpstansberry/AquaMind-AI/internal/util"
+	"github.com/stevenpstansberry/AquaMind-AI/internal/oidc"
 	"golang.org/x/crypto/bcrypt"
-	"google.golang.org/api/idtoken"
 )
 
-// VerifyGoogleIDToken verifies the Google ID token received from the client.
-func VerifyGoogleIDToken(idToken string) (*idtoken.Payload, error) {
-	ctx := context.Background()
-	clientID := os.Getenv("CLIENT_ID")
+// authenticateIdentity verifies a credential with the named provider and writes an error
+// response if it fails.
+func (s *Server) authenticateIdentity(w http.ResponseWriter, r *http.Request, providerName string, cred oidc.Credential) (*oidc.Identity, bool) {
+	provider, ok := s.IdentityProviders[providerName]
+	if !ok {
+		http.Error(w, "Unknown identity provider", http.StatusNotFound)
+		return nil, false
+	}
 
-	log.Println("Verifying Google ID token...")
-	payload, err := idtoken.Validate(ctx, idToken, clientID)
+	identity, err := provider.Authenticate(r.Context(), cred)
 	if err != nil {
-		log.Printf("Token validation failed: %v", err)
-		return nil, fmt.Errorf("could not validate ID token: %v", err)
+		log.Printf("Authentication with %s failed: %v", providerName, err)
+		event := userTarget(models.AuditOAuthLogin, "", models.OutcomeFailure)
+		event.Details = map[string]interface{}{"provider": providerName}
+		s.recordAudit(r, event)
+		if errors.Is(err, oidc.ErrInvalidCredential) {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+		} else {
+			http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		}
+		return nil, false
 	}
 
-	log.Println("Google ID token verified successfully.")
-	return payload, nil
+	return identity, true
 }
 
 // HandleGoogleOAuth authenticates or registers a user via Google Sign-In.
-func HandleGoogleOAuth(w http.ResponseWriter, r *http.Request) {
+// It is kept for existing clients; it is equivalent to POST /oauth/google with an id_token.
+//
+// Method: POST
+// Endpoint: /oauth
+//
+// Request body (JSON):
+//
+//	{
+//	  "token": "google-id-token"
+//	}
+func (s *Server) HandleGoogleOAuth(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Token string `json:"token"`
 	}
@@ -47,30 +68,118 @@ func HandleGoogleOAuth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify the Google ID token
-	payload, err := VerifyGoogleIDToken(req.Token)
-	if err != nil {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
+	s.signInWithProvider(w, r, "google", oidc.Credential{IDToken: req.Token})
+}
+
+// OAuthLoginHandler authenticates or registers a user through any configured identity provider.
+// OpenID Connect providers accept an ID token or an authorization code; GitHub accepts a code.
+//
+// Method: POST
+// Endpoint: /oauth/{provider}
+//
+// Request body (JSON):
+//
+//	{
+//	  "id_token": "provider-id-token",
+//	  "code": "authorization-code",
+//	  "redirect_uri": "https://app.example.com/callback",
+//	  "nonce": "nonce-sent-with-the-authorization-request"
+//	}
+//
+// Response (JSON):
+//   - On success: {"token": "...", "refresh_token": "...", "expires_in": 900, "email": "...", "message": "..."}
+//   - With two-factor authentication: {"mfa_required": true, "mfa_token": "...", "expires_in": 300}
+//   - On error: HTTP status code with an appropriate error message.
+func (s *Server) OAuthLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var cred oidc.Credential
+	if err := json.NewDecoder(r.Body).Decode(&cred); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	s.signInWithProvider(w, r, mux.Vars(r)["provider"], cred)
+}
+
+// ListIdentityProvidersHandler lists the names of the configured identity providers.
+//
+// Method: GET
+// Endpoint: /oauth/providers
+func (s *Server) ListIdentityProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(s.IdentityProviders))
+	for name := range s.IdentityProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"providers": names})
+}
+
+// signInWithProvider signs in the user linked to the external identity. An identity that is
+// not linked yet is linked to the account with the same email address if the provider has
+// verified that address, and otherwise to a newly registered account.
+func (s *Server) signInWithProvider(w http.ResponseWriter, r *http.Request, providerName string, cred oidc.Credential) {
+	identity, ok := s.authenticateIdentity(w, r, providerName, cred)
+	if !ok {
+		return
+	}
+	email := identity.Email
+	log.Printf("Extracted user details - Provider: %s, Email: %s, First Name: %s", identity.Provider, email, identity.GivenName)
+
+	// Sign in through an already linked identity
+	linkedUser, err := s.Users.GetUserByIdentity(r.Context(), identity.Provider, identity.Subject)
+	if err == nil {
+		log.Printf("User %s signed in with linked %s identity", linkedUser.Email, identity.Provider)
+		s.completeExternalLogin(w, r, linkedUser, "User logged in successfully")
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error looking up %s identity: %v", identity.Provider, err)
+		serverError(w, err, "Error retrieving user")
 		return
 	}
 
-	// Extract user details from the payload
-	email := payload.Claims["email"].(string)
-	firstName := payload.Claims["given_name"].(string)
-	log.Printf("Extracted user details - Email: %s, First Name: %s", email, firstName)
+	if email == "" {
+		http.Error(w, "Identity provider did not share an email address", http.StatusBadRequest)
+		return
+	}
 
 	// Check if the user already exists in your database
 	log.Printf("Checking if user %s already exists...", email)
-	userExists := models.UserExists(email)
-	if userExists {
-		log.Printf("User %s already has an account. Logging in...", email)
-		token, err := utils.GenerateJWT(email)
-		if err != nil {
-			log.Printf("Error generating JWT token for existing user %s: %v", email, err)
-			http.Error(w, "Error generating token", http.StatusInternalServerError)
+	existingUser, err := s.Users.GetUserByEmail(r.Context(), email)
+	if err == nil {
+		// Only sign in to an existing account if the provider vouches for the address;
+		// otherwise the identity must be linked from the account's settings
+		if !identity.EmailVerified {
+			log.Printf("%s has not verified %s, refusing to sign in to existing account", identity.Provider, email)
+			http.Error(w, "Email address not verified by identity provider", http.StatusUnauthorized)
 			return
 		}
-		json.NewEncoder(w).Encode(map[string]string{"token": token, "email": email, "message": "User logged in successfully"})
+
+		// An unverified password account for this address was never proven to belong to
+		// whoever registered it; hand it over to the verified owner signing in now
+		if !existingUser.Verified() {
+			log.Printf("Claiming unverified account %s for its verified %s owner", email, identity.Provider)
+			if err := s.claimUnverifiedAccount(r.Context(), existingUser); err != nil {
+				log.Printf("Error claiming unverified account %s: %v", email, err)
+				serverError(w, err, "Error processing account")
+				return
+			}
+			// Two-factor authentication was set up by the previous holder and is now gone
+			existingUser.MFAEnabled = false
+		}
+
+		if !s.linkIdentity(r.Context(), w, existingUser.ID, identity) {
+			return
+		}
+
+		log.Printf("User %s already has an account. Logging in...", email)
+		s.completeExternalLogin(w, r, existingUser, "User logged in successfully")
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error looking up user %s: %v", email, err)
+		serverError(w, err, "Error retrieving user")
 		return
 	}
 
@@ -80,14 +189,14 @@ func HandleGoogleOAuth(w http.ResponseWriter, r *http.Request) {
 	password, err := generateRandomString(32)
 	if err != nil {
 		log.Printf("Error generating random password for %s: %v", email, err)
-		http.Error(w, "Error generating password", http.StatusInternalServerError)
+		serverError(w, err, "Error generating password")
 		return
 	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		log.Printf("Error hashing password for %s: %v", email, err)
-		http.Error(w, "Error processing password", http.StatusInternalServerError)
+		serverError(w, err, "Error processing password")
 		return
 	}
 
@@ -95,7 +204,7 @@ func HandleGoogleOAuth(w http.ResponseWriter, r *http.Request) {
 	username, err := generateRandomString(8)
 	if err != nil {
 		log.Printf("Error generating random username for %s: %v", email, err)
-		http.Error(w, "Error generating username", http.StatusInternalServerError)
+		serverError(w, err, "Error generating username")
 		return
 	}
 
@@ -103,24 +212,195 @@ func HandleGoogleOAuth(w http.ResponseWriter, r *http.Request) {
 	createdAt := time.Now().Format(time.RFC3339)
 	log.Printf("Registering user %s with username %s", email, username)
 
-	// Register the user in the database
-	err = models.CreateUser(email, string(hashedPassword), firstName, username, subscribe, createdAt)
+	// Register the user together with their identity; the provider may have already
+	// verified the address
+	link := models.Identity{Provider: identity.Provider, Subject: identity.Subject, Email: identity.Email}
+	userID, err := s.Users.CreateUserWithIdentity(r.Context(), email, string(hashedPassword), identity.GivenName, username, subscribe, createdAt, link, identity.EmailVerified)
+	if errors.Is(err, models.ErrIdentityLinked) {
+		http.Error(w, "Identity is already linked to another account", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		log.Printf("Error creating user %s in database: %v", email, err)
-		http.Error(w, "Error creating user", http.StatusInternalServerError)
+		serverError(w, err, "Error creating user")
+		return
+	}
+
+	event := userTarget(models.AuditRegister, userID, models.OutcomeSuccess)
+	event.ActorID = userID
+	event.Details = map[string]interface{}{"provider": identity.Provider}
+	s.recordAudit(r, event)
+
+	// Start a session for the new user
+	user := &models.User{ID: userID, Email: email, FirstName: identity.GivenName, Roles: []string{models.RoleUser}}
+	log.Printf("User %s registered successfully", email)
+	s.completeExternalLogin(w, r, user, "User registered and logged in successfully")
+}
+
+// linkIdentity links the identity to the user and writes an error response if that fails.
+func (s *Server) linkIdentity(ctx context.Context, w http.ResponseWriter, userID string, identity *oidc.Identity) bool {
+	err := s.Users.LinkIdentity(ctx, userID, identity.Provider, identity.Subject, identity.Email)
+	if err != nil {
+		if errors.Is(err, models.ErrIdentityLinked) {
+			http.Error(w, "Identity is already linked to another account", http.StatusConflict)
+		} else {
+			log.Printf("Error linking %s identity to user %s: %v", identity.Provider, userID, err)
+			serverError(w, err, "Error linking identity")
+		}
+		return false
+	}
+	return true
+}
+
+// completeExternalLogin starts a session for a user signed in through an identity provider,
+// or returns an MFA challenge if the user has two-factor authentication enabled.
+// The sign-in is only recorded as successful once tokens are issued; with two-factor
+// authentication, LoginMFAHandler records it.
+func (s *Server) completeExternalLogin(w http.ResponseWriter, r *http.Request, user *models.User, message string) {
+	if user.MFAEnabled {
+		challenge, err := s.newMFAChallenge(user)
+		if err != nil {
+			log.Printf("Error generating MFA token for user %s: %v", user.Email, err)
+			serverError(w, err, "Error generating token")
+			return
+		}
+		json.NewEncoder(w).Encode(challenge)
+		return
+	}
+
+	tokens, err := s.issueTokens(r, user)
+	if err != nil {
+		log.Printf("Error generating JWT token for user %s: %v", user.Email, err)
+		serverError(w, err, "Error generating token")
+		return
+	}
+
+	event := userTarget(models.AuditOAuthLogin, user.ID, models.OutcomeSuccess)
+	event.ActorID = user.ID
+	s.recordAudit(r, event)
+	writeOAuthResponse(w, tokens, user.Email, message)
+}
+
+// ListIdentitiesHandler lists the external identities linked to the authenticated user.
+//
+// Method: GET
+// Endpoint: /user/identities
+func (s *Server) ListIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	identities, err := s.Users.ListIdentities(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("Error listing identities for user %s: %v", principal.UserID, err)
+		serverError(w, err, "Error retrieving identities")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(identities)
+}
+
+// LinkIdentityHandler links an external identity to the authenticated user. The email
+// address at the provider does not have to match the account's.
+//
+// Method: POST
+// Endpoint: /user/identities/{provider}
+//
+// Request body (JSON): the same credential accepted by POST /oauth/{provider}.
+func (s *Server) LinkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var cred oidc.Credential
+	if err := json.NewDecoder(r.Body).Decode(&cred); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	identity, ok := s.authenticateIdentity(w, r, mux.Vars(r)["provider"], cred)
+	if !ok {
+		return
+	}
+
+	if !s.linkIdentity(r.Context(), w, principal.UserID, identity) {
+		return
+	}
+
+	log.Printf("User %s linked %s identity %s", principal.UserID, identity.Provider, identity.Subject)
+	event := userTarget(models.AuditIdentityLinked, principal.UserID, models.OutcomeSuccess)
+	event.Details = map[string]interface{}{"provider": identity.Provider, "subject": identity.Subject}
+	s.recordAudit(r, event)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.Identity{
+		Provider:  identity.Provider,
+		Subject:   identity.Subject,
+		Email:     identity.Email,
+		CreatedAt: time.Now(),
+	})
+}
+
+// UnlinkIdentityHandler removes an external identity from the authenticated user. The
+// account stays reachable through its password, which can be reset by email.
+//
+// Method: DELETE
+// Endpoint: /user/identities/{provider}/{subject}
+func (s *Server) UnlinkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
 		return
 	}
+	vars := mux.Vars(r)
 
-	// Generate JWT for the new user
-	token, err := utils.GenerateJWT(email)
+	err := s.Users.UnlinkIdentity(r.Context(), principal.UserID, vars["provider"], vars["subject"])
 	if err != nil {
-		log.Printf("Error generating JWT token for new user %s: %v", email, err)
-		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Identity not found", http.StatusNotFound)
+		} else {
+			log.Printf("Error unlinking identity for user %s: %v", principal.UserID, err)
+			serverError(w, err, "Error unlinking identity")
+		}
 		return
 	}
 
-	log.Printf("User %s registered and logged in successfully", email)
-	json.NewEncoder(w).Encode(map[string]string{"token": token, "email": email, "message": "User registered and logged in successfully"})
+	log.Printf("User %s unlinked %s identity %s", principal.UserID, vars["provider"], vars["subject"])
+	event := userTarget(models.AuditIdentityUnlinked, principal.UserID, models.OutcomeSuccess)
+	event.Details = map[string]interface{}{"provider": vars["provider"], "subject": vars["subject"]}
+	s.recordAudit(r, event)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// claimUnverifiedAccount replaces the password of an unverified account with a random one,
+// marks it verified and removes its sessions, identities, tokens, two-factor
+// authentication and sharing (see models.PostgresStore.ClaimUnverifiedAccount).
+func (s *Server) claimUnverifiedAccount(ctx context.Context, user *models.User) error {
+	password, err := generateRandomString(32)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	return s.Users.ClaimUnverifiedAccount(ctx, user.ID, string(hashedPassword))
+}
+
+// writeOAuthResponse writes the token pair together with the user's email and a status message.
+func writeOAuthResponse(w http.ResponseWriter, tokens *TokenPair, email string, message string) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":         tokens.Token,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"email":         email,
+		"message":       message,
+	})
 }
 
 // generateRandomString creates a cryptographically secure random string of the specified length.
@@ -132,6 +412,5 @@ func generateRandomString(length int) (string, error) {
 		return "", err
 	}
 	randomString := hex.EncodeToString(bytes)
-	log.Printf("Generated random string: %s", randomString)
 	return randomString, nil
 }
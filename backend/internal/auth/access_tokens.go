@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+	utils "github.com/stevenpstansberry/AquaMind-AI/internal/util"
+)
+
+// Scopes that can be granted to personal access tokens.
+const (
+	ScopeAquariumsRead   = "aquariums:read"
+	ScopeAquariumsWrite  = "aquariums:write"
+	ScopeParametersRead  = "parameters:read"
+	ScopeParametersWrite = "parameters:write"
+	ScopeCatalogRead     = "catalog:read"
+)
+
+// knownScopes lists every scope a personal access token may be granted.
+var knownScopes = map[string]bool{
+	ScopeAquariumsRead:   true,
+	ScopeAquariumsWrite:  true,
+	ScopeParametersRead:  true,
+	ScopeParametersWrite: true,
+	ScopeCatalogRead:     true,
+}
+
+// Limits on personal access tokens.
+const (
+	maxAccessTokenNameLength = 64
+	maxAccessTokenLifetime   = 365 // Days
+)
+
+// authenticateAccessToken resolves a personal access token, writing an unauthorized
+// response if it is unknown, revoked or expired.
+func (s *Server) authenticateAccessToken(ctx context.Context, w http.ResponseWriter, token string) (*models.PersonalAccessToken, bool) {
+	accessToken, err := s.Sessions.GetPersonalAccessTokenByHash(ctx, utils.HashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+		} else {
+			log.Printf("Error retrieving personal access token: %v", err)
+			serverError(w, err, "Error validating token")
+		}
+		return nil, false
+	}
+
+	if accessToken.ExpiresAt != nil && time.Now().After(*accessToken.ExpiresAt) {
+		http.Error(w, "Token expired", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	if err := s.Sessions.TouchPersonalAccessToken(ctx, accessToken.ID); err != nil {
+		log.Printf("Error recording use of personal access token %s: %v", accessToken.ID, err)
+	}
+
+	return accessToken, true
+}
+
+// CreateAccessTokenHandler mints a personal access token for the authenticated user.
+// The token value is only returned by this call; afterwards only its hash is kept.
+//
+// Method: POST
+// Endpoint: /user/tokens
+//
+// Request body (JSON):
+//
+//	{
+//	  "name": "tank sensor",
+//	  "scopes": ["parameters:write"],
+//	  "aquarium_id": "optional-aquarium-id",
+//	  "expires_in_days": 90
+//	}
+//
+// Response (JSON):
+//   - On success: the token's metadata with its value in "token".
+//   - On error: HTTP status code with an appropriate error message.
+func (s *Server) CreateAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		AquariumID    string   `json:"aquarium_id"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxAccessTokenNameLength {
+		http.Error(w, "Name must be between 1 and 64 characters", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		http.Error(w, "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+	scopes := make([]string, 0, len(req.Scopes))
+	seen := make(map[string]bool)
+	for _, scope := range req.Scopes {
+		if !knownScopes[scope] {
+			http.Error(w, "Unknown scope: "+scope, http.StatusBadRequest)
+			return
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxAccessTokenLifetime {
+		http.Error(w, "expires_in_days must be between 1 and 365, or 0 for no expiry", http.StatusBadRequest)
+		return
+	}
+
+	// A token can only be limited to an aquarium shared with the user
+	if req.AquariumID != "" {
+		role, err := s.Aquariums.GetAquariumRole(r.Context(), req.AquariumID, principal.UserID)
+		if err != nil || role == "" {
+			http.Error(w, "Aquarium not found", http.StatusBadRequest)
+			return
+		}
+	}
+
+	token, tokenHash, err := utils.GeneratePersonalAccessToken()
+	if err != nil {
+		log.Printf("Error generating personal access token: %v", err)
+		serverError(w, err, "Error generating token")
+		return
+	}
+
+	accessToken := &models.PersonalAccessToken{
+		UserID:     principal.UserID,
+		Name:       name,
+		Scopes:     scopes,
+		AquariumID: req.AquariumID,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		accessToken.ExpiresAt = &expiresAt
+	}
+
+	if err := s.Sessions.CreatePersonalAccessToken(r.Context(), accessToken, tokenHash); err != nil {
+		log.Printf("Error storing personal access token for user %s: %v", principal.UserID, err)
+		serverError(w, err, "Error generating token")
+		return
+	}
+
+	log.Printf("User %s created personal access token %s with scopes %v", principal.UserID, accessToken.ID, scopes)
+	event := targetEvent(models.AuditTokenCreated, "access_token", accessToken.ID, models.OutcomeSuccess)
+	event.Details = map[string]interface{}{"name": name, "scopes": scopes, "aquarium_id": req.AquariumID}
+	s.recordAudit(r, event)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		*models.PersonalAccessToken
+		Token string `json:"token"`
+	}{accessToken, token})
+}
+
+// ListAccessTokensHandler lists the authenticated user's personal access tokens without their values.
+//
+// Method: GET
+// Endpoint: /user/tokens
+func (s *Server) ListAccessTokensHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := s.Sessions.ListPersonalAccessTokens(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("Error listing personal access tokens for user %s: %v", principal.UserID, err)
+		serverError(w, err, "Error retrieving tokens")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// RevokeAccessTokenHandler revokes one of the authenticated user's personal access tokens.
+//
+// Method: DELETE
+// Endpoint: /user/tokens/{id}
+func (s *Server) RevokeAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	tokenID := mux.Vars(r)["id"]
+
+	err := s.Sessions.RevokePersonalAccessToken(r.Context(), tokenID, principal.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Token not found", http.StatusNotFound)
+		} else {
+			log.Printf("Error revoking personal access token %s: %v", tokenID, err)
+			serverError(w, err, "Error revoking token")
+		}
+		return
+	}
+
+	log.Printf("User %s revoked personal access token %s", principal.UserID, tokenID)
+	s.recordAudit(r, targetEvent(models.AuditTokenRevoked, "access_token", tokenID, models.OutcomeSuccess))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stevenpstansberry/AquaMind-AI/internal/export"
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Limits on self-service profile fields.
+const (
+	maxUsernameLength  = 32
+	maxFirstNameLength = 64
+	maxBioLength       = 500
+)
+
+// GetProfileHandler retrieves the authenticated user's profile.
+//
+// Method: GET
+// Endpoint: /user/profile
+func (s *Server) GetProfileHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	profile, err := s.Users.GetUserProfile(r.Context(), principal.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			log.Printf("Error retrieving profile for user %s: %v", principal.UserID, err)
+			serverError(w, err, "Error retrieving profile")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// validateProfileUpdate trims the update's fields and checks them against the profile limits.
+func validateProfileUpdate(update *models.ProfileUpdate) string {
+	if update.Username != nil {
+		username := strings.TrimSpace(*update.Username)
+		update.Username = &username
+		if username == "" || len(username) > maxUsernameLength {
+			return "Username must be between 1 and 32 characters"
+		}
+	}
+	if update.FirstName != nil {
+		firstName := strings.TrimSpace(*update.FirstName)
+		update.FirstName = &firstName
+		if len(firstName) > maxFirstNameLength {
+			return "First name is too long"
+		}
+	}
+	if update.Bio != nil && len(*update.Bio) > maxBioLength {
+		return "Bio must be at most 500 characters"
+	}
+	if update.ProfilePictureURL != nil && *update.ProfilePictureURL != "" {
+		parsed, err := url.Parse(*update.ProfilePictureURL)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return "Profile picture must be an http(s) URL"
+		}
+	}
+	return ""
+}
+
+// UpdateProfileHandler applies a partial update to the authenticated user's profile and
+// returns the updated profile. Only the fields present in the body are changed.
+//
+// Method: PATCH
+// Endpoint: /user/profile
+//
+// Request body (JSON):
+//
+//	{
+//	  "username": "reefkeeper",
+//	  "firstName": "Ada",
+//	  "bio": "Planted tanks and shrimp",
+//	  "profilePictureUrl": "https://example.com/me.png"
+//	}
+func (s *Server) UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var update models.ProfileUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	if problem := validateProfileUpdate(&update); problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+
+	err := s.Users.UpdateUserProfile(r.Context(), principal.UserID, update)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrUsernameTaken):
+			http.Error(w, "Username already taken", http.StatusConflict)
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "User not found", http.StatusNotFound)
+		default:
+			log.Printf("Error updating profile for user %s: %v", principal.UserID, err)
+			serverError(w, err, "Error updating profile")
+		}
+		return
+	}
+
+	s.GetProfileHandler(w, r)
+}
+
+// ChangePasswordHandler changes the authenticated user's password after checking the
+// current one. Every other session is revoked; the calling session stays logged in.
+//
+// Method: POST
+// Endpoint: /user/password
+//
+// Request body (JSON):
+//
+//	{
+//	  "current_password": "old-password",
+//	  "new_password": "new-password"
+//	}
+func (s *Server) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.NewPassword) < minPasswordLength {
+		http.Error(w, "Password is too short", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.Users.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("Error retrieving user %s: %v", principal.UserID, err)
+		serverError(w, err, "Error retrieving user")
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		s.recordAudit(r, userTarget(models.AuditPasswordChanged, principal.UserID, models.OutcomeDenied))
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		serverError(w, err, "Error processing password")
+		return
+	}
+
+	err = s.Users.ChangeUserPassword(r.Context(), principal.UserID, string(hashedPassword), principal.SessionID)
+	if err != nil {
+		log.Printf("Error changing password for user %s: %v", principal.UserID, err)
+		serverError(w, err, "Error changing password")
+		return
+	}
+
+	log.Printf("Password changed for user %s", principal.UserID)
+	s.recordAudit(r, userTarget(models.AuditPasswordChanged, principal.UserID, models.OutcomeSuccess))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteAccountHandler permanently deletes the authenticated user's account together with
+// all of their aquariums and parameter entries. The current password must be supplied;
+// accounts created through Google can set one with the password reset flow first.
+//
+// Method: DELETE
+// Endpoint: /user
+//
+// Request body (JSON):
+//
+//	{
+//	  "password": "current-password"
+//	}
+func (s *Server) DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.Users.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("Error retrieving user %s: %v", principal.UserID, err)
+		serverError(w, err, "Error retrieving user")
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		http.Error(w, "Password is incorrect", http.StatusForbidden)
+		return
+	}
+
+	err = s.Users.DeleteUser(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("Error deleting user %s: %v", principal.UserID, err)
+		serverError(w, err, "Error deleting account")
+		return
+	}
+
+	log.Printf("Deleted account of user %s", principal.UserID)
+	s.recordAudit(r, userTarget(models.AuditAccountDeleted, principal.UserID, models.OutcomeSuccess))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExportDataHandler downloads everything tied to the authenticated user — the profile, every
+// aquarium with its stock and every parameter entry — as a ZIP archive of JSON and CSV files.
+//
+// Method: GET
+// Endpoint: /user/export
+func (s *Server) ExportDataHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	profile, err := s.Users.GetUserProfile(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("Error retrieving profile for export of user %s: %v", principal.UserID, err)
+		serverError(w, err, "Error exporting data")
+		return
+	}
+
+	aquariums, err := s.Aquariums.GetAquariumsByUserID(r.Context(), principal.UserID, models.AquariumListOptions{IncludeParameters: true})
+	if err != nil {
+		log.Printf("Error retrieving aquariums for export of user %s: %v", principal.UserID, err)
+		serverError(w, err, "Error exporting data")
+		return
+	}
+
+	// Aquariums shared with the user belong to someone else's data
+	owned := aquariums[:0]
+	for _, aquarium := range aquariums {
+		if aquarium.UserID == principal.UserID {
+			owned = append(owned, aquarium)
+		}
+	}
+	aquariums = owned
+
+	// Build the archive in memory so a failure can still be reported as an error response
+	var archive bytes.Buffer
+	err = export.WriteArchive(&archive, export.Bundle{Profile: profile, Aquariums: aquariums})
+	if err != nil {
+		log.Printf("Error writing export archive for user %s: %v", principal.UserID, err)
+		serverError(w, err, "Error exporting data")
+		return
+	}
+
+	log.Printf("Exported data of user %s (%d bytes)", principal.UserID, archive.Len())
+
+	filename := fmt.Sprintf("aquamind-export-%s.zip", time.Now().UTC().Format("20060102"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	s.recordAudit(r, userTarget(models.AuditAccountExported, principal.UserID, models.OutcomeSuccess))
+	w.Header().Set("Content-Length", strconv.Itoa(archive.Len()))
+	w.Write(archive.Bytes())
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+)
+
+// AdminUser is the representation of a user returned by the admin endpoints.
+type AdminUser struct {
+	ID        string   `json:"id"`
+	Email     string   `json:"email"`
+	FirstName string   `json:"firstName"`
+	Roles     []string `json:"roles"`
+}
+
+// startedAt records when the service started, for the diagnostics endpoint.
+var startedAt = time.Now()
+
+// ListUsersHandler retrieves every user with their roles.
+//
+// Method: GET
+// Endpoint: /admin/users
+func (s *Server) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	users, err := s.Users.ListUsers(r.Context())
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		serverError(w, err, "Error retrieving users")
+		return
+	}
+
+	response := make([]AdminUser, 0, len(users))
+	for _, user := range users {
+		response = append(response, AdminUser{ID: user.ID, Email: user.Email, FirstName: user.FirstName, Roles: user.Roles})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// SetUserRolesHandler replaces the roles granted to a user. The "user" role is always kept,
+// and admins cannot remove their own admin role to avoid locking everyone out.
+//
+// Method: PUT
+// Endpoint: /admin/users/{id}/roles
+//
+// Request body (JSON):
+//
+//	{
+//	  "roles": ["user", "admin"]
+//	}
+func (s *Server) SetUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	userID := mux.Vars(r)["id"]
+
+	var req struct {
+		Roles []string `json:"roles"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	roles := []string{models.RoleUser}
+	isAdmin := false
+	for _, role := range req.Roles {
+		if !models.ValidRole(role) {
+			http.Error(w, "Unknown role: "+role, http.StatusBadRequest)
+			return
+		}
+		if role == models.RoleAdmin && !isAdmin {
+			isAdmin = true
+			roles = append(roles, role)
+		}
+	}
+
+	if userID == principal.UserID && !isAdmin {
+		http.Error(w, "Cannot remove your own admin role", http.StatusBadRequest)
+		return
+	}
+
+	err := s.Users.SetUserRoles(r.Context(), userID, roles)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			log.Printf("Error updating roles for user %s: %v", userID, err)
+			serverError(w, err, "Error updating roles")
+		}
+		return
+	}
+
+	log.Printf("User %s set roles of user %s to %v", principal.UserID, userID, roles)
+	event := userTarget(models.AuditRolesChanged, userID, models.OutcomeSuccess)
+	event.Details = map[string]interface{}{"roles": roles}
+	s.recordAudit(r, event)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": userID, "roles": roles})
+}
+
+// DiagnosticsHandler reports the health of the service and its database connection pool.
+//
+// Method: GET
+// Endpoint: /admin/diagnostics
+func (s *Server) DiagnosticsHandler(w http.ResponseWriter, r *http.Request) {
+	startPing := time.Now()
+	pingErr := s.Health.Ping(r.Context())
+	pingDuration := time.Since(startPing)
+
+	database := map[string]interface{}{
+		"reachable": pingErr == nil,
+		"pingMs":    pingDuration.Milliseconds(),
+	}
+	if pingErr != nil {
+		database["error"] = pingErr.Error()
+	}
+
+	stats := s.Health.DBStats()
+	database["openConnections"] = stats.OpenConnections
+	database["inUse"] = stats.InUse
+	database["idle"] = stats.Idle
+	database["waitCount"] = stats.WaitCount
+	database["waitDurationMs"] = stats.WaitDuration.Milliseconds()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"uptimeSeconds": int64(time.Since(startedAt).Seconds()),
+		"goroutines":    runtime.NumGoroutine(),
+		"signingKeyId":  s.Keys.SigningKeyID(),
+		"database":      database,
+	})
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+)
+
+// MergePatchContentType is the media type of JSON merge patches (RFC 7396).
+const MergePatchContentType = "application/merge-patch+json"
+
+// PatchAquariumHandler changes some fields of an aquarium with a JSON merge patch
+// (RFC 7396): members of the patch replace those of the aquarium, null removes them and
+// arrays, such as species, are replaced as a whole. The ID, owner and version of an
+// aquarium cannot be patched.
+//
+// Method: PATCH
+// Endpoint: /aquariums/{id}
+//
+// Headers:
+//   - Content-Type: application/merge-patch+json
+//   - If-Match: the ETag of the aquarium the patch is based on (required), as for
+//     UpdateAquariumHandler
+//
+// Request body (JSON merge patch):
+//
+//	{
+//	  "name": "Living room tank",
+//	  "plants": [{"id": "java-fern", "count": 2}]
+//	}
+func (s *Server) PatchAquariumHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != MergePatchContentType {
+		http.Error(w, "Content-Type must be "+MergePatchContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Viewers cannot change the aquarium
+	role, ok := s.authorizeAquarium(w, r, principal, id, models.AquariumRoleEditor)
+	if !ok {
+		return
+	}
+
+	version, ok := s.ifMatchVersion(w, r, id)
+	if !ok {
+		return
+	}
+
+	var patch map[string]interface{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&patch); err != nil || patch == nil {
+		http.Error(w, "Merge patch must be a JSON object", http.StatusBadRequest)
+		return
+	}
+
+	current, err := s.Aquariums.GetAquariumByID(r.Context(), id)
+	if err != nil {
+		s.writeAquariumUpdateError(w, r, err, id, role)
+		return
+	}
+	// "*" matches whatever version was read, and the patch applies to that one
+	if version == 0 {
+		version = current.Version
+	}
+	if current.Version != version {
+		s.writeAquariumConflict(w, r, id, role)
+		return
+	}
+
+	// The patch applies to the aquarium as stored, as recorded by its current revision.
+	// The response shows the catalog's fields for equipment without fields of its own;
+	// saving those would keep later catalog changes from reaching the aquarium.
+	revision, err := s.Aquariums.GetAquariumRevision(r.Context(), id, current.Version)
+	if err != nil {
+		log.Printf("Error retrieving revision %d of aquarium %s: %v", current.Version, id, err)
+		serverError(w, err, "Error retrieving aquarium")
+		return
+	}
+	stored := revision.Snapshot.Aquarium(id)
+	stored.UserID = current.UserID
+
+	aquarium, err := patchAquarium(stored, patch)
+	if err != nil {
+		http.Error(w, "Patched aquarium is invalid: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	aquarium.ID = id
+	aquarium.Version = version
+
+	// The store applies the patch only if no other change got in since it was read
+	err = s.Aquariums.UpdateAquarium(r.Context(), aquarium, s.actorFromRequest(r, principal))
+	if err != nil {
+		s.writeAquariumUpdateError(w, r, err, id, role)
+		return
+	}
+
+	log.Printf("User %s patched aquarium %s", principal.UserID, id)
+	s.recordAudit(r, targetEvent(models.AuditAquariumUpdate, "aquarium", id, models.OutcomeSuccess))
+
+	updated, err := s.Aquariums.GetAquariumByID(r.Context(), id)
+	if err != nil {
+		log.Printf("Error retrieving aquarium %s: %v", id, err)
+		serverError(w, err, "Error retrieving aquarium")
+		return
+	}
+	updated.Role = role
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", aquariumETag(updated.Version))
+	json.NewEncoder(w).Encode(updated)
+}
+
+// patchAquarium applies a merge patch to the stored fields of an aquarium.
+func patchAquarium(stored models.Aquarium, patch map[string]interface{}) (*models.Aquarium, error) {
+	encoded, err := json.Marshal(stored)
+	if err != nil {
+		return nil, err
+	}
+	var document interface{}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+
+	patched, err := json.Marshal(mergePatch(document, patch))
+	if err != nil {
+		return nil, err
+	}
+	var result models.Aquarium
+	if err := json.Unmarshal(patched, &result); err != nil {
+		return nil, err
+	}
+	result.UserID = stored.UserID
+	result.ParameterEntries = nil
+	return &result, nil
+}
+
+// mergePatch applies a JSON merge patch to a decoded JSON document, as specified by
+// RFC 7396, and returns the patched document. The target may be modified.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergePatch(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+)
+
+// The examples of RFC 7396, Appendix A.
+func TestMergePatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, test := range tests {
+		var target, patch, want interface{}
+		for _, decode := range []struct {
+			raw string
+			v   *interface{}
+		}{{test.target, &target}, {test.patch, &patch}, {test.want, &want}} {
+			if err := json.Unmarshal([]byte(decode.raw), decode.v); err != nil {
+				t.Fatalf("decoding %s: %v", decode.raw, err)
+			}
+		}
+
+		if got := mergePatch(target, patch); !reflect.DeepEqual(got, want) {
+			t.Errorf("mergePatch(%s, %s) = %v, want %s", test.target, test.patch, got, test.want)
+		}
+	}
+}
+
+func TestPatchAquariumRecordsOnlyPatchedFields(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+	token := server.register(t, "ada@example.com")
+
+	heater := &models.Equipment{Id: "heater", Name: "Heater", Description: "Keeps the water warm", Fields: json.RawMessage(`["wattage"]`)}
+	if err := server.store.CreateEquipment(context.Background(), heater, models.Actor{}); err != nil {
+		t.Fatalf("CreateEquipment: %v", err)
+	}
+
+	// One heater shows the fields of the catalog, the other has fields of its own
+	id := newID(t)
+	resp := server.expect(t, http.StatusCreated, "POST", "/aquariums", token, map[string]interface{}{
+		"id":   id,
+		"name": "Living room tank",
+		"equipment": []map[string]interface{}{
+			{"id": "heater"},
+			{"id": "heater", "fields": []string{"wattage: 100 W"}},
+		},
+	})
+	path := "/aquariums/" + id
+
+	server.expect(t, http.StatusOK, "PATCH", path, token, map[string]interface{}{"name": "Office tank"},
+		"Content-Type", MergePatchContentType, "If-Match", resp.header.Get("ETag"))
+
+	var revisions []models.AquariumRevision
+	server.expect(t, http.StatusOK, "GET", path+"/revisions", token, nil).decode(t, &revisions)
+	if len(revisions) != 2 {
+		t.Fatalf("revisions = %+v, want the creation and the patch", revisions)
+	}
+	want := models.AquariumChanges{Fields: []models.FieldChange{{Field: "name", From: "Living room tank", To: "Office tank"}}}
+	if !reflect.DeepEqual(revisions[0].Changes, want) {
+		t.Errorf("changes of the patch = %+v, want %+v", revisions[0].Changes, want)
+	}
+
+	// The heater without fields of its own still follows the catalog
+	heater.Fields = json.RawMessage(`["wattage","thermostat"]`)
+	if err := server.store.UpdateEquipment(context.Background(), heater, models.Actor{}); err != nil {
+		t.Fatalf("UpdateEquipment: %v", err)
+	}
+	var aquarium models.AquariumResponse
+	server.expect(t, http.StatusOK, "GET", path, token, nil).decode(t, &aquarium)
+	if len(aquarium.Equipment) != 2 {
+		t.Fatalf("equipment = %+v, want two heaters", aquarium.Equipment)
+	}
+	if got := string(aquarium.Equipment[0].Fields); got != `["wattage","thermostat"]` {
+		t.Errorf("fields of the first heater = %s, want those of the catalog", got)
+	}
+	if got := string(aquarium.Equipment[1].Fields); got != `["wattage: 100 W"]` {
+		t.Errorf("fields of the second heater = %s, want its own", got)
+	}
+}
@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+)
+
+// Every change of an aquarium is recorded as a revision, numbered by the version it
+// produced. Anyone the aquarium is shared with can browse its history and see it as it was
+// at any time; editors can restore it to an earlier revision, which is itself recorded as
+// a new revision so that a restore can be undone.
+
+// defaultRevisionLimit is how many revisions are listed when no limit is given.
+const defaultRevisionLimit = 50
+
+// ListAquariumRevisionsHandler lists the revisions of an aquarium, newest first, with who
+// made each change, when, and what it changed. Snapshots are omitted.
+//
+// Method: GET
+// Endpoint: /aquariums/{id}/revisions
+//
+// Query parameters (optional):
+//   - limit: the maximum number of revisions (default 50, at most 1000)
+func (s *Server) ListAquariumRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	if _, ok := s.authorizeAquarium(w, r, principal, id, models.AquariumRoleViewer); !ok {
+		return
+	}
+
+	limit, ok := parseAuditLimit(r, defaultRevisionLimit)
+	if !ok {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	revisions, err := s.Aquariums.ListAquariumRevisions(r.Context(), id, limit)
+	if err != nil {
+		log.Printf("Error listing revisions of aquarium %s: %v", id, err)
+		serverError(w, err, "Error retrieving revisions")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// GetAquariumRevisionHandler retrieves one revision of an aquarium together with the
+// snapshot of the aquarium it produced.
+//
+// Method: GET
+// Endpoint: /aquariums/{id}/revisions/{version}
+func (s *Server) GetAquariumRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	if _, ok := s.authorizeAquarium(w, r, principal, id, models.AquariumRoleViewer); !ok {
+		return
+	}
+
+	version, err := strconv.ParseInt(vars["version"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+
+	revision, err := s.Aquariums.GetAquariumRevision(r.Context(), id, version)
+	s.writeAquariumRevision(w, revision, err, id)
+}
+
+// GetAquariumAsOfHandler retrieves the revision of an aquarium in effect at a point in
+// time, with the snapshot of the aquarium as it was then.
+//
+// Method: GET
+// Endpoint: /aquariums/{id}/as-of
+//
+// Query parameters:
+//   - time: an RFC 3339 timestamp
+func (s *Server) GetAquariumAsOfHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	if _, ok := s.authorizeAquarium(w, r, principal, id, models.AquariumRoleViewer); !ok {
+		return
+	}
+
+	at, err := time.Parse(time.RFC3339, r.URL.Query().Get("time"))
+	if err != nil {
+		http.Error(w, "Invalid time timestamp", http.StatusBadRequest)
+		return
+	}
+
+	revision, err := s.Aquariums.GetAquariumRevisionAt(r.Context(), id, at)
+	s.writeAquariumRevision(w, revision, err, id)
+}
+
+// writeAquariumRevision responds with a revision retrieved for an aquarium.
+func (s *Server) writeAquariumRevision(w http.ResponseWriter, revision *models.AquariumRevision, err error, aquariumID string) {
+	if err == sql.ErrNoRows {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error retrieving revision of aquarium %s: %v", aquariumID, err)
+		serverError(w, err, "Error retrieving revision")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revision)
+}
+
+// RestoreAquariumRevisionHandler restores an aquarium to the state recorded by one of its
+// revisions. The restore is recorded as a new revision. Species, plants and equipment
+// since removed from the catalog cannot be restored and are reported with 422.
+//
+// Method: POST
+// Endpoint: /aquariums/{id}/revisions/{version}/restore
+//
+// Headers:
+//   - If-Match: the ETag of the aquarium the restore is based on (required), as for
+//     UpdateAquariumHandler
+func (s *Server) RestoreAquariumRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	// Viewers cannot change the aquarium
+	role, ok := s.authorizeAquarium(w, r, principal, id, models.AquariumRoleEditor)
+	if !ok {
+		return
+	}
+
+	revision, err := strconv.ParseInt(vars["version"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := s.ifMatchVersion(w, r, id)
+	if !ok {
+		return
+	}
+
+	_, err = s.Aquariums.RestoreAquariumRevision(r.Context(), id, revision, version, s.actorFromRequest(r, principal))
+	if err == sql.ErrNoRows {
+		// The aquarium exists, as authorizeAquarium found it, so the revision does not
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.writeAquariumUpdateError(w, r, err, id, role)
+		return
+	}
+
+	log.Printf("User %s restored aquarium %s to revision %d", principal.UserID, id, revision)
+	event := targetEvent(models.AuditAquariumRestore, "aquarium", id, models.OutcomeSuccess)
+	event.Details = map[string]interface{}{"restored_from": revision}
+	s.recordAudit(r, event)
+
+	aquarium, err := s.Aquariums.GetAquariumByID(r.Context(), id)
+	if err != nil {
+		log.Printf("Error retrieving aquarium %s: %v", id, err)
+		serverError(w, err, "Error retrieving aquarium")
+		return
+	}
+	aquarium.Role = role
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", aquariumETag(aquarium.Version))
+	json.NewEncoder(w).Encode(aquarium)
+}
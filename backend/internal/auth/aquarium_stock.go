@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+)
+
+// Species and plants can be added to and removed from an aquarium one at a time, so that
+// adding a fish does not require sending the whole aquarium. Each change applies to the
+// current state of the aquarium, so If-Match is optional: concurrent additions all count.
+
+// stockKinds maps the path segments of the stock routes to catalog detail types.
+var stockKinds = map[string]string{
+	"species": models.DetailSpecies,
+	"plants":  models.DetailPlant,
+}
+
+// AddAquariumStockHandler adds some of a species or plant from the catalog to an
+// aquarium, adding to its count if the aquarium already keeps it.
+//
+// Method: POST
+// Endpoint: /aquariums/{id}/species/{detailId} or /aquariums/{id}/plants/{detailId}
+//
+// Headers:
+//   - If-Match: the ETag of the aquarium the change is based on (optional)
+//
+// Request body (JSON, optional; count defaults to 1):
+//
+//	{
+//	  "count": 3
+//	}
+func (s *Server) AddAquariumStockHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Count *int `json:"count"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	count := 1
+	if req.Count != nil {
+		count = *req.Count
+	}
+	if count < 1 {
+		http.Error(w, "Count must be a positive number", http.StatusBadRequest)
+		return
+	}
+
+	s.adjustAquariumStock(w, r, models.StockAdjustment{Delta: count})
+}
+
+// RemoveAquariumStockHandler removes some or all of a species or plant from an aquarium.
+// The species or plant is removed from the aquarium once none is left.
+//
+// Method: DELETE
+// Endpoint: /aquariums/{id}/species/{detailId} or /aquariums/{id}/plants/{detailId}
+//
+// Headers:
+//   - If-Match: the ETag of the aquarium the change is based on (optional)
+//
+// Query parameters (optional):
+//   - count: how many to remove; all of them are removed if omitted
+func (s *Server) RemoveAquariumStockHandler(w http.ResponseWriter, r *http.Request) {
+	adjustment := models.StockAdjustment{RemoveAll: true}
+	if value := r.URL.Query().Get("count"); value != "" {
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 1 {
+			http.Error(w, "Count must be a positive number", http.StatusBadRequest)
+			return
+		}
+		adjustment = models.StockAdjustment{Delta: -count}
+	}
+
+	s.adjustAquariumStock(w, r, adjustment)
+}
+
+// adjustAquariumStock applies a change of the stock of the aquarium of a request and
+// responds with the aquarium as changed.
+func (s *Server) adjustAquariumStock(w http.ResponseWriter, r *http.Request, adjustment models.StockAdjustment) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(r)
+	adjustment.AquariumID = vars["id"]
+	adjustment.DetailType = stockKinds[vars["kind"]]
+	adjustment.DetailID = vars["detailId"]
+
+	// Viewers cannot change the aquarium
+	role, ok := s.authorizeAquarium(w, r, principal, adjustment.AquariumID, models.AquariumRoleEditor)
+	if !ok {
+		return
+	}
+	if r.Header.Get("If-Match") != "" {
+		if adjustment.Version, ok = s.ifMatchVersion(w, r, adjustment.AquariumID); !ok {
+			return
+		}
+	}
+
+	err := s.Aquariums.AdjustAquariumStock(r.Context(), &adjustment, s.actorFromRequest(r, principal))
+	if errors.Is(err, models.ErrStockNotFound) {
+		http.Error(w, "The aquarium does not keep "+vars["kind"]+" "+adjustment.DetailID, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.writeAquariumUpdateError(w, r, err, adjustment.AquariumID, role)
+		return
+	}
+
+	log.Printf("User %s changed the count of %s %s in aquarium %s to %d", principal.UserID, adjustment.DetailType, adjustment.DetailID, adjustment.AquariumID, adjustment.Count)
+	event := targetEvent(models.AuditAquariumUpdate, "aquarium", adjustment.AquariumID, models.OutcomeSuccess)
+	event.Details = map[string]interface{}{"detail_type": adjustment.DetailType, "detail_id": adjustment.DetailID, "count": adjustment.Count}
+	s.recordAudit(r, event)
+
+	aquarium, err := s.Aquariums.GetAquariumByID(r.Context(), adjustment.AquariumID)
+	if err != nil {
+		log.Printf("Error retrieving aquarium %s: %v", adjustment.AquariumID, err)
+		serverError(w, err, "Error retrieving aquarium")
+		return
+	}
+	aquarium.Role = role
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", aquariumETag(aquarium.Version))
+	json.NewEncoder(w).Encode(aquarium)
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+)
+
+func TestAquariumStock(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+	token := server.register(t, "ada@example.com")
+	if err := server.store.CreateSpecies(context.Background(), &models.Species{Id: "neon-tetra", Name: "Neon tetra"}, models.Actor{}); err != nil {
+		t.Fatalf("CreateSpecies: %v", err)
+	}
+	aquarium := server.createAquarium(t, token, "Living room tank")
+	path := "/aquariums/" + aquarium.ID + "/species/neon-tetra"
+
+	resp := server.expect(t, http.StatusOK, "POST", path, token, map[string]int{"count": 3}, "If-Match", `"1"`)
+	etag := resp.header.Get("ETag")
+	if etag != `"2"` {
+		t.Errorf("ETag after adding = %s, want \"2\"", etag)
+	}
+
+	// Changes based on an earlier version are refused
+	server.expect(t, http.StatusPreconditionFailed, "POST", path, token, nil, "If-Match", `"1"`)
+	server.expect(t, http.StatusPreconditionFailed, "DELETE", path+"?count=1", token, nil, "If-Match", `"1"`)
+
+	var stocked models.AquariumResponse
+	server.expect(t, http.StatusOK, "DELETE", path+"?count=2", token, nil, "If-Match", etag).decode(t, &stocked)
+	if len(stocked.Species) != 1 || stocked.Species[0].Count != 1 {
+		t.Errorf("species after removing 2 of 3 = %+v, want 1 neon tetra", stocked.Species)
+	}
+
+	// The species is removed once none is left
+	var emptied models.AquariumResponse
+	server.expect(t, http.StatusOK, "DELETE", path+"?count=1", token, nil).decode(t, &emptied)
+	if len(emptied.Species) != 0 {
+		t.Errorf("species after removing the last one = %+v, want none", emptied.Species)
+	}
+	server.expect(t, http.StatusNotFound, "DELETE", path, token, nil)
+}
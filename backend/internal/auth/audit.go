@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+)
+
+// Limits on the number of audit events returned at once.
+const (
+	defaultAuditLimit    = 100
+	maxAuditLimit        = 1000
+	defaultActivityLimit = 50
+)
+
+// actorFromRequest identifies the principal making the request and where it comes from.
+func (s *Server) actorFromRequest(r *http.Request, principal *Principal) models.Actor {
+	return models.Actor{UserID: principal.UserID, IP: s.ClientIP(r), UserAgent: r.UserAgent()}
+}
+
+// recordAudit appends an event about the request to the audit log. The actor defaults to
+// the authenticated principal, if any, and the IP address and user agent are taken from
+// the request. Failing to record an event is logged but does not fail the request.
+// The event is recorded even if the client has gone away, since the action it describes
+// may already have taken effect.
+func (s *Server) recordAudit(r *http.Request, event models.AuditEvent) {
+	if event.ActorID == "" {
+		if principal, ok := PrincipalFromContext(r.Context()); ok {
+			event.ActorID = principal.UserID
+		}
+	}
+	event.IP = s.ClientIP(r)
+	event.UserAgent = r.UserAgent()
+
+	if err := s.Audit.RecordAuditEvent(context.WithoutCancel(r.Context()), event); err != nil {
+		log.Printf("Error recording audit event %s: %v", event.Action, err)
+	}
+}
+
+// targetEvent returns an audit event about an object of the given type.
+func targetEvent(action string, targetType string, targetID string, outcome string) models.AuditEvent {
+	return models.AuditEvent{Action: action, TargetType: targetType, TargetID: targetID, Outcome: outcome}
+}
+
+// userTarget returns an audit event about the given user, or about no user if userID is "".
+func userTarget(action string, userID string, outcome string) models.AuditEvent {
+	if userID == "" {
+		return models.AuditEvent{Action: action, Outcome: outcome}
+	}
+	return targetEvent(action, "user", userID, outcome)
+}
+
+// parseAuditLimit reads the "limit" query parameter.
+func parseAuditLimit(r *http.Request, fallback int) (int, bool) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return fallback, true
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxAuditLimit {
+		return 0, false
+	}
+	return limit, true
+}
+
+// ListAuditEventsHandler searches the audit log.
+//
+// Method: GET
+// Endpoint: /admin/audit-events
+//
+// Query parameters (all optional):
+//   - actor: ID of the acting user
+//   - action: exact action, or a prefix ending in "*" such as "auth.*"
+//   - target_type, target_id: the object acted on
+//   - outcome: "success", "failure" or "denied"
+//   - since, until: RFC 3339 timestamps bounding the time range
+//   - limit: maximum number of events (default 100, at most 1000)
+func (s *Server) ListAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.AuditFilter{
+		ActorID:    query.Get("actor"),
+		Action:     query.Get("action"),
+		TargetType: query.Get("target_type"),
+		TargetID:   query.Get("target_id"),
+		Outcome:    query.Get("outcome"),
+	}
+
+	for name, bound := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				http.Error(w, "Invalid "+name+" timestamp", http.StatusBadRequest)
+				return
+			}
+			*bound = &parsed
+		}
+	}
+
+	limit, ok := parseAuditLimit(r, defaultAuditLimit)
+	if !ok {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	filter.Limit = limit
+
+	events, err := s.Audit.ListAuditEvents(r.Context(), filter)
+	if err != nil {
+		log.Printf("Error listing audit events: %v", err)
+		serverError(w, err, "Error retrieving audit events")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// SecurityActivityHandler lists the authenticated user's recent sign-ins, failed login
+// attempts and account changes. Event details, which may mention other accounts, are omitted.
+//
+// Method: GET
+// Endpoint: /user/security-activity
+func (s *Server) SecurityActivityHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	limit, ok := parseAuditLimit(r, defaultActivityLimit)
+	if !ok {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	events, err := s.Audit.ListSecurityActivity(r.Context(), principal.UserID, limit)
+	if err != nil {
+		log.Printf("Error listing security activity for user %s: %v", principal.UserID, err)
+		serverError(w, err, "Error retrieving security activity")
+		return
+	}
+
+	for i := range events {
+		events[i].Details = nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
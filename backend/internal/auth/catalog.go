@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+)
+
+// validatable is implemented by every catalog detail type.
+type validatable interface {
+	Validate() error
+}
+
+// decodeDetail decodes and validates a catalog detail of the given type from the request body,
+// setting its ID to id when one is given.
+func decodeDetail(r *http.Request, detailType string, id string) (validatable, error) {
+	var detail validatable
+	switch detailType {
+	case models.DetailSpecies:
+		species := &models.Species{}
+		if err := json.NewDecoder(r.Body).Decode(species); err != nil {
+			return nil, err
+		}
+		if id != "" {
+			species.Id = id
+		}
+		detail = species
+	case models.DetailPlant:
+		plant := &models.Plant{}
+		if err := json.NewDecoder(r.Body).Decode(plant); err != nil {
+			return nil, err
+		}
+		if id != "" {
+			plant.Id = id
+		}
+		detail = plant
+	case models.DetailEquipment:
+		equipment := &models.Equipment{}
+		if err := json.NewDecoder(r.Body).Decode(equipment); err != nil {
+			return nil, err
+		}
+		if id != "" {
+			equipment.Id = id
+		}
+		detail = equipment
+	}
+
+	return detail, detail.Validate()
+}
+
+// writeDetailError maps errors from decoding, validating or saving a detail to a response.
+func writeDetailError(w http.ResponseWriter, err error, action string) {
+	var validationErr *models.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		http.Error(w, validationErr.Error(), http.StatusBadRequest)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, models.ErrDetailInUse):
+		http.Error(w, "Detail is kept in an aquarium", http.StatusConflict)
+	default:
+		log.Printf("Error trying to %s detail: %v", action, err)
+		serverError(w, err, "Error trying to "+action+" detail")
+	}
+}
+
+// CreateDetailHandler adds a species, plant or equipment item to the catalog.
+//
+// Method: POST
+// Endpoint: /admin/details/{type}
+func (s *Server) CreateDetailHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	detailType, err := models.NormalizeDetailType(mux.Vars(r)["type"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	detail, err := decodeDetail(r, detailType, "")
+	if err != nil {
+		var validationErr *models.ValidationError
+		if !errors.As(err, &validationErr) {
+			http.Error(w, "Invalid input", http.StatusBadRequest)
+			return
+		}
+		writeDetailError(w, err, "create")
+		return
+	}
+
+	switch d := detail.(type) {
+	case *models.Species:
+		err = s.Catalog.CreateSpecies(r.Context(), d, s.actorFromRequest(r, principal))
+	case *models.Plant:
+		err = s.Catalog.CreatePlant(r.Context(), d, s.actorFromRequest(r, principal))
+	case *models.Equipment:
+		err = s.Catalog.CreateEquipment(r.Context(), d, s.actorFromRequest(r, principal))
+	}
+	if err != nil {
+		writeDetailError(w, err, "create")
+		return
+	}
+
+	log.Printf("User %s created %s detail", principal.UserID, detailType)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(detail)
+}
+
+// UpdateDetailHandler replaces a species, plant or equipment item in the catalog.
+//
+// Method: PUT
+// Endpoint: /admin/details/{type}/{id}
+func (s *Server) UpdateDetailHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(r)
+
+	detailType, err := models.NormalizeDetailType(vars["type"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	detail, err := decodeDetail(r, detailType, vars["id"])
+	if err != nil {
+		var validationErr *models.ValidationError
+		if !errors.As(err, &validationErr) {
+			http.Error(w, "Invalid input", http.StatusBadRequest)
+			return
+		}
+		writeDetailError(w, err, "update")
+		return
+	}
+
+	switch d := detail.(type) {
+	case *models.Species:
+		err = s.Catalog.UpdateSpecies(r.Context(), d, s.actorFromRequest(r, principal))
+	case *models.Plant:
+		err = s.Catalog.UpdatePlant(r.Context(), d, s.actorFromRequest(r, principal))
+	case *models.Equipment:
+		err = s.Catalog.UpdateEquipment(r.Context(), d, s.actorFromRequest(r, principal))
+	}
+	if err != nil {
+		writeDetailError(w, err, "update")
+		return
+	}
+
+	log.Printf("User %s updated %s detail %s", principal.UserID, detailType, vars["id"])
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+// DeleteDetailHandler removes a species, plant or equipment item from the catalog.
+// Details kept in any aquarium cannot be deleted and are refused with 409 Conflict.
+//
+// Method: DELETE
+// Endpoint: /admin/details/{type}/{id}
+func (s *Server) DeleteDetailHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(r)
+
+	detailType, err := models.NormalizeDetailType(vars["type"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.Catalog.DeleteDetail(r.Context(), detailType, vars["id"], s.actorFromRequest(r, principal))
+	if err != nil {
+		writeDetailError(w, err, "delete")
+		return
+	}
+
+	log.Printf("User %s deleted %s detail %s", principal.UserID, detailType, vars["id"])
+
+	w.WriteHeader(http.StatusNoContent)
+}
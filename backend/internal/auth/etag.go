@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Aquariums are versioned so that concurrent edits do not silently overwrite each other.
+// Responses carrying an aquarium send its version as a strong entity tag, and requests
+// changing an aquarium must send the entity tag they are based on in If-Match. A stale
+// entity tag is refused with 412 Precondition Failed, together with the current aquarium
+// so the client can merge its changes and retry. As specified for If-Match, "*" matches
+// the aquarium whatever its version, and a list of entity tags matches if any of them does.
+
+// aquariumETag returns the entity tag of an aquarium at the given version.
+func aquariumETag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ifMatchVersion reads the If-Match header of a request changing an aquarium and returns
+// the version of the aquarium the change must apply to: 0, which applies to any version,
+// for "*", and otherwise the current version if it is listed. A header listing no current
+// entity tag yields -1, which no version matches. It responds 428 Precondition Required if
+// the header is missing and 400 Bad Request if it is not a list of entity tags.
+func (s *Server) ifMatchVersion(w http.ResponseWriter, r *http.Request, aquariumID string) (int64, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		http.Error(w, "If-Match header with the ETag of the aquarium is required", http.StatusPreconditionRequired)
+		return 0, false
+	}
+
+	versions, wildcard, ok := parseIfMatch(header)
+	switch {
+	case !ok:
+		http.Error(w, "Invalid If-Match header", http.StatusBadRequest)
+		return 0, false
+	case wildcard:
+		return 0, true
+	case len(versions) == 0:
+		return -1, true
+	case len(versions) == 1:
+		return versions[0], true
+	}
+
+	// The condition holds if any of the listed versions is the current one
+	current, err := s.Aquariums.GetAquariumByID(r.Context(), aquariumID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Aquarium not found", http.StatusNotFound)
+		return 0, false
+	}
+	if err != nil {
+		log.Printf("Error retrieving aquarium %s: %v", aquariumID, err)
+		serverError(w, err, "Error retrieving aquarium")
+		return 0, false
+	}
+	for _, version := range versions {
+		if version == current.Version {
+			return version, true
+		}
+	}
+	return -1, true
+}
+
+// parseIfMatch parses an If-Match header (RFC 7232, section 3.1), which is "*" or a list
+// of entity tags. It returns the aquarium versions listed; weak entity tags and tags of no
+// aquarium version never match under the strong comparison If-Match uses and are left
+// out. wildcard reports "*", and ok is false if the header is not valid.
+func parseIfMatch(header string) (versions []int64, wildcard bool, ok bool) {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return nil, true, true
+	}
+
+	tags := 0
+	rest := header
+	for {
+		rest = strings.TrimLeft(rest, " \t")
+		if rest == "" {
+			break
+		}
+		// Lists may contain empty elements
+		if rest[0] == ',' {
+			rest = rest[1:]
+			continue
+		}
+
+		weak := strings.HasPrefix(rest, "W/")
+		if weak {
+			rest = rest[2:]
+		}
+		if !strings.HasPrefix(rest, `"`) {
+			return nil, false, false
+		}
+		end := strings.IndexByte(rest[1:], '"')
+		if end < 0 {
+			return nil, false, false
+		}
+		opaque := rest[1 : end+1]
+		for i := 0; i < len(opaque); i++ {
+			if opaque[i] < 0x21 || opaque[i] == 0x7f {
+				return nil, false, false
+			}
+		}
+		rest = strings.TrimLeft(rest[end+2:], " \t")
+		if rest != "" && rest[0] != ',' {
+			return nil, false, false
+		}
+		tags++
+
+		version, err := strconv.ParseInt(opaque, 10, 64)
+		if !weak && err == nil && version >= 1 && aquariumETag(version) == `"`+opaque+`"` {
+			versions = append(versions, version)
+		}
+	}
+	if tags == 0 {
+		return nil, false, false
+	}
+	return versions, false, true
+}
+
+// writeAquariumConflict responds 412 Precondition Failed with the current state of an
+// aquarium changed since the version a request was based on.
+func (s *Server) writeAquariumConflict(w http.ResponseWriter, r *http.Request, aquariumID string, role string) {
+	current, err := s.Aquariums.GetAquariumByID(r.Context(), aquariumID)
+	if err != nil {
+		log.Printf("Error retrieving current state of aquarium %s: %v", aquariumID, err)
+		serverError(w, err, "Error retrieving aquarium")
+		return
+	}
+	current.Role = role
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", aquariumETag(current.Version))
+	w.WriteHeader(http.StatusPreconditionFailed)
+	json.NewEncoder(w).Encode(current)
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseIfMatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		header   string
+		versions []int64
+		wildcard bool
+		ok       bool
+	}{
+		{header: `"3"`, versions: []int64{3}, ok: true},
+		{header: ` "3" `, versions: []int64{3}, ok: true},
+		{header: `*`, wildcard: true, ok: true},
+		{header: `"3", "4"`, versions: []int64{3, 4}, ok: true},
+		{header: `"3",,"4",`, versions: []int64{3, 4}, ok: true},
+		{header: `W/"3"`, ok: true},
+		{header: `W/"3", "4"`, versions: []int64{4}, ok: true},
+		{header: `"abc"`, ok: true},
+		{header: `"03"`, ok: true},
+		{header: `"0"`, ok: true},
+		{header: `"a,b", "5"`, versions: []int64{5}, ok: true},
+		{header: `3`},
+		{header: `"3`},
+		{header: `"3" "4"`},
+		{header: `"3" x`},
+		{header: `"a b"`},
+		{header: `w/"3"`},
+		{header: `,`},
+		{header: `*, "3"`},
+	}
+
+	for _, test := range tests {
+		versions, wildcard, ok := parseIfMatch(test.header)
+		if !reflect.DeepEqual(versions, test.versions) || wildcard != test.wildcard || ok != test.ok {
+			t.Errorf("parseIfMatch(%q) = %v, %v, %v, want %v, %v, %v", test.header, versions, wildcard, ok, test.versions, test.wildcard, test.ok)
+		}
+	}
+}
+
+func TestIfMatchConditions(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+	token := server.register(t, "ada@example.com")
+	aquarium := server.createAquarium(t, token, "Living room tank")
+	path := "/aquariums/" + aquarium.ID
+	update := map[string]interface{}{"name": "Office tank"}
+
+	server.expect(t, http.StatusBadRequest, "PUT", path, token, update, "If-Match", `"1`)
+	server.expect(t, http.StatusBadRequest, "PUT", path, token, update, "If-Match", `1`)
+
+	// Weak entity tags never match
+	server.expect(t, http.StatusPreconditionFailed, "PUT", path, token, update, "If-Match", `W/"1"`)
+	server.expect(t, http.StatusPreconditionFailed, "PUT", path, token, update, "If-Match", `"7", "8"`)
+
+	// A list matches if any of its entity tags does
+	resp := server.expect(t, http.StatusOK, "PUT", path, token, update, "If-Match", `"7", "1"`)
+	if etag := resp.header.Get("ETag"); etag != `"2"` {
+		t.Errorf("ETag after the update = %s, want \"2\"", etag)
+	}
+
+	// "*" matches any version
+	server.expect(t, http.StatusOK, "PUT", path, token, update, "If-Match", `*`)
+	server.expect(t, http.StatusOK, "PATCH", path, token, update, "Content-Type", MergePatchContentType, "If-Match", `*`)
+	server.expect(t, http.StatusOK, "POST", path+"/revisions/1/restore", token, nil, "If-Match", `*`)
+
+	var current struct {
+		Name    string `json:"name"`
+		Version int64  `json:"version"`
+	}
+	server.expect(t, http.StatusOK, "GET", path, token, nil).decode(t, &current)
+	if current.Name != "Living room tank" || current.Version != 5 {
+		t.Errorf("aquarium = %+v, want version 5 restored to the first revision", current)
+	}
+}
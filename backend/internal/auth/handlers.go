@@ -10,11 +10,12 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"net/mail"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
-	utils "github.com/stevenpstansberry/AquaMind-AI/internal/util"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -40,8 +41,9 @@ type Credentials struct {
 //   - Parse and validate the incoming request body (expects JSON).
 //   - Check if the user already exists in the database.
 //   - Store the user details in the database.
-//   - Generate a JWT token for the registered user.
-//   - Return the token as a JSON response or an error message in case of failure.
+//   - Send an email verification link.
+//   - Start a session and generate its access and refresh tokens.
+//   - Return the tokens as a JSON response or an error message in case of failure.
 //
 // Request body (JSON):
 //
@@ -52,9 +54,9 @@ type Credentials struct {
 //	}
 //
 // Response (JSON):
-//   - On success: {"token": "generated-jwt-token"}
+//   - On success: {"token": "generated-jwt-token", "refresh_token": "opaque-refresh-token", "expires_in": 900}
 //   - On error: HTTP status code with an appropriate error message.
-func RegisterUser(w http.ResponseWriter, r *http.Request) {
+func (s *Server) RegisterUser(w http.ResponseWriter, r *http.Request) {
 	log.Println("✨ Received Register request")
 
 	var creds Credentials
@@ -67,10 +69,17 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("🔍 Parsed credentials: %+v", creds)
+	log.Printf("🔍 Registration request for %s", creds.Email)
+
+	// Reject malformed email addresses
+	if _, err := mail.ParseAddress(creds.Email); err != nil {
+		log.Printf("⚠️ Invalid email address: %s", creds.Email)
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
 
 	// Check if user already exists
-	if models.UserExists(creds.Email) {
+	if s.Users.UserExists(r.Context(), creds.Email) {
 		log.Printf("⚠️ User with email %s already exists", creds.Email)
 		http.Error(w, "User already exists", http.StatusBadRequest)
 		return
@@ -80,29 +89,40 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(creds.Password), bcrypt.DefaultCost)
 	if err != nil {
 		log.Printf("❗ Error hashing password: %v", err)
-		http.Error(w, "Error processing password", http.StatusInternalServerError)
+		serverError(w, err, "Error processing password")
 		return
 	}
 
 	// Create user in the database with the hashed password
-	err = models.CreateUser(creds.Email, string(hashedPassword), creds.FirstName, creds.Username, creds.Subscribe, creds.CreatedAt)
+	userID, err := s.Users.CreateUser(r.Context(), creds.Email, string(hashedPassword), creds.FirstName, creds.Username, creds.Subscribe, creds.CreatedAt)
 	if err != nil {
 		log.Printf("❗ Error creating user in database: %v", err)
-		http.Error(w, "Error creating user", http.StatusInternalServerError)
+		serverError(w, err, "Error creating user")
 		return
 	}
 
-	// Generate JWT
-	token, err := utils.GenerateJWT(creds.Email)
+	user := &models.User{ID: userID, Email: creds.Email, FirstName: creds.FirstName, Roles: []string{models.RoleUser}}
+
+	// Send a verification email; the account works without it, subject to the verification policy
+	if err := s.sendVerificationEmail(r.Context(), user); err != nil {
+		log.Printf("❗ Error sending verification email to %s: %v", creds.Email, err)
+	}
+
+	// Start a session and generate its tokens
+	tokens, err := s.issueTokens(r, user)
 	if err != nil {
 		log.Printf("❗ Error generating JWT token: %v", err)
-		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		serverError(w, err, "Error generating token")
 		return
 	}
 
-	// Respond with the JWT token
+	event := userTarget(models.AuditRegister, userID, models.OutcomeSuccess)
+	event.ActorID = userID
+	s.recordAudit(r, event)
+
+	// Respond with the tokens
 	log.Printf("✅ User %s created successfully", creds.Email)
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
+	json.NewEncoder(w).Encode(tokens)
 	log.Println("🚀 Registration complete, token sent to user")
 }
 
@@ -114,10 +134,12 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 //
 // The function performs the following steps:
 //   - Parse and validate the incoming request body (expects JSON).
+//   - Refuse the attempt if the account or client is locked out after repeated failures.
 //   - Check if the user exists in the database.
 //   - Compare the provided password with the stored hashed password.
-//   - Generate a JWT token upon successful authentication.
-//   - Return the token as a JSON response or an error message if authentication fails.
+//   - If two-factor authentication is enabled, return an MFA challenge to complete at /login/mfa.
+//   - Otherwise start a session and generate its access and refresh tokens.
+//   - Return the tokens as a JSON response or an error message if authentication fails.
 //
 // Request body (JSON):
 //
@@ -127,9 +149,11 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 //	}
 //
 // Response (JSON):
-//   - On success: {"token": "generated-jwt-token"}
+//   - On success: {"token": "generated-jwt-token", "refresh_token": "opaque-refresh-token", "expires_in": 900}
+//   - With two-factor authentication: {"mfa_required": true, "mfa_token": "short-lived-token", "expires_in": 300}
+//   - While locked out: HTTP 429 with a Retry-After header.
 //   - On error: HTTP status code with an appropriate error message.
-func LoginUser(w http.ResponseWriter, r *http.Request) {
+func (s *Server) LoginUser(w http.ResponseWriter, r *http.Request) {
 	log.Println("🔑 Login attempt received")
 
 	var creds Credentials
@@ -144,10 +168,25 @@ func LoginUser(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("🔍 Authenticating user with email: %s", creds.Email)
 
+	// Refuse attempts while the account or client is backing off after failed attempts
+	throttle := s.newLoginThrottle(r, creds.Email)
+	if wait := throttle.retryAfter(); wait > 0 {
+		log.Printf("⛔ Login throttled for email: %s", creds.Email)
+		event := userTarget(models.AuditLogin, "", models.OutcomeDenied)
+		event.Details = map[string]interface{}{"email": creds.Email, "reason": "throttled"}
+		s.recordAudit(r, event)
+		writeLoginThrottled(w, wait)
+		return
+	}
+
 	// Get user from the database
-	user, err := models.GetUserByEmail(creds.Email)
+	user, err := s.Users.GetUserByEmail(r.Context(), creds.Email)
 	if err != nil {
 		log.Printf("⚠️ User not found or invalid credentials for email: %s", creds.Email)
+		throttle.fail("")
+		event := userTarget(models.AuditLogin, "", models.OutcomeFailure)
+		event.Details = map[string]interface{}{"email": creds.Email, "reason": "unknown account"}
+		s.recordAudit(r, event)
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
@@ -156,56 +195,74 @@ func LoginUser(w http.ResponseWriter, r *http.Request) {
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(creds.Password))
 	if err != nil {
 		log.Printf("❌ Invalid password for user: %s", creds.Email)
+		throttle.fail(user.ID)
+		s.recordAudit(r, userTarget(models.AuditLogin, user.ID, models.OutcomeFailure))
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
 	log.Printf("✅ User authenticated successfully: %s", creds.Email)
 
-	// Generate JWT token
-	token, err := utils.GenerateJWT(user.Email)
+	// Accounts with two-factor authentication get a challenge instead of tokens
+	if user.MFAEnabled {
+		challenge, err := s.newMFAChallenge(user)
+		if err != nil {
+			log.Printf("❗ Error generating MFA token for user: %s, error: %v", creds.Email, err)
+			serverError(w, err, "Error generating token")
+			return
+		}
+		json.NewEncoder(w).Encode(challenge)
+		log.Println("🔐 Password accepted, second factor required")
+		return
+	}
+
+	throttle.succeed()
+
+	// Start a session and generate its tokens
+	tokens, err := s.issueTokens(r, user)
 	if err != nil {
 		log.Printf("❗ Error generating JWT token for user: %s, error: %v", creds.Email, err)
-		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		serverError(w, err, "Error generating token")
 		return
 	}
 
 	// Log successful login and token generation
+	event := userTarget(models.AuditLogin, user.ID, models.OutcomeSuccess)
+	event.ActorID = user.ID
+	s.recordAudit(r, event)
 	log.Printf("🔐 JWT token generated successfully for user: %s", creds.Email)
 
-	// Return the JWT token
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
+	// Return the tokens
+	json.NewEncoder(w).Encode(tokens)
 	log.Println("🚀 Login complete, token sent to user")
 }
 
 // CreateAquariumHandler handles the creation of a new aquarium.
-func CreateAquariumHandler(w http.ResponseWriter, r *http.Request) {
+// Its species, plants and equipment must be in the catalog; unknown IDs are rejected
+// with 422 Unprocessable Entity.
+func (s *Server) CreateAquariumHandler(w http.ResponseWriter, r *http.Request) {
 	// Only allow POST method
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Extract user information from the JWT token
-	userEmail, err := utils.ExtractEmailFromJWT(r.Header.Get("Authorization"))
-	if err != nil {
-		log.Printf("Error extracting user from token: %v", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	// Get the authenticated user from the request context
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
 		return
 	}
 
-	// Get user by email
-	user, err := models.GetUserByEmail(userEmail)
-	if err != nil {
-		log.Printf("Error retrieving user: %v", err)
-		http.Error(w, "User not found", http.StatusNotFound)
+	// Tokens limited to one aquarium cannot create others
+	if principal.AquariumID != "" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
 
 	var aquarium models.Aquarium
 
 	// Parse JSON request body
-	err = json.NewDecoder(r.Body).Decode(&aquarium)
+	err := json.NewDecoder(r.Body).Decode(&aquarium)
 	if err != nil {
 		log.Printf("Error decoding request body: %v", err)
 		http.Error(w, "Invalid input", http.StatusBadRequest)
@@ -213,189 +270,235 @@ func CreateAquariumHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Set the UserID to the authenticated user's ID
-	aquarium.UserID = user.ID
+	aquarium.UserID = principal.UserID
 
 	// Save the aquarium to the database
-	err = models.CreateAquarium(&aquarium)
+	err = s.Aquariums.CreateAquarium(r.Context(), &aquarium, s.actorFromRequest(r, principal))
+	var unknown *models.UnknownCatalogError
+	if errors.As(err, &unknown) {
+		http.Error(w, unknown.Error(), http.StatusUnprocessableEntity)
+		return
+	}
 	if err != nil {
 		log.Printf("Error creating aquarium in database: %v", err)
-		http.Error(w, "Error creating aquarium", http.StatusInternalServerError)
+		serverError(w, err, "Error creating aquarium")
 		return
 	}
 
+	s.recordAudit(r, targetEvent(models.AuditAquariumCreate, "aquarium", aquarium.ID, models.OutcomeSuccess))
+
 	// Respond with the created aquarium object
+	w.Header().Set("ETag", aquariumETag(aquarium.Version))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(aquarium)
 }
 
 // GetUserAquariumsHandler retrieves all aquariums for the authenticated user.
-func GetUserAquariumsHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract user information from the JWT token
-	userEmail, err := utils.ExtractEmailFromJWT(r.Header.Get("Authorization"))
-	if err != nil {
-		log.Printf("Error extracting user from token: %v", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	// Get user by email
-	user, err := models.GetUserByEmail(userEmail)
-	if err != nil {
-		log.Printf("Error retrieving user: %v", err)
-		http.Error(w, "User not found", http.StatusNotFound)
-		return
+//
+// Method: GET
+// Endpoint: /user/aquariums
+//
+// Query parameters (optional):
+//   - include: comma-separated sections to add to each aquarium, which may be repeated.
+//     "parameters" adds the most recent parameter entries, up to
+//     Server.AquariumListParameterLimit per aquarium; the full history is served by
+//     /aquariums/{aquariumId}/parameter-entries.
+func (s *Server) GetUserAquariumsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user from the request context
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	// Choose the optional sections to load
+	options := models.AquariumListOptions{ParameterLimit: s.AquariumListParameterLimit}
+	for _, value := range r.URL.Query()["include"] {
+		for _, section := range strings.Split(value, ",") {
+			switch section = strings.TrimSpace(section); section {
+			case "parameters":
+				options.IncludeParameters = true
+			case "":
+			default:
+				http.Error(w, "Unknown include section: "+section, http.StatusBadRequest)
+				return
+			}
+		}
 	}
 
 	// Get aquariums for the user
-	aquariums, err := models.GetAquariumsByUserID(user.ID)
+	aquariums, err := s.Aquariums.GetAquariumsByUserID(r.Context(), principal.UserID, options)
 	if err != nil {
 		log.Printf("Error retrieving aquariums: %v", err)
-		http.Error(w, "Error retrieving aquariums", http.StatusInternalServerError)
+		serverError(w, err, "Error retrieving aquariums")
 		return
 	}
 
+	// Tokens limited to one aquarium only see that aquarium
+	if principal.AquariumID != "" {
+		visible := aquariums[:0]
+		for _, aquarium := range aquariums {
+			if principal.CanAccessAquarium(aquarium.ID) {
+				visible = append(visible, aquarium)
+			}
+		}
+		aquariums = visible
+	}
+
 	// Respond with the user's aquariums
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(aquariums)
 }
 
 // GetAquariumHandler handles the retrieval of a single aquarium by ID.
-func GetAquariumHandler(w http.ResponseWriter, r *http.Request) {
+// The ETag header carries the version of the aquarium, to send back in If-Match when
+// updating it.
+func (s *Server) GetAquariumHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	// Extract user information from the JWT token
-	userEmail, err := utils.ExtractEmailFromJWT(r.Header.Get("Authorization"))
-	if err != nil {
-		log.Printf("Error extracting user from token: %v", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	// Get the authenticated user from the request context
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
 		return
 	}
 
-	// Get user by email
-	user, err := models.GetUserByEmail(userEmail)
-	if err != nil {
-		log.Printf("Error retrieving user: %v", err)
-		http.Error(w, "User not found", http.StatusNotFound)
+	// Check if the aquarium is shared with the user
+	role, ok := s.authorizeAquarium(w, r, principal, id, models.AquariumRoleViewer)
+	if !ok {
 		return
 	}
 
-	aquarium, err := models.GetAquariumByID(id)
+	aquarium, err := s.Aquariums.GetAquariumByID(r.Context(), id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Aquarium not found", http.StatusNotFound)
 		} else {
 			log.Printf("Error retrieving aquarium: %v", err)
-			http.Error(w, "Error retrieving aquarium", http.StatusInternalServerError)
+			serverError(w, err, "Error retrieving aquarium")
 		}
 		return
 	}
-
-	// Check if the aquarium belongs to the user
-	if aquarium.UserID != user.ID {
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		return
-	}
+	aquarium.Role = role
 
 	// Respond with the aquarium data
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", aquariumETag(aquarium.Version))
 	json.NewEncoder(w).Encode(aquarium)
 }
 
 // UpdateAquariumHandler handles the update of an existing aquarium.
-func UpdateAquariumHandler(w http.ResponseWriter, r *http.Request) {
+// As on creation, unknown species, plant and equipment IDs are rejected with 422.
+//
+// Method: PUT
+// Endpoint: /aquariums/{id}
+//
+// Headers:
+//   - If-Match: the ETag of the aquarium the update is based on (required). If the
+//     aquarium was changed since, the update is refused with 412 Precondition Failed
+//     and the current aquarium.
+func (s *Server) UpdateAquariumHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	// Extract user information from the JWT token
-	userEmail, err := utils.ExtractEmailFromJWT(r.Header.Get("Authorization"))
-	if err != nil {
-		log.Printf("Error extracting user from token: %v", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	// Get the authenticated user from the request context
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
 		return
 	}
 
-	// Get user by email
-	user, err := models.GetUserByEmail(userEmail)
-	if err != nil {
-		log.Printf("Error retrieving user: %v", err)
-		http.Error(w, "User not found", http.StatusNotFound)
+	// Viewers cannot change the aquarium
+	role, ok := s.authorizeAquarium(w, r, principal, id, models.AquariumRoleEditor)
+	if !ok {
+		return
+	}
+
+	version, ok := s.ifMatchVersion(w, r, id)
+	if !ok {
 		return
 	}
 
 	var aquarium models.Aquarium
 
 	// Parse JSON request body
-	err = json.NewDecoder(r.Body).Decode(&aquarium)
+	err := json.NewDecoder(r.Body).Decode(&aquarium)
 	if err != nil {
 		log.Printf("Error decoding request body: %v", err)
 		http.Error(w, "Invalid input", http.StatusBadRequest)
 		return
 	}
 
-	// Set the ID from the URL path and the UserID from the authenticated user
+	// Set the ID from the URL path; the owner is kept as it is
 	aquarium.ID = id
-	aquarium.UserID = user.ID
+	aquarium.Version = version
 
 	// Update the aquarium in the database
-	err = models.UpdateAquarium(&aquarium)
+	err = s.Aquariums.UpdateAquarium(r.Context(), &aquarium, s.actorFromRequest(r, principal))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Aquarium not found or not owned by user", http.StatusNotFound)
-		} else {
-			log.Printf("Error updating aquarium: %v", err)
-			http.Error(w, "Error updating aquarium", http.StatusInternalServerError)
-		}
+		s.writeAquariumUpdateError(w, r, err, id, role)
 		return
 	}
 
-	// Log the updated aquarium object
-	log.Printf("Updated aquarium: %+v", aquarium)
+	log.Printf("User %s updated aquarium %s", principal.UserID, aquarium.ID)
+	s.recordAudit(r, targetEvent(models.AuditAquariumUpdate, "aquarium", aquarium.ID, models.OutcomeSuccess))
 
 	// Respond with the updated aquarium object
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", aquariumETag(aquarium.Version))
 	json.NewEncoder(w).Encode(aquarium)
 }
 
+// writeAquariumUpdateError responds to a request whose change of an aquarium failed.
+func (s *Server) writeAquariumUpdateError(w http.ResponseWriter, r *http.Request, err error, id string, role string) {
+	var unknown *models.UnknownCatalogError
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Aquarium not found", http.StatusNotFound)
+	case errors.Is(err, models.ErrVersionConflict):
+		s.writeAquariumConflict(w, r, id, role)
+	case errors.As(err, &unknown):
+		http.Error(w, unknown.Error(), http.StatusUnprocessableEntity)
+	default:
+		log.Printf("Error updating aquarium: %v", err)
+		serverError(w, err, "Error updating aquarium")
+	}
+}
+
 // DeleteAquariumHandler handles the deletion of an aquarium.
-func DeleteAquariumHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) DeleteAquariumHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	// Extract user information from the JWT token
-	userEmail, err := utils.ExtractEmailFromJWT(r.Header.Get("Authorization"))
-	if err != nil {
-		log.Printf("Error extracting user from token: %v", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	// Get the authenticated user from the request context
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
 		return
 	}
 
-	// Get user by email
-	user, err := models.GetUserByEmail(userEmail)
-	if err != nil {
-		log.Printf("Error retrieving user: %v", err)
-		http.Error(w, "User not found", http.StatusNotFound)
+	// Only owners may delete the aquarium
+	if _, ok := s.authorizeAquarium(w, r, principal, id, models.AquariumRoleOwner); !ok {
 		return
 	}
 
 	// Attempt to delete the aquarium
-	err = models.DeleteAquarium(id, user.ID)
+	err := s.Aquariums.DeleteAquarium(r.Context(), id)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			http.Error(w, "Aquarium not found or not owned by user", http.StatusNotFound)
+			http.Error(w, "Aquarium not found", http.StatusNotFound)
 		} else {
 			log.Printf("Error deleting aquarium: %v", err)
-			http.Error(w, "Error deleting aquarium", http.StatusInternalServerError)
+			serverError(w, err, "Error deleting aquarium")
 		}
 		return
 	}
 
+	s.recordAudit(r, targetEvent(models.AuditAquariumDelete, "aquarium", id, models.OutcomeSuccess))
+
 	// Respond with no content status
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // GetDetailHandler handles the retrieval of species, plant, or equipment details by ID.
-func GetDetailHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetDetailHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract the ID from the URL path
 	vars := mux.Vars(r)
 	id := vars["id"]
@@ -410,13 +513,13 @@ func GetDetailHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract the detail type from the header
 	log.Printf("Requesting detail for ID: %s and type: %s", id, detailType)
 
-	result, err := models.GetDetailByID(id, detailType)
+	result, err := s.Catalog.GetDetailByID(r.Context(), id, detailType)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			http.Error(w, "Not found", http.StatusNotFound)
 		} else {
 			log.Printf("Error retrieving detail: %v", err)
-			http.Error(w, "Error retrieving detail", http.StatusInternalServerError)
+			serverError(w, err, "Error retrieving detail")
 		}
 		return
 	}
@@ -427,14 +530,14 @@ func GetDetailHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetAllDetailsHandler retrieves all records of the specified type.
-func GetAllDetailsHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetAllDetailsHandler(w http.ResponseWriter, r *http.Request) {
 	detailType := mux.Vars(r)["type"]
 	log.Printf("Requesting all details of type: %s", detailType)
 
-	result, err := models.GetAllDetails(detailType)
+	result, err := s.Catalog.GetAllDetails(r.Context(), detailType)
 	if err != nil {
 		log.Printf("Error retrieving details: %v", err)
-		http.Error(w, "Error retrieving details", http.StatusInternalServerError)
+		serverError(w, err, "Error retrieving details")
 		return
 	}
 
@@ -443,39 +546,25 @@ func GetAllDetailsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // CreateParameterEntryHandler handles the creation of a new parameter entry.
-func CreateParameterEntryHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) CreateParameterEntryHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	aquariumID := vars["aquariumId"]
 
-	// Extract user information from the JWT token
-	userEmail, err := utils.ExtractEmailFromJWT(r.Header.Get("Authorization"))
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	// Get the authenticated user from the request context
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
 		return
 	}
 
-	// Get user by email
-	user, err := models.GetUserByEmail(userEmail)
-	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
-		return
-	}
-
-	// Verify that the aquarium belongs to the user
-	aquarium, err := models.GetAquariumByID(aquariumID)
-	if err != nil {
-		http.Error(w, "Aquarium not found", http.StatusNotFound)
-		return
-	}
-	if aquarium.UserID != user.ID {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	// Verify that the user may record entries for the aquarium
+	if _, ok := s.authorizeAquarium(w, r, principal, aquariumID, models.AquariumRoleEditor); !ok {
 		return
 	}
 
 	var entry models.WaterParameterEntry
 
 	// Parse JSON request body
-	err = json.NewDecoder(r.Body).Decode(&entry)
+	err := json.NewDecoder(r.Body).Decode(&entry)
 	if err != nil {
 		http.Error(w, "Invalid input", http.StatusBadRequest)
 		return
@@ -488,50 +577,38 @@ func CreateParameterEntryHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create the parameter entry in the database
-	err = models.CreateWaterParameterEntry(&entry)
+	err = s.Parameters.CreateWaterParameterEntry(r.Context(), &entry)
 	if err != nil {
-		http.Error(w, "Error creating parameter entry", http.StatusInternalServerError)
+		serverError(w, err, "Error creating parameter entry")
 		return
 	}
 
+	s.recordAudit(r, targetEvent(models.AuditParametersCreate, "aquarium", aquariumID, models.OutcomeSuccess))
+
 	// Respond with the created parameter entry
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(entry)
 }
 
-func GetParameterEntriesHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetParameterEntriesHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	aquariumID := vars["aquariumId"]
 
-	// Extract user information from the JWT token
-	userEmail, err := utils.ExtractEmailFromJWT(r.Header.Get("Authorization"))
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	// Get the authenticated user from the request context
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
 		return
 	}
 
-	// Get user by email
-	user, err := models.GetUserByEmail(userEmail)
-	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
-		return
-	}
-
-	// Verify that the aquarium belongs to the user
-	aquarium, err := models.GetAquariumByID(aquariumID)
-	if err != nil {
-		http.Error(w, "Aquarium not found", http.StatusNotFound)
-		return
-	}
-	if aquarium.UserID != user.ID {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	// Verify that the aquarium is shared with the user
+	if _, ok := s.authorizeAquarium(w, r, principal, aquariumID, models.AquariumRoleViewer); !ok {
 		return
 	}
 
 	// Retrieve parameter entries from the database
-	entries, err := models.GetWaterParameterEntriesByAquariumID(aquariumID)
+	entries, err := s.Parameters.GetWaterParameterEntriesByAquariumID(r.Context(), aquariumID)
 	if err != nil {
-		http.Error(w, "Error retrieving parameter entries", http.StatusInternalServerError)
+		serverError(w, err, "Error retrieving parameter entries")
 		return
 	}
 
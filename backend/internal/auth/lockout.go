@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+)
+
+// loginFailureWindow is how long a throttle key remembers failed attempts after the last one.
+const loginFailureWindow = time.Hour
+
+// loginLimit describes how failed logins are throttled for one kind of throttle key.
+// After Free consecutive failures every further failure blocks the key for an
+// exponentially growing delay, starting at BackoffBase and capped at BackoffMax.
+// Reaching LockoutAt failures locks the key for LockoutFor and records an audit event.
+type loginLimit struct {
+	Prefix      string
+	Free        int
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	LockoutAt   int
+	LockoutFor  time.Duration
+	Action      string
+}
+
+var (
+	// accountLoginLimit throttles guesses against a single account, whatever their origin.
+	accountLoginLimit = loginLimit{
+		Prefix:      "account:",
+		Free:        3,
+		BackoffBase: time.Second,
+		BackoffMax:  15 * time.Minute,
+		LockoutAt:   10,
+		LockoutFor:  30 * time.Minute,
+		Action:      models.AuditLoginLocked,
+	}
+
+	// ipLoginLimit throttles a single client guessing across many accounts.
+	ipLoginLimit = loginLimit{
+		Prefix:      "ip:",
+		Free:        20,
+		BackoffBase: time.Second,
+		BackoffMax:  15 * time.Minute,
+		LockoutAt:   100,
+		LockoutFor:  time.Hour,
+		Action:      models.AuditIPBlocked,
+	}
+)
+
+// key returns the throttle key for an account email or IP address.
+func (l loginLimit) key(value string) string {
+	return l.Prefix + strings.ToLower(strings.TrimSpace(value))
+}
+
+// delay returns how long the key is blocked after the given number of consecutive failures.
+func (l loginLimit) delay(failures int) time.Duration {
+	if failures >= l.LockoutAt {
+		return l.LockoutFor
+	}
+	if failures <= l.Free {
+		return 0
+	}
+	delay := l.BackoffBase
+	for i := l.Free + 1; i < failures && delay < l.BackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > l.BackoffMax {
+		delay = l.BackoffMax
+	}
+	return delay
+}
+
+// loginThrottle identifies the account and client of a login attempt.
+type loginThrottle struct {
+	s     *Server
+	r     *http.Request
+	email string
+	ip    string
+}
+
+// newLoginThrottle returns the throttle for a login attempt on the given account.
+func (s *Server) newLoginThrottle(r *http.Request, email string) loginThrottle {
+	return loginThrottle{s: s, r: r, email: email, ip: s.ClientIP(r)}
+}
+
+// retryAfter returns how long until the account and the client may attempt to log in again,
+// or 0 if neither is blocked. Lookup errors are logged and do not block the login.
+func (t loginThrottle) retryAfter() time.Duration {
+	var wait time.Duration
+	for _, key := range []string{accountLoginLimit.key(t.email), ipLoginLimit.key(t.ip)} {
+		lockedUntil, err := t.s.Sessions.GetLoginLockout(t.r.Context(), key)
+		if err != nil {
+			log.Printf("Error checking login lockout for %s: %v", key, err)
+			continue
+		}
+		if remaining := time.Until(lockedUntil); remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait
+}
+
+// fail records a failed attempt against the account and the client and applies any backoff
+// or lockout. userID may be "" if the account does not exist.
+func (t loginThrottle) fail(userID string) {
+	t.failKey(accountLoginLimit, t.email, userID)
+	t.failKey(ipLoginLimit, t.ip, "")
+}
+
+// failKey records a failed attempt against a single throttle key. The attempt is counted
+// even if the client disconnects first, so abandoning requests cannot evade the limit.
+func (t loginThrottle) failKey(limit loginLimit, value string, userID string) {
+	key := limit.key(value)
+	ctx := context.WithoutCancel(t.r.Context())
+	failures, err := t.s.Sessions.RecordLoginFailure(ctx, key, loginFailureWindow)
+	if err != nil {
+		log.Printf("Error recording login failure for %s: %v", key, err)
+		return
+	}
+
+	delay := limit.delay(failures)
+	if delay == 0 {
+		return
+	}
+	if err := t.s.Sessions.SetLoginLockout(ctx, key, time.Now().Add(delay)); err != nil {
+		log.Printf("Error locking out %s: %v", key, err)
+	}
+
+	if failures == limit.LockoutAt {
+		log.Printf("Login lockout triggered for %s after %d failures", key, failures)
+		event := userTarget(limit.Action, userID, models.OutcomeDenied)
+		if limit.Prefix == ipLoginLimit.Prefix {
+			event.TargetType = "ip"
+			event.TargetID = t.ip
+		}
+		event.Details = map[string]interface{}{
+			"key":             key,
+			"failures":        failures,
+			"lockout_seconds": int64(delay.Seconds()),
+		}
+		t.s.recordAudit(t.r, event)
+	}
+}
+
+// succeed forgets the failed attempts of the account. Failures of the client are kept so
+// that logging into an account of one's own does not reset guessing against others.
+func (t loginThrottle) succeed() {
+	key := accountLoginLimit.key(t.email)
+	if err := t.s.Sessions.ClearLoginFailures(t.r.Context(), key); err != nil {
+		log.Printf("Error clearing login failures for %s: %v", key, err)
+	}
+}
+
+// writeLoginThrottled rejects a login attempt that arrived while blocked.
+func writeLoginThrottled(w http.ResponseWriter, wait time.Duration) {
+	seconds := int64(wait/time.Second) + 1
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+}
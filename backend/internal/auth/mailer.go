@@ -0,0 +1,14 @@
+package auth
+
+import (
+	"net/url"
+	"os"
+	"strings"
+)
+
+// appLink builds a link to a frontend page from APP_BASE_URL, adding the given token
+// as a query parameter.
+func appLink(path string, token string) string {
+	base := strings.TrimSuffix(os.Getenv("APP_BASE_URL"), "/")
+	return base + path + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,407 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+	utils "github.com/stevenpstansberry/AquaMind-AI/internal/util"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	mfaPendingTTL     = 5 * time.Minute // Time allowed between the password and the second factor
+	totpIssuer        = "AquaMind"      // Issuer shown in authenticator apps
+	recoveryCodeCount = 10              // Recovery codes issued per enrollment
+)
+
+// MFAChallenge is returned by LoginUser instead of a TokenPair when the account has
+// two-factor authentication enabled.
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfa_required"` // Always true
+	MFAToken    string `json:"mfa_token"`    // Short-lived token to present to /login/mfa
+	ExpiresIn   int64  `json:"expires_in"`   // MFA token lifetime in seconds
+}
+
+// secondFactor is a TOTP code or a recovery code submitted by a user.
+type secondFactor struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// newMFAChallenge mints an MFA pending token for a user whose password was accepted.
+func (s *Server) newMFAChallenge(user *models.User) (*MFAChallenge, error) {
+	token, err := s.Keys.GeneratePurposeToken(utils.PurposeMFAPending, user.ID, "", mfaPendingTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &MFAChallenge{MFARequired: true, MFAToken: token, ExpiresIn: int64(mfaPendingTTL.Seconds())}, nil
+}
+
+// verifySecondFactor checks a TOTP code or consumes a recovery code of the user.
+// A TOTP code is only accepted once, so an intercepted code cannot be replayed.
+func (s *Server) verifySecondFactor(ctx context.Context, userID string, factor secondFactor) (bool, error) {
+	if factor.Code != "" {
+		state, err := s.Users.GetTOTPState(ctx, userID)
+		if err != nil {
+			return false, err
+		}
+		if !state.Enabled {
+			return false, nil
+		}
+		step, ok := utils.ValidateTOTP(state.Secret, factor.Code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return s.Users.RecordTOTPStep(ctx, userID, step)
+	}
+
+	if factor.RecoveryCode != "" {
+		used, err := s.Users.UseRecoveryCode(ctx, userID, utils.HashToken(utils.NormalizeRecoveryCode(factor.RecoveryCode)))
+		if err != nil || !used {
+			return false, err
+		}
+		log.Printf("Recovery code used by user %s", userID)
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// newRecoveryCodes generates a fresh set of recovery codes together with their hashes.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashToken(utils.NormalizeRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// LoginMFAHandler completes a login for an account with two-factor authentication by
+// exchanging the MFA pending token from LoginUser and a second factor for a token pair.
+//
+// Method: POST
+// Endpoint: /login/mfa
+//
+// Request body (JSON):
+//
+//	{
+//	  "mfa_token": "token-from-login",
+//	  "code": "123456"
+//	}
+//
+// A one-time "recovery_code" may be sent instead of "code".
+//
+// Response (JSON):
+//   - On success: {"token": "...", "refresh_token": "...", "expires_in": 900}
+//   - On error: HTTP status code with an appropriate error message.
+func (s *Server) LoginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MFAToken string `json:"mfa_token"`
+		secondFactor
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := s.Keys.ValidatePurposeToken(req.MFAToken, utils.PurposeMFAPending)
+	if err != nil {
+		http.Error(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.Users.GetUserByID(r.Context(), claims.Subject)
+	if err != nil {
+		log.Printf("Error retrieving user %s: %v", claims.Subject, err)
+		http.Error(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+		return
+	}
+
+	// Wrong codes count against the same lockout as wrong passwords
+	throttle := s.newLoginThrottle(r, user.Email)
+	if wait := throttle.retryAfter(); wait > 0 {
+		writeLoginThrottled(w, wait)
+		return
+	}
+
+	ok, err := s.verifySecondFactor(r.Context(), user.ID, req.secondFactor)
+	if err != nil {
+		log.Printf("Error verifying second factor for user %s: %v", user.ID, err)
+		serverError(w, err, "Error verifying code")
+		return
+	}
+	if !ok {
+		throttle.fail(user.ID)
+		s.recordAudit(r, userTarget(models.AuditLoginMFA, user.ID, models.OutcomeFailure))
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+	throttle.succeed()
+
+	event := userTarget(models.AuditLoginMFA, user.ID, models.OutcomeSuccess)
+	event.ActorID = user.ID
+	event.Details = map[string]interface{}{"recovery_code": req.RecoveryCode != ""}
+	s.recordAudit(r, event)
+
+	tokens, err := s.issueTokens(r, user)
+	if err != nil {
+		log.Printf("Error issuing tokens for user %s: %v", user.ID, err)
+		serverError(w, err, "Error generating token")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// EnrollTOTPHandler starts TOTP enrollment by generating a new secret. The secret is not
+// enforced until it is confirmed with ConfirmTOTPHandler; enrolling again before that
+// replaces it.
+//
+// Method: POST
+// Endpoint: /user/mfa/totp/enroll
+//
+// Response (JSON):
+//   - On success: {"secret": "BASE32SECRET", "provisioning_uri": "otpauth://totp/..."}
+//   - On error: HTTP status code with an appropriate error message.
+func (s *Server) EnrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("Error generating TOTP secret: %v", err)
+		serverError(w, err, "Error starting enrollment")
+		return
+	}
+
+	err = s.Users.SetPendingTOTPSecret(r.Context(), principal.UserID, secret)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		} else {
+			log.Printf("Error storing TOTP secret for user %s: %v", principal.UserID, err)
+			serverError(w, err, "Error starting enrollment")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":           secret,
+		"provisioning_uri": utils.TOTPProvisioningURI(secret, principal.Email, totpIssuer),
+	})
+}
+
+// ConfirmTOTPHandler enables TOTP once the user proves their authenticator app produces
+// valid codes, and returns the recovery codes. The recovery codes are shown only once.
+//
+// Method: POST
+// Endpoint: /user/mfa/totp/confirm
+//
+// Request body (JSON):
+//
+//	{
+//	  "code": "123456"
+//	}
+//
+// Response (JSON):
+//   - On success: {"recovery_codes": ["abcde-fghjk", ...]}
+//   - On error: HTTP status code with an appropriate error message.
+func (s *Server) ConfirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	state, err := s.Users.GetTOTPState(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("Error retrieving TOTP state for user %s: %v", principal.UserID, err)
+		serverError(w, err, "Error confirming enrollment")
+		return
+	}
+	if state.Enabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if state.Secret == "" {
+		http.Error(w, "No enrollment in progress", http.StatusBadRequest)
+		return
+	}
+
+	step, valid := utils.ValidateTOTP(state.Secret, req.Code, time.Now())
+	if !valid {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		serverError(w, err, "Error confirming enrollment")
+		return
+	}
+
+	err = s.Users.EnableTOTP(r.Context(), principal.UserID, step, hashes)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "No enrollment in progress", http.StatusConflict)
+		} else {
+			log.Printf("Error enabling TOTP for user %s: %v", principal.UserID, err)
+			serverError(w, err, "Error confirming enrollment")
+		}
+		return
+	}
+
+	log.Printf("Two-factor authentication enabled for user %s", principal.UserID)
+	s.recordAudit(r, userTarget(models.AuditMFAEnabled, principal.UserID, models.OutcomeSuccess))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"recovery_codes": codes})
+}
+
+// DisableTOTPHandler turns off two-factor authentication. Both the password and a current
+// code or recovery code are required, so a stolen access token alone cannot disable it.
+//
+// Method: DELETE
+// Endpoint: /user/mfa/totp
+//
+// Request body (JSON):
+//
+//	{
+//	  "password": "current-password",
+//	  "code": "123456"
+//	}
+func (s *Server) DisableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+		secondFactor
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.Users.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("Error retrieving user %s: %v", principal.UserID, err)
+		serverError(w, err, "Error retrieving user")
+		return
+	}
+	if !user.MFAEnabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		s.recordAudit(r, userTarget(models.AuditMFADisabled, principal.UserID, models.OutcomeDenied))
+		http.Error(w, "Password is incorrect", http.StatusForbidden)
+		return
+	}
+
+	valid, err := s.verifySecondFactor(r.Context(), principal.UserID, req.secondFactor)
+	if err != nil {
+		log.Printf("Error verifying second factor for user %s: %v", principal.UserID, err)
+		serverError(w, err, "Error verifying code")
+		return
+	}
+	if !valid {
+		s.recordAudit(r, userTarget(models.AuditMFADisabled, principal.UserID, models.OutcomeDenied))
+		http.Error(w, "Invalid code", http.StatusForbidden)
+		return
+	}
+
+	if err := s.Users.DisableTOTP(r.Context(), principal.UserID); err != nil {
+		log.Printf("Error disabling TOTP for user %s: %v", principal.UserID, err)
+		serverError(w, err, "Error disabling two-factor authentication")
+		return
+	}
+
+	log.Printf("Two-factor authentication disabled for user %s", principal.UserID)
+	s.recordAudit(r, userTarget(models.AuditMFADisabled, principal.UserID, models.OutcomeSuccess))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodesHandler replaces every recovery code of the user with a new set.
+// A current TOTP code is required.
+//
+// Method: POST
+// Endpoint: /user/mfa/recovery-codes
+//
+// Request body (JSON):
+//
+//	{
+//	  "code": "123456"
+//	}
+//
+// Response (JSON):
+//   - On success: {"recovery_codes": ["abcde-fghjk", ...]}
+//   - On error: HTTP status code with an appropriate error message.
+func (s *Server) RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	valid, err := s.verifySecondFactor(r.Context(), principal.UserID, secondFactor{Code: req.Code})
+	if err != nil {
+		log.Printf("Error verifying second factor for user %s: %v", principal.UserID, err)
+		serverError(w, err, "Error verifying code")
+		return
+	}
+	if !valid {
+		http.Error(w, "Invalid code", http.StatusForbidden)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		serverError(w, err, "Error generating recovery codes")
+		return
+	}
+
+	if err := s.Users.ReplaceRecoveryCodes(r.Context(), principal.UserID, hashes); err != nil {
+		log.Printf("Error replacing recovery codes for user %s: %v", principal.UserID, err)
+		serverError(w, err, "Error generating recovery codes")
+		return
+	}
+
+	s.recordAudit(r, userTarget(models.AuditRecoveryCodesReset, principal.UserID, models.OutcomeSuccess))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"recovery_codes": codes})
+}
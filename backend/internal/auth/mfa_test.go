@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+	utils "github.com/stevenpstansberry/AquaMind-AI/internal/util"
+)
+
+// A TOTP code is accepted once; neither it nor a code for an earlier step is accepted
+// again, even within the tolerated clock drift.
+func TestVerifySecondFactorRejectsReplayedCodes(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := models.NewMemoryStore()
+	server := NewServer(store, nil)
+
+	userID, err := store.CreateUser(ctx, "ada@example.com", "hash", "Ada", "ada", "false", time.Now().Format(time.RFC3339))
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	if err := store.SetPendingTOTPSecret(ctx, userID, secret); err != nil {
+		t.Fatalf("SetPendingTOTPSecret: %v", err)
+	}
+	if err := store.EnableTOTP(ctx, userID, utils.TOTPStep(time.Now())-10, nil); err != nil {
+		t.Fatalf("EnableTOTP: %v", err)
+	}
+
+	now := time.Now()
+	previous, err := utils.TOTPCode(secret, now.Add(-utils.TOTPPeriod*time.Second))
+	if err != nil {
+		t.Fatalf("TOTPCode: %v", err)
+	}
+	current, err := utils.TOTPCode(secret, now)
+	if err != nil {
+		t.Fatalf("TOTPCode: %v", err)
+	}
+
+	for _, attempt := range []struct {
+		code string
+		want bool
+	}{
+		{current, true},
+		{current, false},
+		{previous, false},
+	} {
+		ok, err := server.verifySecondFactor(ctx, userID, secondFactor{Code: attempt.code})
+		if err != nil {
+			t.Fatalf("verifySecondFactor: %v", err)
+		}
+		if ok != attempt.want {
+			t.Errorf("verifySecondFactor(%s) = %v, want %v", attempt.code, ok, attempt.want)
+		}
+	}
+}
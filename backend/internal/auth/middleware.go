@@ -3,15 +3,150 @@ package auth
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/netip"
 	"strings"
 	"time"
 
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
 	utils "github.com/stevenpstansberry/AquaMind-AI/internal/util"
 )
 
+// ParseTrustedProxies parses the proxies whose X-Forwarded-For and X-Real-IP headers
+// ClientIP believes, for Server.TrustedProxies.
+//
+// Params:
+//   - proxies: IP addresses or CIDR networks, such as "10.0.0.0/8"
+//
+// Returns:
+//   - []netip.Prefix: the networks of the proxies
+//   - error: an error if an entry is neither an IP address nor a network
+func ParseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, proxy := range proxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// isTrustedProxy reports whether addr belongs to one of the trusted proxies.
+func (s *Server) isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range s.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP address of the client that sent the request. Forwarding headers
+// can be set by anyone, so they are only believed when the connection comes from a trusted
+// proxy (see Server.TrustedProxies). X-Forwarded-For is then read from the right, skipping
+// trusted proxies, and the first other address is the client; earlier entries were written
+// by the client itself. Without trusted proxies, the address of the connection is used.
+func (s *Server) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote, err := netip.ParseAddr(host)
+	if err != nil || !s.isTrustedProxy(remote) {
+		return host
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		client := remote
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				// Proxies only write addresses, so the client made this one up
+				break
+			}
+			client = hop
+			if !s.isTrustedProxy(hop) {
+				break
+			}
+		}
+		return client.Unmap().String()
+	}
+	if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return realIP.Unmap().String()
+	}
+	return host
+}
+
+// Requests to these endpoints carry passwords, one-time codes or tokens in their body,
+// which must not end up in the logs.
+var (
+	unloggedBodyPaths = map[string]bool{
+		"/register":           true,
+		"/login":              true,
+		"/login/mfa":          true,
+		"/token/refresh":      true,
+		"/logout":             true,
+		"/logout/all":         true,
+		"/password/forgot":    true,
+		"/password/reset":     true,
+		"/email/verify":       true,
+		"/oauth":              true,
+		"/user":               true,
+		"/user/password":      true,
+		"/invitations/accept": true,
+	}
+	unloggedBodyPrefixes = []string{"/oauth/", "/user/identities/", "/user/mfa/"}
+)
+
+// logsRequestBody reports whether LoggingMiddleware may log the body of requests to path.
+func logsRequestBody(path string) bool {
+	if unloggedBodyPaths[path] {
+		return false
+	}
+	for _, prefix := range unloggedBodyPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// redactAuthorization returns an Authorization header fit for the logs: its scheme and
+// just enough of the credential to tell tokens apart, such as "Bearer aqm_x7Kq… (47 chars)".
+// Personal access tokens never expire on their own, so they must not be logged whole.
+func redactAuthorization(header string) string {
+	if header == "" {
+		return "[none]"
+	}
+	scheme, credential, _ := strings.Cut(header, " ")
+	if credential == "" {
+		return scheme
+	}
+	shown := 6
+	if strings.HasPrefix(credential, utils.PersonalAccessTokenPrefix) {
+		shown = len(utils.PersonalAccessTokenPrefix) + 4
+	}
+	if len(credential) <= 2*shown {
+		return scheme + " [redacted]"
+	}
+	return fmt.Sprintf("%s %s… (%d chars)", scheme, credential[:shown], len(credential))
+}
+
 // LoggingMiddleware is an HTTP middleware that provides extensive logging for each request.
 // It logs details such as request method, URL, client IP address, user agent, and authorization status.
 //
@@ -20,7 +155,7 @@ import (
 //
 // Example:
 //
-//	http.HandleFunc("/route", middlewares.LoggingMiddleware(protectedHandler))
+//	http.HandleFunc("/route", server.LoggingMiddleware(protectedHandler))
 //
 // Params:
 //   - next: the HTTP handler to execute after logging request details.
@@ -30,16 +165,10 @@ import (
 //
 // LoggingMiddleware is an HTTP middleware that provides extensive logging for each request.
 // It logs details such as request method, URL, client IP address, user agent, and authorization status.
-func LoggingMiddleware(next http.Handler) http.Handler {
+func (s *Server) LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Get client IP address
-		clientIP := r.Header.Get("X-Forwarded-For")
-		if clientIP == "" {
-			clientIP = r.Header.Get("X-Real-IP")
-		}
-		if clientIP == "" {
-			clientIP = r.RemoteAddr
-		}
+		clientIP := s.ClientIP(r)
 
 		// Load the Pacific timezone location
 		location, err := time.LoadLocation("America/Los_Angeles")
@@ -53,10 +182,12 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 		log.Printf("Timestamp (Pacific Time): %s", time.Now().In(location).Format(time.RFC3339))
 		log.Printf("Client IP: %s", clientIP)
 		log.Printf("User-Agent: %s", r.UserAgent())
-		log.Printf("Authorization header: %s", r.Header.Get("Authorization"))
+		log.Printf("Authorization header: %s", redactAuthorization(r.Header.Get("Authorization")))
 
-		// Read and log the request body
-		if r.Body != nil {
+		// Read and log the request body, unless it carries credentials
+		if !logsRequestBody(r.URL.Path) {
+			log.Printf("Request Body: [omitted]")
+		} else if r.Body != nil {
 			bodyBytes, err := io.ReadAll(r.Body)
 			if err != nil {
 				log.Printf("Error reading request body: %v", err)
@@ -78,8 +209,10 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 }
 
 // JWTAuthMiddleware is an HTTP middleware that protects routes by verifying the presence and validity of a JWT token.
-// It expects the token in the Authorization header using the Bearer schema. If the token is valid, the request is passed
-// to the next handler; otherwise, it returns an unauthorized response.
+// It expects the token in the Authorization header using the Bearer schema. If the token is valid and its session has
+// not been revoked, the user is resolved once and stored in the request context as a Principal (see
+// PrincipalFromContext) before the request is passed to the next handler; otherwise, it returns an unauthorized response.
+// Personal access tokens (see RequireScope) are accepted in the same header.
 //
 // Usage:
 // This middleware should be used to wrap protected routes.
@@ -93,7 +226,7 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 //
 // Returns:
 //   - http.HandlerFunc: a wrapped HTTP handler that verifies JWT authentication.
-func JWTAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+func (s *Server) JWTAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		// Check if the Authorization header is present
@@ -103,21 +236,149 @@ func JWTAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		// Extract the token from the Authorization header
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		var userID, sessionID string
+		var accessToken *models.PersonalAccessToken
+
+		if token := strings.TrimPrefix(authHeader, "Bearer "); strings.HasPrefix(token, utils.PersonalAccessTokenPrefix) {
+			// Personal access tokens are opaque and looked up by their hash
+			var ok bool
+			accessToken, ok = s.authenticateAccessToken(r.Context(), w, token)
+			if !ok {
+				return
+			}
+			userID = accessToken.UserID
+		} else {
+			// Extract and validate the JWT token from the Authorization header
+			claims, err := s.Keys.ExtractClaimsFromJWT(authHeader)
+			if err != nil {
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			// Reject tokens whose session has been logged out or revoked
+			active, err := s.Sessions.IsSessionActive(r.Context(), claims.SessionID)
+			if err != nil {
+				log.Printf("Error checking session %s: %v", claims.SessionID, err)
+				serverError(w, err, "Error validating session")
+				return
+			}
+			if !active {
+				http.Error(w, "Session revoked", http.StatusUnauthorized)
+				return
+			}
+			if err := s.Sessions.TouchSession(r.Context(), claims.SessionID, s.ClientIP(r)); err != nil {
+				log.Printf("Error recording activity of session %s: %v", claims.SessionID, err)
+			}
+			userID = claims.Subject
+			sessionID = claims.SessionID
+		}
 
-		// Validate the JWT token
-		claims, err := utils.ValidateJWT(tokenString)
+		// Resolve the user the token was issued to
+		user, err := s.Users.GetUserByID(r.Context(), userID)
 		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "User not found", http.StatusUnauthorized)
+			} else {
+				log.Printf("Error retrieving user %s: %v", userID, err)
+				serverError(w, err, "Error retrieving user")
+			}
 			return
 		}
 
-		log.Printf("Authenticated user: %s", claims.Email)
+		log.Printf("Authenticated user: %s", user.ID)
 
-		// Optionally, you can pass claims in the request context here if needed
+		// Enforce the email verification policy for unverified accounts
+		if !user.Verified() && !s.VerificationPolicy.Allows(r) {
+			http.Error(w, "Email address not verified", http.StatusForbidden)
+			return
+		}
 
-		// Call the next handler if token is valid
-		next.ServeHTTP(w, r)
+		// Pass the authenticated principal to the next handler through the request context
+		principal := &Principal{
+			UserID:    user.ID,
+			Email:     user.Email,
+			Roles:     user.Roles,
+			SessionID: sessionID,
+			Verified:  user.Verified(),
+		}
+		if accessToken != nil {
+			// Tokens carry their own grants instead of the user's roles
+			principal.Roles = nil
+			principal.TokenID = accessToken.ID
+			principal.Scopes = accessToken.Scopes
+			principal.AquariumID = accessToken.AquariumID
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	}
+}
+
+// Authenticate adapts JWTAuthMiddleware to the mux.MiddlewareFunc signature so it can be
+// applied to a whole gorilla/mux subrouter with Use.
+func (s *Server) Authenticate(next http.Handler) http.Handler {
+	return s.JWTAuthMiddleware(next.ServeHTTP)
+}
+
+// RequireRole returns a middleware that only lets through principals granted the given role.
+// It must run after JWTAuthMiddleware and can be applied to gorilla/mux subrouters with Use.
+//
+// Example:
+//
+//	admin := router.PathPrefix("/admin").Subrouter()
+//	admin.Use(server.Authenticate, auth.RequireRole(models.RoleAdmin))
+//
+// Params:
+//   - role: the role the authenticated user must hold.
+//
+// Returns:
+//   - func(http.Handler) http.Handler: the role-checking middleware.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := requirePrincipal(w, r)
+			if !ok {
+				return
+			}
+
+			if !principal.HasRole(role) {
+				log.Printf("User %s denied access to %s %s: missing role %s", principal.UserID, r.Method, r.URL.Path, role)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScope lets personal access tokens holding the given scope through to the handler.
+// Requests authenticated with a session are always let through. It must run after
+// JWTAuthMiddleware; handlers not wrapped with RequireScope refuse personal access tokens.
+//
+// Example:
+//
+//	router.Handle("/aquariums/{aquariumId}/parameter-entries",
+//		server.JWTAuthMiddleware(auth.RequireScope(auth.ScopeParametersWrite, server.CreateParameterEntryHandler)))
+//
+// Params:
+//   - scope: the scope a personal access token must hold.
+//   - next: the handler to protect.
+//
+// Returns:
+//   - http.HandlerFunc: the scope-checking handler.
+func RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if !principal.HasScope(scope) {
+			log.Printf("Token %s denied access to %s %s: missing scope %s", principal.TokenID, r.Method, r.URL.Path, scope)
+			http.Error(w, "Token lacks the "+scope+" scope", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), scopeCheckedKey, scope)))
 	}
 }
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/stevenpstansberry/AquaMind-AI/internal/mail"
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+	utils "github.com/stevenpstansberry/AquaMind-AI/internal/util"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordResetTTL is how long a password reset link stays valid.
+const passwordResetTTL = time.Hour
+
+// minPasswordLength is the minimum length of a newly chosen password.
+const minPasswordLength = 8
+
+// ForgotPasswordHandler emails a single-use password reset link to the given address.
+// The response is the same whether or not an account exists, so the endpoint cannot be
+// used to discover registered emails.
+//
+// Method: POST
+// Endpoint: /password/forgot
+//
+// Request body (JSON):
+//
+//	{
+//	  "email": "user@example.com"
+//	}
+func (s *Server) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	respond := func() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"message": "If an account exists for this email, a reset link has been sent"})
+	}
+
+	user, err := s.Users.GetUserByEmail(r.Context(), req.Email)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error retrieving user for password reset: %v", err)
+		}
+		respond()
+		return
+	}
+
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		log.Printf("Error generating password reset token: %v", err)
+		serverError(w, err, "Error processing request")
+		return
+	}
+
+	err = s.Users.CreatePasswordResetToken(r.Context(), user.ID, tokenHash, time.Now().Add(passwordResetTTL))
+	if err != nil {
+		log.Printf("Error storing password reset token for user %s: %v", user.ID, err)
+		serverError(w, err, "Error processing request")
+		return
+	}
+
+	err = s.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your AquaMind password",
+		Body: "Someone asked to reset the password for your AquaMind account.\n\n" +
+			"Use this link within the next hour to choose a new password:\n" +
+			appLink("/reset-password", token) + "\n\n" +
+			"If you did not ask for this, you can ignore this email.",
+	})
+	if err != nil {
+		log.Printf("Error sending password reset email to user %s: %v", user.ID, err)
+	}
+
+	s.recordAudit(r, userTarget(models.AuditPasswordResetSent, user.ID, models.OutcomeSuccess))
+	respond()
+}
+
+// ResetPasswordHandler sets a new password using a token from a password reset email.
+// All of the user's sessions are revoked, so they must log in again everywhere.
+//
+// Method: POST
+// Endpoint: /password/reset
+//
+// Request body (JSON):
+//
+//	{
+//	  "token": "token-from-the-reset-link",
+//	  "password": "new-password"
+//	}
+func (s *Server) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Password) < minPasswordLength {
+		http.Error(w, "Password is too short", http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		serverError(w, err, "Error processing password")
+		return
+	}
+
+	userID, err := s.Users.ResetPassword(r.Context(), utils.HashToken(req.Token), string(hashedPassword))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		} else {
+			log.Printf("Error resetting password: %v", err)
+			serverError(w, err, "Error resetting password")
+		}
+		return
+	}
+
+	log.Printf("Password reset for user %s", userID)
+	s.recordAudit(r, userTarget(models.AuditPasswordReset, userID, models.OutcomeSuccess))
+	w.WriteHeader(http.StatusNoContent)
+}
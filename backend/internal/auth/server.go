@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+
+	"github.com/gorilla/mux"
+	"github.com/stevenpstansberry/AquaMind-AI/internal/mail"
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+	"github.com/stevenpstansberry/AquaMind-AI/internal/oidc"
+	utils "github.com/stevenpstansberry/AquaMind-AI/internal/util"
+)
+
+// Server serves the API of the auth service. Handlers reach data only through the
+// stores held by the server, so the same handlers run against PostgreSQL in production
+// and against a models.MemoryStore when no database is available.
+type Server struct {
+	Users      models.UserStore
+	Sessions   models.SessionStore
+	Audit      models.AuditStore
+	Aquariums  models.AquariumStore
+	Catalog    models.CatalogStore
+	Parameters models.ParameterStore
+	Health     models.HealthChecker
+
+	// Keys signs the tokens the server issues and verifies those it is presented.
+	Keys *utils.KeySet
+
+	// Mailer delivers account emails such as password reset links.
+	Mailer mail.Mailer
+
+	// IdentityProviders are the external identity providers users can sign in with, keyed
+	// by name.
+	IdentityProviders map[string]oidc.Provider
+
+	// VerificationPolicy decides which endpoints accounts with an unverified email address
+	// may call.
+	VerificationPolicy VerificationPolicy
+
+	// TrustedProxies are the networks of the proxies allowed to report the client address
+	// in X-Forwarded-For or X-Real-IP (see ClientIP).
+	TrustedProxies []netip.Prefix
+
+	// AquariumListParameterLimit is how many of the most recent parameter entries of each
+	// aquarium are listed by GetUserAquariumsHandler when asked to include them; 0 lists all.
+	AquariumListParameterLimit int
+}
+
+// DefaultAquariumListParameterLimit is the AquariumListParameterLimit of a new Server.
+const DefaultAquariumListParameterLimit = 30
+
+// NewServer returns a Server using store for all of its data and keys for its tokens.
+// It logs emails instead of delivering them, has no identity providers, lets unverified
+// accounts call every endpoint and trusts no proxies until configured otherwise.
+//
+// Example:
+//
+//	keys, _ := utils.NewKeySet("test", ed25519PrivateKey)
+//	server := auth.NewServer(models.NewMemoryStore(), keys)
+//	httptest.NewServer(server.Routes())
+func NewServer(store models.Store, keys *utils.KeySet) *Server {
+	return &Server{
+		Users:      store,
+		Sessions:   store,
+		Audit:      store,
+		Aquariums:  store,
+		Catalog:    store,
+		Parameters: store,
+		Health:     store,
+		Keys:       keys,
+
+		Mailer:             &mail.LogMailer{},
+		IdentityProviders:  map[string]oidc.Provider{},
+		VerificationPolicy: VerificationPolicy{Mode: VerificationPolicyOff, AllowedPaths: defaultUnverifiedPaths},
+
+		AquariumListParameterLimit: DefaultAquariumListParameterLimit,
+	}
+}
+
+// Routes returns a router serving every endpoint of the service.
+func (s *Server) Routes() *mux.Router {
+	router := mux.NewRouter()
+
+	// Health check route
+	router.HandleFunc("/auth/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	}).Methods("GET")
+
+	// Routes for user registration and login
+	router.HandleFunc("/register", s.RegisterUser).Methods("POST")
+	router.HandleFunc("/login", s.LoginUser).Methods("POST")
+	router.HandleFunc("/login/mfa", s.LoginMFAHandler).Methods("POST")
+
+	// Public keys for verifying access tokens
+	router.HandleFunc("/.well-known/jwks.json", s.JWKSHandler).Methods("GET")
+
+	// Token refresh and logout routes
+	router.HandleFunc("/token/refresh", s.RefreshTokenHandler).Methods("POST")
+	router.Handle("/logout", s.JWTAuthMiddleware(s.LogoutHandler)).Methods("POST")
+	router.Handle("/logout/all", s.JWTAuthMiddleware(s.LogoutAllHandler)).Methods("POST")
+
+	// Password reset routes
+	router.HandleFunc("/password/forgot", s.ForgotPasswordHandler).Methods("POST")
+	router.HandleFunc("/password/reset", s.ResetPasswordHandler).Methods("POST")
+
+	// Email verification routes
+	router.HandleFunc("/email/verify", s.VerifyEmailHandler).Methods("POST")
+	router.Handle("/email/verify/resend", s.JWTAuthMiddleware(s.ResendVerificationHandler)).Methods("POST")
+
+	// Google OAuth login route
+	router.HandleFunc("/oauth", s.HandleGoogleOAuth).Methods("POST")
+
+	// External identity provider routes
+	router.HandleFunc("/oauth/providers", s.ListIdentityProvidersHandler).Methods("GET")
+	router.HandleFunc("/oauth/{provider}", s.OAuthLoginHandler).Methods("POST")
+	router.Handle("/user/identities", s.JWTAuthMiddleware(s.ListIdentitiesHandler)).Methods("GET")
+	router.Handle("/user/identities/{provider}", s.JWTAuthMiddleware(s.LinkIdentityHandler)).Methods("POST")
+	router.Handle("/user/identities/{provider}/{subject}", s.JWTAuthMiddleware(s.UnlinkIdentityHandler)).Methods("DELETE")
+
+	// Account self-service routes
+	router.Handle("/user/profile", s.JWTAuthMiddleware(s.GetProfileHandler)).Methods("GET")
+	router.Handle("/user/profile", s.JWTAuthMiddleware(s.UpdateProfileHandler)).Methods("PATCH")
+	router.Handle("/user/password", s.JWTAuthMiddleware(s.ChangePasswordHandler)).Methods("POST")
+	router.Handle("/user", s.JWTAuthMiddleware(s.DeleteAccountHandler)).Methods("DELETE")
+	router.Handle("/user/export", s.JWTAuthMiddleware(s.ExportDataHandler)).Methods("GET")
+
+	// Session management routes
+	router.Handle("/user/sessions", s.JWTAuthMiddleware(s.ListSessionsHandler)).Methods("GET")
+	router.Handle("/user/sessions", s.JWTAuthMiddleware(s.RevokeOtherSessionsHandler)).Methods("DELETE")
+	router.Handle("/user/sessions/{id}", s.JWTAuthMiddleware(s.RevokeSessionHandler)).Methods("DELETE")
+	router.Handle("/user/security-activity", s.JWTAuthMiddleware(s.SecurityActivityHandler)).Methods("GET")
+
+	// Personal access token routes
+	router.Handle("/user/tokens", s.JWTAuthMiddleware(s.CreateAccessTokenHandler)).Methods("POST")
+	router.Handle("/user/tokens", s.JWTAuthMiddleware(s.ListAccessTokensHandler)).Methods("GET")
+	router.Handle("/user/tokens/{id}", s.JWTAuthMiddleware(s.RevokeAccessTokenHandler)).Methods("DELETE")
+
+	// Two-factor authentication routes
+	router.Handle("/user/mfa/totp/enroll", s.JWTAuthMiddleware(s.EnrollTOTPHandler)).Methods("POST")
+	router.Handle("/user/mfa/totp/confirm", s.JWTAuthMiddleware(s.ConfirmTOTPHandler)).Methods("POST")
+	router.Handle("/user/mfa/totp", s.JWTAuthMiddleware(s.DisableTOTPHandler)).Methods("DELETE")
+	router.Handle("/user/mfa/recovery-codes", s.JWTAuthMiddleware(s.RegenerateRecoveryCodesHandler)).Methods("POST")
+
+	// Aquarium routes
+	router.Handle("/aquariums", s.JWTAuthMiddleware(RequireScope(ScopeAquariumsWrite, s.CreateAquariumHandler))).Methods("POST")
+	router.Handle("/user/aquariums", s.JWTAuthMiddleware(RequireScope(ScopeAquariumsRead, s.GetUserAquariumsHandler))).Methods("GET")
+	router.Handle("/aquariums/{id}", s.JWTAuthMiddleware(RequireScope(ScopeAquariumsRead, s.GetAquariumHandler))).Methods("GET")
+	router.Handle("/aquariums/{id}", s.JWTAuthMiddleware(RequireScope(ScopeAquariumsWrite, s.UpdateAquariumHandler))).Methods("PUT")
+	router.Handle("/aquariums/{id}", s.JWTAuthMiddleware(RequireScope(ScopeAquariumsWrite, s.PatchAquariumHandler))).Methods("PATCH")
+	router.Handle("/aquariums/{id}", s.JWTAuthMiddleware(RequireScope(ScopeAquariumsWrite, s.DeleteAquariumHandler))).Methods("DELETE")
+	router.Handle("/aquariums/{id}/{kind:species|plants}/{detailId}", s.JWTAuthMiddleware(RequireScope(ScopeAquariumsWrite, s.AddAquariumStockHandler))).Methods("POST")
+	router.Handle("/aquariums/{id}/{kind:species|plants}/{detailId}", s.JWTAuthMiddleware(RequireScope(ScopeAquariumsWrite, s.RemoveAquariumStockHandler))).Methods("DELETE")
+	router.Handle("/aquariums/{id}/revisions", s.JWTAuthMiddleware(RequireScope(ScopeAquariumsRead, s.ListAquariumRevisionsHandler))).Methods("GET")
+	router.Handle("/aquariums/{id}/revisions/{version:[0-9]+}", s.JWTAuthMiddleware(RequireScope(ScopeAquariumsRead, s.GetAquariumRevisionHandler))).Methods("GET")
+	router.Handle("/aquariums/{id}/revisions/{version:[0-9]+}/restore", s.JWTAuthMiddleware(RequireScope(ScopeAquariumsWrite, s.RestoreAquariumRevisionHandler))).Methods("POST")
+	router.Handle("/aquariums/{id}/as-of", s.JWTAuthMiddleware(RequireScope(ScopeAquariumsRead, s.GetAquariumAsOfHandler))).Methods("GET")
+
+	// Aquarium sharing routes
+	router.Handle("/aquariums/{id}/members", s.JWTAuthMiddleware(s.ListAquariumMembersHandler)).Methods("GET")
+	router.Handle("/aquariums/{id}/members/{userId}", s.JWTAuthMiddleware(s.UpdateAquariumMemberHandler)).Methods("PUT")
+	router.Handle("/aquariums/{id}/members/{userId}", s.JWTAuthMiddleware(s.RemoveAquariumMemberHandler)).Methods("DELETE")
+	router.Handle("/aquariums/{id}/invitations", s.JWTAuthMiddleware(s.CreateAquariumInvitationHandler)).Methods("POST")
+	router.Handle("/aquariums/{id}/invitations", s.JWTAuthMiddleware(s.ListAquariumInvitationsHandler)).Methods("GET")
+	router.Handle("/aquariums/{id}/invitations/{invitationId}", s.JWTAuthMiddleware(s.RevokeAquariumInvitationHandler)).Methods("DELETE")
+	router.Handle("/invitations/accept", s.JWTAuthMiddleware(s.AcceptAquariumInvitationHandler)).Methods("POST")
+
+	// Public share link routes; viewing a shared aquarium requires no authentication
+	router.Handle("/aquariums/{id}/share-links", s.JWTAuthMiddleware(s.CreateShareLinkHandler)).Methods("POST")
+	router.Handle("/aquariums/{id}/share-links", s.JWTAuthMiddleware(s.ListShareLinksHandler)).Methods("GET")
+	router.Handle("/aquariums/{id}/share-links/{linkId}", s.JWTAuthMiddleware(s.RevokeShareLinkHandler)).Methods("DELETE")
+	router.HandleFunc("/public/aquariums/{token}", s.GetSharedAquariumHandler).Methods("GET")
+
+	// Detail routes
+	router.Handle("/details/{id}", s.JWTAuthMiddleware(RequireScope(ScopeCatalogRead, s.GetDetailHandler))).Methods("GET")
+	router.Handle("/details/all/{type}", s.JWTAuthMiddleware(RequireScope(ScopeCatalogRead, s.GetAllDetailsHandler))).Methods("GET")
+
+	// Parameter entry routes
+	router.Handle("/aquariums/{aquariumId}/parameter-entries", s.JWTAuthMiddleware(RequireScope(ScopeParametersWrite, s.CreateParameterEntryHandler))).Methods("POST")
+	router.Handle("/aquariums/{aquariumId}/parameter-entries", s.JWTAuthMiddleware(RequireScope(ScopeParametersRead, s.GetParameterEntriesHandler))).Methods("GET")
+
+	// Admin routes, restricted to users with the admin role
+	adminRouter := router.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(s.Authenticate, RequireRole(models.RoleAdmin))
+	adminRouter.HandleFunc("/users", s.ListUsersHandler).Methods("GET")
+	adminRouter.HandleFunc("/users/{id}/roles", s.SetUserRolesHandler).Methods("PUT")
+	adminRouter.HandleFunc("/diagnostics", s.DiagnosticsHandler).Methods("GET")
+	adminRouter.HandleFunc("/audit-events", s.ListAuditEventsHandler).Methods("GET")
+
+	// Catalog management routes
+	adminRouter.HandleFunc("/details/{type}", s.CreateDetailHandler).Methods("POST")
+	adminRouter.HandleFunc("/details/{type}/{id}", s.UpdateDetailHandler).Methods("PUT")
+	adminRouter.HandleFunc("/details/{type}/{id}", s.DeleteDetailHandler).Methods("DELETE")
+
+	return router
+}
+
+// StatusClientClosedRequest is the nonstandard status, borrowed from nginx, logged for
+// requests whose client disconnected before a response could be written.
+const StatusClientClosedRequest = 499
+
+// serverError responds to a request that failed through no fault of its client. Store
+// calls cut short because the client disconnected or the database did not answer in time
+// get their own status, so they can be told apart from genuine failures; any other error
+// is reported as an internal server error with the given message.
+func serverError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, models.ErrQueryCanceled):
+		http.Error(w, "Request canceled", StatusClientClosedRequest)
+	case errors.Is(err, models.ErrQueryTimeout):
+		http.Error(w, "Service temporarily unavailable", http.StatusServiceUnavailable)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
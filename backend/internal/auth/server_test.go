@@ -0,0 +1,434 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stevenpstansberry/AquaMind-AI/internal/mail"
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+	utils "github.com/stevenpstansberry/AquaMind-AI/internal/util"
+)
+
+const testPassword = "correct horse battery staple"
+
+// recordingMailer keeps the messages sent instead of delivering them.
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (m *recordingMailer) Send(msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// linkToken returns the token of the last link sent to an email address.
+func (m *recordingMailer) linkToken(t *testing.T, to string) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To != to {
+			continue
+		}
+		for _, field := range strings.Fields(m.messages[i].Body) {
+			link, err := url.Parse(field)
+			if err == nil && link.Query().Get("token") != "" {
+				return link.Query().Get("token")
+			}
+		}
+	}
+	t.Fatalf("no link was emailed to %s", to)
+	return ""
+}
+
+// testServer serves a Server backed by a MemoryStore and signing with a key generated for
+// the test. Emails are recorded by the returned mailer.
+type testServer struct {
+	*httptest.Server
+	store  *models.MemoryStore
+	mailer *recordingMailer
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	keys, err := utils.NewKeySet("test", key)
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+
+	store := models.NewMemoryStore()
+	recorder := &recordingMailer{}
+	api := NewServer(store, keys)
+	api.Mailer = recorder
+
+	server := httptest.NewServer(api.Routes())
+	t.Cleanup(server.Close)
+	return &testServer{Server: server, store: store, mailer: recorder}
+}
+
+// response is a response read in full.
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// decode decodes the JSON body of the response into v.
+func (r *response) decode(t *testing.T, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(r.body, v); err != nil {
+		t.Fatalf("decoding %q: %v", r.body, err)
+	}
+}
+
+// do sends a request with a JSON body, if body is not nil, and the given bearer token, if
+// not empty. headers are pairs of header names and values.
+func (s *testServer) do(t *testing.T, method, path, token string, body interface{}, headers ...string) *response {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("encoding request body: %v", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, s.URL+path, reader)
+	if err != nil {
+		t.Fatalf("creating request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading response to %s %s: %v", method, path, err)
+	}
+	return &response{status: resp.StatusCode, header: resp.Header, body: data}
+}
+
+// expect sends a request like do and fails the test unless it is answered with status.
+func (s *testServer) expect(t *testing.T, status int, method, path, token string, body interface{}, headers ...string) *response {
+	t.Helper()
+
+	resp := s.do(t, method, path, token, body, headers...)
+	if resp.status != status {
+		t.Fatalf("%s %s: status %d, want %d: %s", method, path, resp.status, status, bytes.TrimSpace(resp.body))
+	}
+	return resp
+}
+
+// register registers a user and returns the access token of their first session.
+func (s *testServer) register(t *testing.T, email string) string {
+	t.Helper()
+
+	var tokens TokenPair
+	s.expect(t, http.StatusOK, "POST", "/register", "", map[string]string{
+		"email":      email,
+		"password":   testPassword,
+		"first_name": "Test",
+	}).decode(t, &tokens)
+	if tokens.Token == "" || tokens.RefreshToken == "" {
+		t.Fatalf("registering %s returned no tokens: %+v", email, tokens)
+	}
+	return tokens.Token
+}
+
+// newID returns a random UUID, as clients assign the IDs of the aquariums they create.
+func newID(t *testing.T) string {
+	t.Helper()
+
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		t.Fatalf("generating ID: %v", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// createAquarium creates an aquarium and returns it.
+func (s *testServer) createAquarium(t *testing.T, token string, name string) models.AquariumResponse {
+	t.Helper()
+
+	var aquarium models.AquariumResponse
+	resp := s.expect(t, http.StatusCreated, "POST", "/aquariums", token, map[string]interface{}{
+		"id":   newID(t),
+		"name": name,
+		"type": "Freshwater",
+		"size": "20",
+	})
+	resp.decode(t, &aquarium)
+	if aquarium.ID == "" || resp.header.Get("ETag") == "" {
+		t.Fatalf("creating an aquarium returned no ID or ETag: %s", resp.body)
+	}
+	return aquarium
+}
+
+func TestRegisterLoginRefresh(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+
+	token := server.register(t, "ada@example.com")
+	server.expect(t, http.StatusOK, "GET", "/user/profile", token, nil)
+	server.expect(t, http.StatusUnauthorized, "GET", "/user/profile", "", nil)
+	server.expect(t, http.StatusUnauthorized, "GET", "/user/profile", token+"x", nil)
+
+	server.expect(t, http.StatusBadRequest, "POST", "/register", "", map[string]string{
+		"email":      "ada@example.com",
+		"password":   testPassword,
+		"first_name": "Ada",
+	})
+	server.expect(t, http.StatusUnauthorized, "POST", "/login", "", map[string]string{
+		"email":    "ada@example.com",
+		"password": "wrong password",
+	})
+
+	var login TokenPair
+	server.expect(t, http.StatusOK, "POST", "/login", "", map[string]string{
+		"email":    "ada@example.com",
+		"password": testPassword,
+	}).decode(t, &login)
+	server.expect(t, http.StatusOK, "GET", "/user/profile", login.Token, nil)
+
+	// Refreshing rotates the refresh token
+	var refreshed TokenPair
+	server.expect(t, http.StatusOK, "POST", "/token/refresh", "", map[string]string{
+		"refresh_token": login.RefreshToken,
+	}).decode(t, &refreshed)
+	if refreshed.RefreshToken == "" || refreshed.RefreshToken == login.RefreshToken {
+		t.Fatalf("refresh returned refresh token %q, want a new one", refreshed.RefreshToken)
+	}
+	server.expect(t, http.StatusOK, "GET", "/user/profile", refreshed.Token, nil)
+
+	// Reusing a rotated refresh token revokes the session
+	server.expect(t, http.StatusUnauthorized, "POST", "/token/refresh", "", map[string]string{
+		"refresh_token": login.RefreshToken,
+	})
+	server.expect(t, http.StatusUnauthorized, "GET", "/user/profile", refreshed.Token, nil)
+	server.expect(t, http.StatusUnauthorized, "POST", "/token/refresh", "", map[string]string{
+		"refresh_token": refreshed.RefreshToken,
+	})
+
+	// Sessions are independent of each other
+	server.expect(t, http.StatusOK, "GET", "/user/profile", token, nil)
+
+	// Tokens verify against the published key
+	var jwks utils.JWKS
+	server.expect(t, http.StatusOK, "GET", "/.well-known/jwks.json", "", nil).decode(t, &jwks)
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != "test" {
+		t.Errorf("JWKS = %+v, want the test key", jwks)
+	}
+}
+
+func TestAquariumCRUD(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+	token := server.register(t, "ada@example.com")
+
+	created := server.createAquarium(t, token, "Living room tank")
+	path := "/aquariums/" + created.ID
+
+	var aquarium models.AquariumResponse
+	resp := server.expect(t, http.StatusOK, "GET", path, token, nil)
+	resp.decode(t, &aquarium)
+	if aquarium.Name != "Living room tank" || aquarium.Role != models.AquariumRoleOwner {
+		t.Errorf("GET %s = %+v", path, aquarium)
+	}
+	etag := resp.header.Get("ETag")
+
+	var listed []models.AquariumResponse
+	server.expect(t, http.StatusOK, "GET", "/user/aquariums", token, nil).decode(t, &listed)
+	if len(listed) != 1 || listed[0].ID != created.ID {
+		t.Errorf("GET /user/aquariums = %+v, want the created aquarium", listed)
+	}
+
+	update := map[string]interface{}{"name": "Office tank", "type": "Freshwater", "size": "40"}
+
+	// Updates must say which version they are based on
+	server.expect(t, http.StatusPreconditionRequired, "PUT", path, token, update)
+	server.expect(t, http.StatusPreconditionFailed, "PUT", path, token, update, "If-Match", `"999"`)
+
+	resp = server.expect(t, http.StatusOK, "PUT", path, token, update, "If-Match", etag)
+	updatedETag := resp.header.Get("ETag")
+	if updatedETag == "" || updatedETag == etag {
+		t.Fatalf("PUT %s returned ETag %q, want a new one", path, updatedETag)
+	}
+
+	// The previous version is stale now, and the current aquarium is returned with 412
+	resp = server.expect(t, http.StatusPreconditionFailed, "PUT", path, token, update, "If-Match", etag)
+	if resp.header.Get("ETag") != updatedETag {
+		t.Errorf("412 response ETag = %q, want %q", resp.header.Get("ETag"), updatedETag)
+	}
+
+	patch := map[string]interface{}{"name": "Patched tank"}
+	server.expect(t, http.StatusPreconditionFailed, "PATCH", path, token, patch, "Content-Type", MergePatchContentType, "If-Match", etag)
+	resp = server.expect(t, http.StatusOK, "PATCH", path, token, patch, "Content-Type", MergePatchContentType, "If-Match", updatedETag)
+	resp.decode(t, &aquarium)
+	if aquarium.Name != "Patched tank" || aquarium.Size != "40" || aquarium.Role != models.AquariumRoleOwner {
+		t.Errorf("PATCH %s = %+v", path, aquarium)
+	}
+	if resp.header.Get("ETag") == updatedETag {
+		t.Errorf("PATCH %s kept ETag %q", path, updatedETag)
+	}
+
+	server.expect(t, http.StatusOK, "GET", path, token, nil).decode(t, &aquarium)
+	if aquarium.Name != "Patched tank" {
+		t.Errorf("GET %s after PATCH: name = %q", path, aquarium.Name)
+	}
+
+	// Other users cannot see the aquarium
+	other := server.register(t, "grace@example.com")
+	server.expect(t, http.StatusForbidden, "GET", path, other, nil)
+	server.expect(t, http.StatusForbidden, "DELETE", path, other, nil)
+
+	server.expect(t, http.StatusNoContent, "DELETE", path, token, nil)
+	server.expect(t, http.StatusNotFound, "GET", path, token, nil)
+}
+
+func TestAquariumSharing(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+	owner := server.register(t, "ada@example.com")
+	aquarium := server.createAquarium(t, owner, "Shared tank")
+	path := "/aquariums/" + aquarium.ID
+
+	server.expect(t, http.StatusCreated, "POST", path+"/invitations", owner, map[string]string{
+		"email": "grace@example.com",
+		"role":  models.AquariumRoleViewer,
+	})
+	invitation := server.mailer.linkToken(t, "grace@example.com")
+
+	// The invitation only admits the address it was sent to
+	stranger := server.register(t, "mallory@example.com")
+	server.expect(t, http.StatusForbidden, "POST", "/invitations/accept", stranger, map[string]string{"token": invitation})
+
+	viewer := server.register(t, "grace@example.com")
+	server.expect(t, http.StatusForbidden, "GET", path, viewer, nil)
+
+	var accepted map[string]string
+	server.expect(t, http.StatusOK, "POST", "/invitations/accept", viewer, map[string]string{"token": invitation}).decode(t, &accepted)
+	if accepted["aquariumId"] != aquarium.ID || accepted["role"] != models.AquariumRoleViewer {
+		t.Errorf("accepting the invitation = %v", accepted)
+	}
+	server.expect(t, http.StatusBadRequest, "POST", "/invitations/accept", viewer, map[string]string{"token": invitation})
+
+	var shared models.AquariumResponse
+	resp := server.expect(t, http.StatusOK, "GET", path, viewer, nil)
+	resp.decode(t, &shared)
+	if shared.Role != models.AquariumRoleViewer {
+		t.Errorf("viewer's role = %q, want %q", shared.Role, models.AquariumRoleViewer)
+	}
+	var listed []models.AquariumResponse
+	server.expect(t, http.StatusOK, "GET", "/user/aquariums", viewer, nil).decode(t, &listed)
+	if len(listed) != 1 || listed[0].ID != aquarium.ID {
+		t.Errorf("viewer's aquariums = %+v, want the shared aquarium", listed)
+	}
+
+	// Viewers cannot change the aquarium or manage its members
+	update := map[string]interface{}{"name": "Renamed"}
+	server.expect(t, http.StatusForbidden, "PUT", path, viewer, update, "If-Match", resp.header.Get("ETag"))
+	server.expect(t, http.StatusForbidden, "POST", path+"/invitations", viewer, map[string]string{
+		"email": "mallory@example.com",
+		"role":  models.AquariumRoleViewer,
+	})
+
+	var members []models.AquariumMember
+	server.expect(t, http.StatusOK, "GET", path+"/members", owner, nil).decode(t, &members)
+	if len(members) != 2 {
+		t.Fatalf("members = %+v, want the owner and the viewer", members)
+	}
+	var viewerID string
+	for _, member := range members {
+		if member.Email == "grace@example.com" {
+			viewerID = member.UserID
+		}
+	}
+	if viewerID == "" {
+		t.Fatalf("members = %+v, want grace@example.com", members)
+	}
+
+	// Promoted to editor, the member can change the aquarium
+	server.expect(t, http.StatusNoContent, "PUT", path+"/members/"+viewerID, owner, map[string]string{"role": models.AquariumRoleEditor})
+	server.expect(t, http.StatusOK, "PUT", path, viewer, update, "If-Match", resp.header.Get("ETag"))
+
+	// Once removed, the member loses access
+	server.expect(t, http.StatusNoContent, "DELETE", path+"/members/"+viewerID, owner, nil)
+	server.expect(t, http.StatusForbidden, "GET", path, viewer, nil)
+}
+
+func TestPersonalAccessTokens(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+	session := server.register(t, "ada@example.com")
+	aquarium := server.createAquarium(t, session, "Sensor tank")
+
+	server.expect(t, http.StatusBadRequest, "POST", "/user/tokens", session, map[string]interface{}{
+		"name":   "bad scope",
+		"scopes": []string{"everything"},
+	})
+
+	var created struct {
+		models.PersonalAccessToken
+		Token string `json:"token"`
+	}
+	server.expect(t, http.StatusCreated, "POST", "/user/tokens", session, map[string]interface{}{
+		"name":   "tank sensor",
+		"scopes": []string{ScopeAquariumsRead},
+	}).decode(t, &created)
+	if !strings.HasPrefix(created.Token, utils.PersonalAccessTokenPrefix) || created.ID == "" {
+		t.Fatalf("created token = %+v", created)
+	}
+	token := created.Token
+
+	// The token grants its scopes and nothing else
+	server.expect(t, http.StatusOK, "GET", "/user/aquariums", token, nil)
+	server.expect(t, http.StatusOK, "GET", "/aquariums/"+aquarium.ID, token, nil)
+	server.expect(t, http.StatusForbidden, "POST", "/aquariums", token, map[string]interface{}{"id": newID(t), "name": "Another tank"})
+	server.expect(t, http.StatusForbidden, "GET", "/user/tokens", token, nil)
+
+	var listed []models.PersonalAccessToken
+	server.expect(t, http.StatusOK, "GET", "/user/tokens", session, nil).decode(t, &listed)
+	if len(listed) != 1 || listed[0].ID != created.ID || listed[0].LastUsedAt == nil {
+		t.Errorf("listed tokens = %+v, want the used token", listed)
+	}
+
+	server.expect(t, http.StatusNoContent, "DELETE", "/user/tokens/"+created.ID, session, nil)
+	server.expect(t, http.StatusUnauthorized, "GET", "/user/aquariums", token, nil)
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+)
+
+// SessionResponse is a session as listed to its owner.
+type SessionResponse struct {
+	models.Session
+	Current bool `json:"current"` // Whether this is the session making the request
+}
+
+// ListSessionsHandler lists the devices the authenticated user is logged in on.
+//
+// Method: GET
+// Endpoint: /user/sessions
+//
+// Response (JSON):
+//   - On success: [{"id": "...", "userAgent": "...", "ip": "...", "createdAt": "...", "lastSeenAt": "...", "current": true}]
+//   - On error: HTTP status code with an appropriate error message.
+func (s *Server) ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := s.Sessions.ListActiveSessions(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("Error listing sessions for user %s: %v", principal.UserID, err)
+		serverError(w, err, "Error retrieving sessions")
+		return
+	}
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, SessionResponse{Session: session, Current: session.ID == principal.SessionID})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RevokeSessionHandler signs the authenticated user out of one of their sessions.
+//
+// Method: DELETE
+// Endpoint: /user/sessions/{id}
+func (s *Server) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	sessionID := mux.Vars(r)["id"]
+
+	err := s.Sessions.RevokeSession(r.Context(), sessionID, principal.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+		} else {
+			log.Printf("Error revoking session %s: %v", sessionID, err)
+			serverError(w, err, "Error revoking session")
+		}
+		return
+	}
+
+	log.Printf("User %s revoked session %s", principal.UserID, sessionID)
+	s.recordAudit(r, targetEvent(models.AuditSessionRevoked, "session", sessionID, models.OutcomeSuccess))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeOtherSessionsHandler signs the authenticated user out everywhere except the
+// session making the request.
+//
+// Method: DELETE
+// Endpoint: /user/sessions
+//
+// Response (JSON):
+//   - On success: {"revoked": 2}
+//   - On error: HTTP status code with an appropriate error message.
+func (s *Server) RevokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	revoked, err := s.Sessions.RevokeOtherSessions(r.Context(), principal.UserID, principal.SessionID)
+	if err != nil {
+		log.Printf("Error revoking sessions for user %s: %v", principal.UserID, err)
+		serverError(w, err, "Error revoking sessions")
+		return
+	}
+
+	log.Printf("User %s revoked %d other sessions", principal.UserID, revoked)
+	event := userTarget(models.AuditSessionRevoked, principal.UserID, models.OutcomeSuccess)
+	event.Details = map[string]interface{}{"revoked": revoked, "kept": principal.SessionID}
+	s.recordAudit(r, event)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"revoked": revoked})
+}
@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+	utils "github.com/stevenpstansberry/AquaMind-AI/internal/util"
+)
+
+// Limits on share links.
+const (
+	maxShareLinkLifetime      = 365 // Days
+	publicParameterEntryLimit = 30  // Most recent parameter entries shown on a shared aquarium
+)
+
+// PublicAquarium is the view of an aquarium shown through a share link. It leaves out
+// the aquarium's ID and everything identifying its owner and members.
+type PublicAquarium struct {
+	Name             string                 `json:"name"`
+	Type             string                 `json:"type"`
+	Size             string                 `json:"size"`
+	Species          []models.Species       `json:"species"`
+	Plants           []models.Plant         `json:"plants"`
+	Equipment        []models.Equipment     `json:"equipment"`
+	ParameterEntries []PublicParameterEntry `json:"parameterEntries"`
+}
+
+// PublicParameterEntry is a parameter entry shown through a share link.
+type PublicParameterEntry struct {
+	Timestamp   int64    `json:"timestamp"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	Ph          *float64 `json:"ph,omitempty"`
+	Hardness    *float64 `json:"hardness,omitempty"`
+}
+
+// newPublicAquarium strips an aquarium down to what may be shown publicly.
+func newPublicAquarium(aquarium *models.AquariumResponse) PublicAquarium {
+	public := PublicAquarium{
+		Name:             aquarium.Name,
+		Type:             aquarium.Type,
+		Size:             aquarium.Size,
+		Species:          aquarium.Species,
+		Plants:           aquarium.Plants,
+		Equipment:        aquarium.Equipment,
+		ParameterEntries: []PublicParameterEntry{},
+	}
+	if public.Species == nil {
+		public.Species = []models.Species{}
+	}
+	if public.Plants == nil {
+		public.Plants = []models.Plant{}
+	}
+	if public.Equipment == nil {
+		public.Equipment = []models.Equipment{}
+	}
+
+	// Entries are ordered newest first
+	for i, entry := range aquarium.ParameterEntries {
+		if i == publicParameterEntryLimit {
+			break
+		}
+		public.ParameterEntries = append(public.ParameterEntries, PublicParameterEntry{
+			Timestamp:   entry.Timestamp,
+			Temperature: entry.Temperature,
+			Ph:          entry.Ph,
+			Hardness:    entry.Hardness,
+		})
+	}
+	return public
+}
+
+// CreateShareLinkHandler creates a read-only public link to an aquarium. Only owners
+// may create links. The token is only returned by this call; afterwards only its hash is kept.
+//
+// Method: POST
+// Endpoint: /aquariums/{id}/share-links
+//
+// Request body (JSON, optional):
+//
+//	{
+//	  "expires_in_days": 30
+//	}
+//
+// Response (JSON):
+//   - On success: the link's metadata with its token in "token" and a page link in "url".
+//   - On error: HTTP status code with an appropriate error message.
+func (s *Server) CreateShareLinkHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	aquariumID := mux.Vars(r)["id"]
+	if _, ok := s.authorizeAquarium(w, r, principal, aquariumID, models.AquariumRoleOwner); !ok {
+		return
+	}
+
+	var req struct {
+		ExpiresInDays int `json:"expires_in_days"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid input", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxShareLinkLifetime {
+		http.Error(w, "expires_in_days must be between 1 and 365, or 0 for no expiry", http.StatusBadRequest)
+		return
+	}
+
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		log.Printf("Error generating share link token: %v", err)
+		serverError(w, err, "Error creating share link")
+		return
+	}
+
+	link := &models.ShareLink{AquariumID: aquariumID, CreatedBy: principal.UserID}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		link.ExpiresAt = &expiresAt
+	}
+
+	if err := s.Aquariums.CreateShareLink(r.Context(), link, tokenHash); err != nil {
+		log.Printf("Error storing share link for aquarium %s: %v", aquariumID, err)
+		serverError(w, err, "Error creating share link")
+		return
+	}
+
+	log.Printf("User %s created share link %s for aquarium %s", principal.UserID, link.ID, aquariumID)
+	event := targetEvent(models.AuditShareLinkCreated, "aquarium", aquariumID, models.OutcomeSuccess)
+	event.Details = map[string]interface{}{"link_id": link.ID, "expires_at": link.ExpiresAt}
+	s.recordAudit(r, event)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		*models.ShareLink
+		Token string `json:"token"`
+		URL   string `json:"url"`
+	}{link, token, appLink("/shared-aquarium", token)})
+}
+
+// ListShareLinksHandler lists the share links of an aquarium without their tokens.
+//
+// Method: GET
+// Endpoint: /aquariums/{id}/share-links
+func (s *Server) ListShareLinksHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	aquariumID := mux.Vars(r)["id"]
+	if _, ok := s.authorizeAquarium(w, r, principal, aquariumID, models.AquariumRoleOwner); !ok {
+		return
+	}
+
+	links, err := s.Aquariums.ListShareLinks(r.Context(), aquariumID)
+	if err != nil {
+		log.Printf("Error listing share links of aquarium %s: %v", aquariumID, err)
+		serverError(w, err, "Error retrieving share links")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(links)
+}
+
+// RevokeShareLinkHandler revokes a share link of an aquarium.
+//
+// Method: DELETE
+// Endpoint: /aquariums/{id}/share-links/{linkId}
+func (s *Server) RevokeShareLinkHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(r)
+	aquariumID, linkID := vars["id"], vars["linkId"]
+	if _, ok := s.authorizeAquarium(w, r, principal, aquariumID, models.AquariumRoleOwner); !ok {
+		return
+	}
+
+	err := s.Aquariums.RevokeShareLink(r.Context(), aquariumID, linkID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Share link not found", http.StatusNotFound)
+		} else {
+			log.Printf("Error revoking share link %s: %v", linkID, err)
+			serverError(w, err, "Error revoking share link")
+		}
+		return
+	}
+
+	log.Printf("User %s revoked share link %s of aquarium %s", principal.UserID, linkID, aquariumID)
+	event := targetEvent(models.AuditShareLinkRevoked, "aquarium", aquariumID, models.OutcomeSuccess)
+	event.Details = map[string]interface{}{"link_id": linkID}
+	s.recordAudit(r, event)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSharedAquariumHandler shows an aquarium through a share link. No authentication is
+// required; unknown, revoked and expired links are all reported as not found.
+//
+// Method: GET
+// Endpoint: /public/aquariums/{token}
+func (s *Server) GetSharedAquariumHandler(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+
+	aquariumID, err := s.Aquariums.GetAquariumIDByShareToken(r.Context(), utils.HashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Aquarium not found", http.StatusNotFound)
+		} else {
+			log.Printf("Error resolving share link: %v", err)
+			serverError(w, err, "Error retrieving aquarium")
+		}
+		return
+	}
+
+	aquarium, err := s.Aquariums.GetAquariumByID(r.Context(), aquariumID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Aquarium not found", http.StatusNotFound)
+		} else {
+			log.Printf("Error retrieving shared aquarium %s: %v", aquariumID, err)
+			serverError(w, err, "Error retrieving aquarium")
+		}
+		return
+	}
+
+	// Revoking a link must take effect immediately, so responses are not cached
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newPublicAquarium(aquarium))
+}
@@ -0,0 +1,392 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stevenpstansberry/AquaMind-AI/internal/mail"
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+	utils "github.com/stevenpstansberry/AquaMind-AI/internal/util"
+)
+
+// invitationTTL is how long an aquarium invitation stays valid.
+const invitationTTL = 7 * 24 * time.Hour
+
+// authorizeAquarium checks that the principal holds at least the required role on an
+// aquarium and that their token is not limited to another aquarium, writing a not found
+// or forbidden response otherwise. Refused requests are recorded in the audit log.
+//
+// Returns:
+//   - string: the principal's role on the aquarium
+//   - bool: whether the request may proceed
+func (s *Server) authorizeAquarium(w http.ResponseWriter, r *http.Request, principal *Principal, aquariumID string, required string) (string, bool) {
+	role, err := s.Aquariums.GetAquariumRole(r.Context(), aquariumID, principal.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Aquarium not found", http.StatusNotFound)
+		} else {
+			log.Printf("Error retrieving role of user %s on aquarium %s: %v", principal.UserID, aquariumID, err)
+			serverError(w, err, "Error retrieving aquarium")
+		}
+		return "", false
+	}
+
+	if !principal.CanAccessAquarium(aquariumID) || !models.AquariumRoleAtLeast(role, required) {
+		event := targetEvent(models.AuditAquariumDenied, "aquarium", aquariumID, models.OutcomeDenied)
+		event.Details = map[string]interface{}{"role": role, "required": required}
+		s.recordAudit(r, event)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return "", false
+	}
+
+	return role, true
+}
+
+// ListAquariumMembersHandler lists everyone an aquarium is shared with.
+//
+// Method: GET
+// Endpoint: /aquariums/{id}/members
+func (s *Server) ListAquariumMembersHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	aquariumID := mux.Vars(r)["id"]
+	if _, ok := s.authorizeAquarium(w, r, principal, aquariumID, models.AquariumRoleViewer); !ok {
+		return
+	}
+
+	members, err := s.Aquariums.ListAquariumMembers(r.Context(), aquariumID)
+	if err != nil {
+		log.Printf("Error listing members of aquarium %s: %v", aquariumID, err)
+		serverError(w, err, "Error retrieving members")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+// UpdateAquariumMemberHandler changes the role of a member of an aquarium. Only owners
+// may change roles, and the primary owner's role cannot be changed.
+//
+// Method: PUT
+// Endpoint: /aquariums/{id}/members/{userId}
+//
+// Request body (JSON):
+//
+//	{
+//	  "role": "editor"
+//	}
+func (s *Server) UpdateAquariumMemberHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(r)
+	aquariumID, userID := vars["id"], vars["userId"]
+	if _, ok := s.authorizeAquarium(w, r, principal, aquariumID, models.AquariumRoleOwner); !ok {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if !models.ValidAquariumRole(req.Role) {
+		http.Error(w, "Role must be viewer, editor or owner", http.StatusBadRequest)
+		return
+	}
+
+	err := s.Aquariums.SetAquariumMemberRole(r.Context(), aquariumID, userID, req.Role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.writeMemberNotFound(r.Context(), w, aquariumID, userID)
+		} else {
+			log.Printf("Error setting role of user %s on aquarium %s: %v", userID, aquariumID, err)
+			serverError(w, err, "Error updating member")
+		}
+		return
+	}
+
+	log.Printf("User %s set role of user %s on aquarium %s to %s", principal.UserID, userID, aquariumID, req.Role)
+	event := targetEvent(models.AuditMemberRoleChanged, "aquarium", aquariumID, models.OutcomeSuccess)
+	event.Details = map[string]interface{}{"user_id": userID, "role": req.Role}
+	s.recordAudit(r, event)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveAquariumMemberHandler revokes a member's access to an aquarium. Owners may remove
+// any member except the primary owner; any member may remove themselves to leave.
+//
+// Method: DELETE
+// Endpoint: /aquariums/{id}/members/{userId}
+func (s *Server) RemoveAquariumMemberHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(r)
+	aquariumID, userID := vars["id"], vars["userId"]
+
+	required := models.AquariumRoleOwner
+	if userID == principal.UserID {
+		required = models.AquariumRoleViewer
+	}
+	if _, ok := s.authorizeAquarium(w, r, principal, aquariumID, required); !ok {
+		return
+	}
+
+	err := s.Aquariums.RemoveAquariumMember(r.Context(), aquariumID, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.writeMemberNotFound(r.Context(), w, aquariumID, userID)
+		} else {
+			log.Printf("Error removing user %s from aquarium %s: %v", userID, aquariumID, err)
+			serverError(w, err, "Error removing member")
+		}
+		return
+	}
+
+	log.Printf("User %s removed user %s from aquarium %s", principal.UserID, userID, aquariumID)
+	event := targetEvent(models.AuditMemberRemoved, "aquarium", aquariumID, models.OutcomeSuccess)
+	event.Details = map[string]interface{}{"user_id": userID}
+	s.recordAudit(r, event)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeMemberNotFound responds to a change of a user who is not a stored member of an
+// aquarium, which is either the primary owner or someone without access.
+func (s *Server) writeMemberNotFound(ctx context.Context, w http.ResponseWriter, aquariumID string, userID string) {
+	role, err := s.Aquariums.GetAquariumRole(ctx, aquariumID, userID)
+	if err == nil && role == models.AquariumRoleOwner {
+		http.Error(w, "The primary owner of an aquarium cannot be changed or removed", http.StatusConflict)
+		return
+	}
+	http.Error(w, "Member not found", http.StatusNotFound)
+}
+
+// CreateAquariumInvitationHandler invites an email address to an aquarium with the given
+// role and emails the invitation link. Only owners may invite.
+//
+// Method: POST
+// Endpoint: /aquariums/{id}/invitations
+//
+// Request body (JSON):
+//
+//	{
+//	  "email": "friend@example.com",
+//	  "role": "viewer"
+//	}
+//
+// Response (JSON):
+//   - On success: the pending invitation.
+//   - On error: HTTP status code with an appropriate error message.
+func (s *Server) CreateAquariumInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	aquariumID := mux.Vars(r)["id"]
+	if _, ok := s.authorizeAquarium(w, r, principal, aquariumID, models.AquariumRoleOwner); !ok {
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	email := strings.TrimSpace(req.Email)
+	if !strings.Contains(email, "@") {
+		http.Error(w, "A valid email address is required", http.StatusBadRequest)
+		return
+	}
+	if !models.ValidAquariumRole(req.Role) {
+		http.Error(w, "Role must be viewer, editor or owner", http.StatusBadRequest)
+		return
+	}
+
+	// Users who already have access have their role changed instead
+	if invitee, err := s.Users.GetUserByEmail(r.Context(), email); err == nil {
+		role, err := s.Aquariums.GetAquariumRole(r.Context(), aquariumID, invitee.ID)
+		if err == nil && role != "" {
+			http.Error(w, "This user already has access to the aquarium", http.StatusConflict)
+			return
+		}
+	}
+
+	aquarium, err := s.Aquariums.GetAquariumByID(r.Context(), aquariumID)
+	if err != nil {
+		log.Printf("Error retrieving aquarium %s: %v", aquariumID, err)
+		serverError(w, err, "Error retrieving aquarium")
+		return
+	}
+
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		log.Printf("Error generating invitation token: %v", err)
+		serverError(w, err, "Error creating invitation")
+		return
+	}
+
+	invitation := &models.AquariumInvitation{
+		AquariumID: aquariumID,
+		Email:      email,
+		Role:       req.Role,
+		InvitedBy:  principal.UserID,
+		ExpiresAt:  time.Now().Add(invitationTTL),
+	}
+	if err := s.Aquariums.CreateAquariumInvitation(r.Context(), invitation, tokenHash); err != nil {
+		log.Printf("Error storing invitation to aquarium %s: %v", aquariumID, err)
+		serverError(w, err, "Error creating invitation")
+		return
+	}
+
+	err = s.Mailer.Send(mail.Message{
+		To:      email,
+		Subject: "You have been invited to an aquarium on AquaMind",
+		Body: principal.Email + " invited you to the aquarium \"" + aquarium.Name + "\" on AquaMind as " + req.Role + ".\n\n" +
+			"Sign in or create an account with this email address and open this link within the next 7 days to accept:\n" +
+			appLink("/accept-invitation", token) + "\n\n" +
+			"If you were not expecting this invitation, you can ignore this email.",
+	})
+	if err != nil {
+		log.Printf("Error sending invitation email for aquarium %s: %v", aquariumID, err)
+	}
+
+	log.Printf("User %s invited %s to aquarium %s as %s", principal.UserID, email, aquariumID, req.Role)
+	event := targetEvent(models.AuditMemberInvited, "aquarium", aquariumID, models.OutcomeSuccess)
+	event.Details = map[string]interface{}{"email": email, "role": req.Role}
+	s.recordAudit(r, event)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invitation)
+}
+
+// ListAquariumInvitationsHandler lists the pending invitations to an aquarium.
+//
+// Method: GET
+// Endpoint: /aquariums/{id}/invitations
+func (s *Server) ListAquariumInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	aquariumID := mux.Vars(r)["id"]
+	if _, ok := s.authorizeAquarium(w, r, principal, aquariumID, models.AquariumRoleOwner); !ok {
+		return
+	}
+
+	invitations, err := s.Aquariums.ListAquariumInvitations(r.Context(), aquariumID)
+	if err != nil {
+		log.Printf("Error listing invitations to aquarium %s: %v", aquariumID, err)
+		serverError(w, err, "Error retrieving invitations")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invitations)
+}
+
+// RevokeAquariumInvitationHandler withdraws a pending invitation to an aquarium.
+//
+// Method: DELETE
+// Endpoint: /aquariums/{id}/invitations/{invitationId}
+func (s *Server) RevokeAquariumInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(r)
+	aquariumID, invitationID := vars["id"], vars["invitationId"]
+	if _, ok := s.authorizeAquarium(w, r, principal, aquariumID, models.AquariumRoleOwner); !ok {
+		return
+	}
+
+	err := s.Aquariums.RevokeAquariumInvitation(r.Context(), aquariumID, invitationID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Invitation not found", http.StatusNotFound)
+		} else {
+			log.Printf("Error revoking invitation %s: %v", invitationID, err)
+			serverError(w, err, "Error revoking invitation")
+		}
+		return
+	}
+
+	log.Printf("User %s revoked invitation %s to aquarium %s", principal.UserID, invitationID, aquariumID)
+	event := targetEvent(models.AuditInvitationRevoked, "aquarium", aquariumID, models.OutcomeSuccess)
+	event.Details = map[string]interface{}{"invitation_id": invitationID}
+	s.recordAudit(r, event)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AcceptAquariumInvitationHandler adds the authenticated user to an aquarium using the
+// token from an invitation email. The invitation must have been sent to the user's email address.
+//
+// Method: POST
+// Endpoint: /invitations/accept
+//
+// Request body (JSON):
+//
+//	{
+//	  "token": "token-from-the-invitation-email"
+//	}
+//
+// Response (JSON):
+//   - On success: the ID of the aquarium and the role granted.
+//   - On error: HTTP status code with an appropriate error message.
+func (s *Server) AcceptAquariumInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := s.Aquariums.AcceptAquariumInvitation(r.Context(), utils.HashToken(req.Token), principal.UserID, principal.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "Invalid or expired invitation", http.StatusBadRequest)
+		case errors.Is(err, models.ErrInvitationEmailMismatch):
+			http.Error(w, "This invitation was sent to a different email address", http.StatusForbidden)
+		default:
+			log.Printf("Error accepting invitation for user %s: %v", principal.UserID, err)
+			serverError(w, err, "Error accepting invitation")
+		}
+		return
+	}
+
+	log.Printf("User %s joined aquarium %s as %s", principal.UserID, invitation.AquariumID, invitation.Role)
+	event := targetEvent(models.AuditMemberJoined, "aquarium", invitation.AquariumID, models.OutcomeSuccess)
+	event.Details = map[string]interface{}{"role": invitation.Role, "invitation_id": invitation.ID}
+	s.recordAudit(r, event)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"aquariumId": invitation.AquariumID, "role": invitation.Role})
+}
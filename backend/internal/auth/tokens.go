@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+	utils "github.com/stevenpstansberry/AquaMind-AI/internal/util"
+)
+
+// TokenPair is the token payload returned to clients after a successful login or refresh.
+type TokenPair struct {
+	Token        string `json:"token"`         // Short-lived access token
+	RefreshToken string `json:"refresh_token"` // Single-use refresh token
+	ExpiresIn    int64  `json:"expires_in"`    // Access token lifetime in seconds
+}
+
+// issueTokens starts a new session for the user on the device that sent the request
+// and mints its first token pair.
+func (s *Server) issueTokens(r *http.Request, user *models.User) (*TokenPair, error) {
+	session, err := s.Sessions.CreateSession(r.Context(), user.ID, r.UserAgent(), s.ClientIP(r))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueSessionTokens(r.Context(), session.ID, user)
+}
+
+// issueSessionTokens mints an access token and a fresh refresh token for an existing session.
+func (s *Server) issueSessionTokens(ctx context.Context, sessionID string, user *models.User) (*TokenPair, error) {
+	token, err := s.Keys.GenerateJWT(user.ID, sessionID, user.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshHash, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Sessions.CreateRefreshToken(ctx, sessionID, refreshHash, time.Now().Add(utils.RefreshTokenTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(utils.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// RefreshTokenHandler exchanges a refresh token for a new access token and a new refresh token.
+// Refresh tokens are single use: presenting one that was already exchanged is treated as theft
+// and revokes the whole session, logging out every holder of its tokens.
+//
+// Method: POST
+// Endpoint: /token/refresh
+//
+// Request body (JSON):
+//
+//	{
+//	  "refresh_token": "opaque-refresh-token"
+//	}
+//
+// Response (JSON):
+//   - On success: {"token": "...", "refresh_token": "...", "expires_in": 900}
+//   - On error: HTTP status code with an appropriate error message.
+func (s *Server) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.RefreshToken == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	stored, err := s.Sessions.GetRefreshTokenByHash(r.Context(), utils.HashToken(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		} else {
+			log.Printf("Error retrieving refresh token: %v", err)
+			serverError(w, err, "Error refreshing token")
+		}
+		return
+	}
+
+	if stored.SessionRevokedAt != nil {
+		http.Error(w, "Session revoked", http.StatusUnauthorized)
+		return
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		http.Error(w, "Refresh token expired", http.StatusUnauthorized)
+		return
+	}
+
+	// Mark the token as used; losing this race means it was already exchanged
+	marked, err := s.Sessions.MarkRefreshTokenUsed(r.Context(), stored.ID)
+	if err != nil {
+		log.Printf("Error marking refresh token as used: %v", err)
+		serverError(w, err, "Error refreshing token")
+		return
+	}
+	if !marked {
+		log.Printf("Refresh token reuse detected for session %s, revoking session", stored.SessionID)
+		event := userTarget(models.AuditRefreshReuse, stored.UserID, models.OutcomeDenied)
+		event.Details = map[string]interface{}{"session_id": stored.SessionID}
+		s.recordAudit(r, event)
+		if err := s.Sessions.RevokeSession(r.Context(), stored.SessionID, stored.UserID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error revoking session %s: %v", stored.SessionID, err)
+		}
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	// Reload the user so the new access token carries their current roles
+	user, err := s.Users.GetUserByID(r.Context(), stored.UserID)
+	if err != nil {
+		log.Printf("Error retrieving user for session %s: %v", stored.SessionID, err)
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := s.issueSessionTokens(r.Context(), stored.SessionID, user)
+	if err != nil {
+		log.Printf("Error issuing tokens for session %s: %v", stored.SessionID, err)
+		serverError(w, err, "Error generating token")
+		return
+	}
+
+	if err := s.Sessions.TouchSession(r.Context(), stored.SessionID, s.ClientIP(r)); err != nil {
+		log.Printf("Error recording activity of session %s: %v", stored.SessionID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// LogoutHandler revokes the session of the access token used to call it.
+//
+// Method: POST
+// Endpoint: /logout
+func (s *Server) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.Sessions.RevokeSession(r.Context(), principal.SessionID, principal.UserID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error revoking session %s: %v", principal.SessionID, err)
+		serverError(w, err, "Error logging out")
+		return
+	}
+
+	s.recordAudit(r, targetEvent(models.AuditLogout, "session", principal.SessionID, models.OutcomeSuccess))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAllHandler revokes every session of the authenticated user, logging them out everywhere.
+//
+// Method: POST
+// Endpoint: /logout/all
+func (s *Server) LogoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.Sessions.RevokeUserSessions(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("Error revoking sessions for user %s: %v", principal.UserID, err)
+		serverError(w, err, "Error logging out")
+		return
+	}
+
+	s.recordAudit(r, userTarget(models.AuditLogoutAll, principal.UserID, models.OutcomeSuccess))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// JWKSHandler publishes the public keys that access tokens can be verified against,
+// so other services can validate tokens without holding any signing material.
+//
+// Method: GET
+// Endpoint: /.well-known/jwks.json
+func (s *Server) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(s.Keys.JWKS())
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/stevenpstansberry/AquaMind-AI/internal/mail"
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+	utils "github.com/stevenpstansberry/AquaMind-AI/internal/util"
+)
+
+// verificationTokenTTL is how long an email verification link stays valid.
+const verificationTokenTTL = 48 * time.Hour
+
+// verificationResendInterval is the minimum time between two verification emails to the same user.
+const verificationResendInterval = 5 * time.Minute
+
+// errVerificationThrottled is returned when a verification email was sent too recently.
+var errVerificationThrottled = errors.New("verification email sent too recently")
+
+// Verification policies, selected with EMAIL_VERIFICATION_POLICY, deciding which
+// authenticated endpoints accounts with an unverified email address may call.
+const (
+	VerificationPolicyOff      = "off"       // Unverified accounts may call every endpoint
+	VerificationPolicyReadOnly = "read-only" // Unverified accounts may only call GET endpoints and the allowed paths
+	VerificationPolicyStrict   = "strict"    // Unverified accounts may only call the allowed paths
+)
+
+// VerificationPolicy decides which endpoints unverified accounts may call.
+type VerificationPolicy struct {
+	Mode         string   // One of the VerificationPolicy constants
+	AllowedPaths []string // Paths always allowed; entries ending in "/" match as prefixes
+}
+
+// defaultUnverifiedPaths are the endpoints an unverified account always needs.
+var defaultUnverifiedPaths = []string{"/logout", "/logout/all", "/email/verify/resend"}
+
+// NewVerificationPolicy returns the policy for the given mode, always allowing the
+// endpoints an unverified account needs in addition to allowedPaths.
+//
+// Params:
+//   - mode: one of the VerificationPolicy constants, or "" for VerificationPolicyOff
+//   - allowedPaths: additional paths unverified accounts may always call
+//
+// Returns:
+//   - VerificationPolicy: the policy to set as Server.VerificationPolicy
+//   - error: an error if the mode is unknown
+func NewVerificationPolicy(mode string, allowedPaths []string) (VerificationPolicy, error) {
+	switch mode {
+	case "":
+		mode = VerificationPolicyOff
+	case VerificationPolicyOff, VerificationPolicyReadOnly, VerificationPolicyStrict:
+	default:
+		return VerificationPolicy{}, fmt.Errorf("unknown email verification policy %q", mode)
+	}
+
+	return VerificationPolicy{
+		Mode:         mode,
+		AllowedPaths: append(append([]string{}, defaultUnverifiedPaths...), allowedPaths...),
+	}, nil
+}
+
+// Allows reports whether an account with an unverified email address may make the request.
+func (p VerificationPolicy) Allows(r *http.Request) bool {
+	if p.Mode == VerificationPolicyOff {
+		return true
+	}
+
+	for _, path := range p.AllowedPaths {
+		if r.URL.Path == path || (strings.HasSuffix(path, "/") && strings.HasPrefix(r.URL.Path, path)) {
+			return true
+		}
+	}
+
+	return p.Mode == VerificationPolicyReadOnly && (r.Method == http.MethodGet || r.Method == http.MethodHead)
+}
+
+// sendVerificationEmail emails a signed verification link to the user, unless one
+// was sent within verificationResendInterval.
+func (s *Server) sendVerificationEmail(ctx context.Context, user *models.User) error {
+	allowed, err := s.Users.ReserveVerificationEmail(ctx, user.ID, verificationResendInterval)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return errVerificationThrottled
+	}
+
+	token, err := s.Keys.GeneratePurposeToken(utils.PurposeVerifyEmail, user.ID, user.Email, verificationTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your AquaMind email address",
+		Body: "Welcome to AquaMind!\n\n" +
+			"Please confirm that this is your email address by opening this link within the next 48 hours:\n" +
+			appLink("/verify-email", token) + "\n\n" +
+			"If you did not create an AquaMind account, you can ignore this email.",
+	})
+}
+
+// VerifyEmailHandler marks the user's email address as verified using the token from a
+// verification email. The link stops working if the account's email has changed since.
+//
+// Method: POST
+// Endpoint: /email/verify
+//
+// Request body (JSON):
+//
+//	{
+//	  "token": "token-from-the-verification-link"
+//	}
+func (s *Server) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := s.Keys.ValidatePurposeToken(req.Token, utils.PurposeVerifyEmail)
+	if err != nil {
+		http.Error(w, "Invalid or expired verification token", http.StatusBadRequest)
+		return
+	}
+
+	err = s.Users.MarkUserVerified(r.Context(), claims.Subject, claims.Email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Invalid or expired verification token", http.StatusBadRequest)
+		} else {
+			log.Printf("Error verifying email for user %s: %v", claims.Subject, err)
+			serverError(w, err, "Error verifying email")
+		}
+		return
+	}
+
+	log.Printf("Email verified for user %s", claims.Subject)
+	s.recordAudit(r, userTarget(models.AuditEmailVerified, claims.Subject, models.OutcomeSuccess))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResendVerificationHandler sends a new verification email to the authenticated user.
+// Requests are throttled to one email per verificationResendInterval.
+//
+// Method: POST
+// Endpoint: /email/verify/resend
+func (s *Server) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	if principal.Verified {
+		http.Error(w, "Email already verified", http.StatusConflict)
+		return
+	}
+
+	user := &models.User{ID: principal.UserID, Email: principal.Email}
+	err := s.sendVerificationEmail(r.Context(), user)
+	if err != nil {
+		if errors.Is(err, errVerificationThrottled) {
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(verificationResendInterval.Seconds())))
+			http.Error(w, "Verification email sent recently, please wait before requesting another", http.StatusTooManyRequests)
+		} else {
+			log.Printf("Error sending verification email to user %s: %v", principal.UserID, err)
+			serverError(w, err, "Error sending verification email")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
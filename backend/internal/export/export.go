@@ -0,0 +1,183 @@
+// Package export assembles a user's personal data into a downloadable ZIP archive.
+// The archive contains JSON files that can be re-imported and CSV files for
+// spreadsheets, described by a manifest carrying the bundle's schema version.
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/stevenpstansberry/AquaMind-AI/internal/models"
+)
+
+// SchemaVersion is the version of the archive layout. It must be incremented whenever
+// a file is added, removed or changes shape, so importers can tell bundles apart.
+const SchemaVersion = 1
+
+// Bundle is everything tied to a user that goes into an export.
+type Bundle struct {
+	Profile   *models.Profile           // The user's profile
+	Aquariums []models.AquariumResponse // Every aquarium of the user, including parameter entries
+}
+
+// Manifest describes the contents of an export archive. It is written as manifest.json.
+type Manifest struct {
+	SchemaVersion int            `json:"schemaVersion"`
+	GeneratedAt   time.Time      `json:"generatedAt"`
+	UserID        string         `json:"userId"`
+	Files         []ManifestFile `json:"files"`
+}
+
+// ManifestFile describes one file in an export archive.
+type ManifestFile struct {
+	Name    string `json:"name"`    // Path of the file inside the archive
+	Format  string `json:"format"`  // "json" or "csv"
+	Records int    `json:"records"` // Number of records in the file
+	SHA256  string `json:"sha256"`  // Hex encoded SHA-256 of the file contents
+}
+
+// exportedAquarium is an aquarium without its parameter entries, which are exported separately.
+type exportedAquarium struct {
+	ID        string             `json:"id"`
+	Name      string             `json:"name"`
+	Type      string             `json:"type"`
+	Size      string             `json:"size"`
+	Species   []models.Species   `json:"species"`
+	Plants    []models.Plant     `json:"plants"`
+	Equipment []models.Equipment `json:"equipment"`
+}
+
+// archiveWriter writes files to a ZIP archive while recording them for the manifest.
+type archiveWriter struct {
+	zip   *zip.Writer
+	files []ManifestFile
+}
+
+func (a *archiveWriter) add(name string, format string, records int, data []byte) error {
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()}
+	f, err := a.zip.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	a.files = append(a.files, ManifestFile{Name: name, Format: format, Records: records, SHA256: hex.EncodeToString(sum[:])})
+	return nil
+}
+
+func (a *archiveWriter) addJSON(name string, records int, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return a.add(name, "json", records, data)
+}
+
+func (a *archiveWriter) addCSV(name string, rows [][]string) error {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return a.add(name, "csv", len(rows)-1, buf.Bytes())
+}
+
+// formatFloat formats an optional measurement for CSV, leaving missing values empty.
+func formatFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
+
+// WriteArchive writes the bundle to w as a ZIP archive.
+//
+// Params:
+//   - w: the destination of the archive.
+//   - bundle: the user's data.
+//
+// Returns:
+//   - error: an error if any file cannot be encoded or written.
+func WriteArchive(w io.Writer, bundle Bundle) error {
+	archive := &archiveWriter{zip: zip.NewWriter(w)}
+
+	aquariums := make([]exportedAquarium, 0, len(bundle.Aquariums))
+	var entries []models.WaterParameterEntry
+	aquariumRows := [][]string{{"id", "name", "type", "size", "species_count", "plant_count", "equipment_count"}}
+	stockRows := [][]string{{"aquarium_id", "kind", "item_id", "name", "count"}}
+	entryRows := [][]string{{"id", "aquarium_id", "timestamp", "recorded_at", "temperature", "ph", "hardness"}}
+
+	for _, aquarium := range bundle.Aquariums {
+		aquariums = append(aquariums, exportedAquarium{
+			ID:        aquarium.ID,
+			Name:      aquarium.Name,
+			Type:      aquarium.Type,
+			Size:      aquarium.Size,
+			Species:   aquarium.Species,
+			Plants:    aquarium.Plants,
+			Equipment: aquarium.Equipment,
+		})
+		aquariumRows = append(aquariumRows, []string{
+			aquarium.ID, aquarium.Name, aquarium.Type, aquarium.Size,
+			strconv.Itoa(len(aquarium.Species)), strconv.Itoa(len(aquarium.Plants)), strconv.Itoa(len(aquarium.Equipment)),
+		})
+
+		for _, species := range aquarium.Species {
+			stockRows = append(stockRows, []string{aquarium.ID, "species", species.Id, species.Name, strconv.Itoa(species.Count)})
+		}
+		for _, plant := range aquarium.Plants {
+			stockRows = append(stockRows, []string{aquarium.ID, "plant", plant.Id, plant.Name, strconv.Itoa(plant.Count)})
+		}
+		for _, equipment := range aquarium.Equipment {
+			stockRows = append(stockRows, []string{aquarium.ID, "equipment", equipment.Id, equipment.Name, "1"})
+		}
+
+		for _, entry := range aquarium.ParameterEntries {
+			entries = append(entries, entry)
+			entryRows = append(entryRows, []string{
+				entry.ID, entry.AquariumID, strconv.FormatInt(entry.Timestamp, 10),
+				time.Unix(entry.Timestamp, 0).UTC().Format(time.RFC3339),
+				formatFloat(entry.Temperature), formatFloat(entry.Ph), formatFloat(entry.Hardness),
+			})
+		}
+	}
+	if entries == nil {
+		entries = []models.WaterParameterEntry{}
+	}
+
+	steps := []func() error{
+		func() error { return archive.addJSON("profile.json", 1, bundle.Profile) },
+		func() error { return archive.addJSON("aquariums.json", len(aquariums), aquariums) },
+		func() error { return archive.addJSON("parameter_entries.json", len(entries), entries) },
+		func() error { return archive.addCSV("csv/aquariums.csv", aquariumRows) },
+		func() error { return archive.addCSV("csv/stock.csv", stockRows) },
+		func() error { return archive.addCSV("csv/parameter_entries.csv", entryRows) },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+
+	manifest := Manifest{
+		SchemaVersion: SchemaVersion,
+		GeneratedAt:   time.Now().UTC(),
+		UserID:        bundle.Profile.ID,
+		Files:         archive.files,
+	}
+	if err := archive.addJSON("manifest.json", len(manifest.Files), manifest); err != nil {
+		return err
+	}
+
+	return archive.zip.Close()
+}
@@ -0,0 +1,117 @@
+// Package mail provides outgoing email delivery for the auth service. Handlers
+// send messages through the Mailer interface so that SMTP delivery can be
+// swapped for a file or log based mailer during local development and tests.
+package mail
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string // Recipient address
+	Subject string // Subject line
+	Body    string // Plain-text body
+}
+
+// Mailer delivers email messages.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SMTPMailer delivers messages through an SMTP server.
+type SMTPMailer struct {
+	Host     string // SMTP server host name
+	Port     string // SMTP server port
+	Username string // Username for PLAIN authentication, empty to skip authentication
+	Password string // Password for PLAIN authentication
+	From     string // Sender address
+}
+
+// Send delivers the message through the configured SMTP server.
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	body := strings.Join([]string{
+		"From: " + m.From,
+		"To: " + msg.To,
+		"Subject: " + msg.Subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		msg.Body,
+	}, "\r\n")
+
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{msg.To}, []byte(body))
+}
+
+// LogMailer records messages instead of delivering them. If Dir is set, each message
+// is written to its own file in that directory; otherwise it is written to the log.
+type LogMailer struct {
+	Dir string // Directory to write messages to, empty to log them
+
+	mu sync.Mutex
+}
+
+// unsafeFileChars matches characters not allowed in message file names.
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9@._-]`)
+
+// Send records the message.
+func (m *LogMailer) Send(msg Message) error {
+	text := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", msg.To, msg.Subject, msg.Body)
+
+	if m.Dir == "" {
+		log.Printf("Email not delivered (log mailer):\n%s", text)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := fmt.Sprintf("%d-%s.txt", time.Now().UnixNano(), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	return os.WriteFile(filepath.Join(m.Dir, name), []byte(text), 0o600)
+}
+
+// NewMailerFromEnv builds the mailer selected by MAIL_DRIVER:
+//   - "smtp": an SMTPMailer configured from SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD and MAIL_FROM.
+//   - "log" or unset: a LogMailer writing to MAIL_DIR, or to the log if MAIL_DIR is unset.
+func NewMailerFromEnv() (Mailer, error) {
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "smtp":
+		mailer := &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+		if mailer.Host == "" || mailer.From == "" {
+			return nil, fmt.Errorf("SMTP_HOST and MAIL_FROM must be set for the smtp mail driver")
+		}
+		if mailer.Port == "" {
+			mailer.Port = "587"
+		}
+		return mailer, nil
+	case "", "log":
+		dir := os.Getenv("MAIL_DIR")
+		if dir != "" {
+			if err := os.MkdirAll(dir, 0o700); err != nil {
+				return nil, fmt.Errorf("creating mail directory: %w", err)
+			}
+		}
+		return &LogMailer{Dir: dir}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", driver)
+	}
+}
@@ -0,0 +1,6 @@
+DROP TABLE parameter_entries;
+DROP TABLE aquariums;
+DROP TABLE equipment;
+DROP TABLE plants;
+DROP TABLE species;
+DROP TABLE users;
@@ -0,0 +1,98 @@
+-- Tables that predate versioned migrations. IF NOT EXISTS lets databases created
+-- before migrations were introduced adopt this history without changes.
+
+-- gen_random_uuid() is built in from PostgreSQL 13; older servers need pgcrypto
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+CREATE TABLE IF NOT EXISTS users (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    email      TEXT NOT NULL UNIQUE,
+    password   TEXT NOT NULL,
+    first_name TEXT NOT NULL DEFAULT '',
+    username   TEXT,
+    subscribe  BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS species (
+    id                       TEXT PRIMARY KEY,
+    name                     TEXT NOT NULL,
+    image_url                TEXT,
+    role                     TEXT NOT NULL,
+    type                     TEXT NOT NULL,
+    description              TEXT NOT NULL,
+    feeding_habits           TEXT NOT NULL,
+    tank_requirements        TEXT NOT NULL,
+    compatibility            TEXT NOT NULL,
+    lifespan                 TEXT,
+    size                     TEXT,
+    water_parameters         TEXT,
+    breeding_info            TEXT,
+    behavior                 TEXT,
+    care_level               TEXT,
+    dietary_restrictions     TEXT,
+    native_habitat           TEXT,
+    stocking_recommendations TEXT,
+    special_considerations   TEXT,
+    min_tank_size            INTEGER NOT NULL,
+    scientific_name          TEXT,
+    wikipedia_link           TEXT
+);
+
+CREATE TABLE IF NOT EXISTS plants (
+    id                     TEXT PRIMARY KEY,
+    name                   TEXT NOT NULL,
+    role                   TEXT NOT NULL,
+    type                   TEXT NOT NULL,
+    description            TEXT NOT NULL,
+    tank_requirements      TEXT NOT NULL,
+    min_tank_size          INTEGER NOT NULL,
+    compatibility          TEXT NOT NULL,
+    lifespan               TEXT,
+    size                   TEXT,
+    water_parameters       TEXT,
+    lighting_needs         TEXT,
+    growth_rate            TEXT,
+    care_level             TEXT,
+    native_habitat         TEXT,
+    propagation_methods    TEXT,
+    special_considerations TEXT,
+    image_url              TEXT,
+    scientific_name        TEXT,
+    wikipedia_link         TEXT
+);
+
+CREATE TABLE IF NOT EXISTS equipment (
+    id                     TEXT PRIMARY KEY,
+    name                   TEXT NOT NULL,
+    description            TEXT NOT NULL,
+    role                   TEXT NOT NULL,
+    importance             TEXT NOT NULL,
+    usage                  TEXT NOT NULL,
+    special_considerations TEXT,
+    fields                 JSONB NOT NULL DEFAULT '[]',
+    type                   TEXT NOT NULL
+);
+
+-- Species, plants and equipment are stored as JSON arrays of catalog references
+CREATE TABLE IF NOT EXISTS aquariums (
+    id        UUID PRIMARY KEY,
+    user_id   UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name      TEXT NOT NULL,
+    type      TEXT NOT NULL DEFAULT '',
+    size      TEXT NOT NULL DEFAULT '',
+    species   JSONB NOT NULL DEFAULT '[]',
+    plants    JSONB NOT NULL DEFAULT '[]',
+    equipment JSONB NOT NULL DEFAULT '[]'
+);
+CREATE INDEX IF NOT EXISTS aquariums_user_id_idx ON aquariums (user_id);
+
+CREATE TABLE IF NOT EXISTS parameter_entries (
+    id          UUID PRIMARY KEY,
+    aquarium_id UUID NOT NULL REFERENCES aquariums(id) ON DELETE CASCADE,
+    timestamp   BIGINT NOT NULL,
+    temperature DOUBLE PRECISION,
+    ph          DOUBLE PRECISION,
+    hardness    DOUBLE PRECISION
+);
+CREATE INDEX IF NOT EXISTS parameter_entries_aquarium_id_idx ON parameter_entries (aquarium_id, timestamp);
@@ -0,0 +1,12 @@
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'verified_at'
+    ) THEN
+        ALTER TABLE users ADD COLUMN verified_at TIMESTAMPTZ;
+        -- Accounts that existed before verification was introduced are trusted
+        UPDATE users SET verified_at = now();
+    END IF;
+END $$;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS verification_sent_at TIMESTAMPTZ;
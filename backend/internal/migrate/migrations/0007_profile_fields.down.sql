@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN profile_picture_url;
+ALTER TABLE users DROP COLUMN bio;
@@ -0,0 +1,2 @@
+DROP TABLE aquarium_invitations;
+DROP TABLE aquarium_members;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS aquarium_members (
+    aquarium_id UUID NOT NULL REFERENCES aquariums(id) ON DELETE CASCADE,
+    user_id     UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role        TEXT NOT NULL CHECK (role IN ('viewer', 'editor', 'owner')),
+    invited_by  UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (aquarium_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS aquarium_members_user_id_idx ON aquarium_members (user_id);
+
+CREATE TABLE IF NOT EXISTS aquarium_invitations (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    aquarium_id UUID NOT NULL REFERENCES aquariums(id) ON DELETE CASCADE,
+    email       TEXT NOT NULL,
+    role        TEXT NOT NULL CHECK (role IN ('viewer', 'editor', 'owner')),
+    token_hash  TEXT NOT NULL UNIQUE,
+    invited_by  UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at  TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS aquarium_invitations_aquarium_id_idx ON aquarium_invitations (aquarium_id);
@@ -0,0 +1 @@
+DROP TABLE aquarium_share_links;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS aquarium_share_links (
+    id           UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    aquarium_id  UUID NOT NULL REFERENCES aquariums(id) ON DELETE CASCADE,
+    token_hash   TEXT NOT NULL UNIQUE,
+    created_by   UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS aquarium_share_links_aquarium_id_idx ON aquarium_share_links (aquarium_id);
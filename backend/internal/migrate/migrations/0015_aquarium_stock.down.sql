@@ -0,0 +1,61 @@
+ALTER TABLE aquariums
+    ADD COLUMN IF NOT EXISTS species JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN IF NOT EXISTS plants JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN IF NOT EXISTS equipment JSONB NOT NULL DEFAULT '[]';
+
+-- Items moved to aquarium_stock_unmatched return to their place in the arrays.
+UPDATE aquariums a SET
+    species = COALESCE((
+        SELECT jsonb_agg(stock.item ORDER BY stock.position)
+        FROM (
+            SELECT jsonb_build_object('id', s.species_id, 'count', s.count, 'name', c.name) AS item, s.position
+            FROM aquarium_species s
+            JOIN species c ON c.id = s.species_id
+            WHERE s.aquarium_id = a.id
+            UNION ALL
+            SELECT u.item, u.position
+            FROM aquarium_stock_unmatched u
+            WHERE u.aquarium_id = a.id AND u.kind = 'species'
+        ) stock
+    ), '[]'),
+    plants = COALESCE((
+        SELECT jsonb_agg(stock.item ORDER BY stock.position)
+        FROM (
+            SELECT jsonb_build_object('id', p.plant_id, 'count', p.count, 'name', c.name) AS item, p.position
+            FROM aquarium_plants p
+            JOIN plants c ON c.id = p.plant_id
+            WHERE p.aquarium_id = a.id
+            UNION ALL
+            SELECT u.item, u.position
+            FROM aquarium_stock_unmatched u
+            WHERE u.aquarium_id = a.id AND u.kind = 'plant'
+        ) stock
+    ), '[]'),
+    equipment = COALESCE((
+        SELECT jsonb_agg(stock.item ORDER BY stock.position)
+        FROM (
+            SELECT jsonb_build_object(
+                'id', c.id,
+                'name', c.name,
+                'description', c.description,
+                'role', c.role,
+                'importance', c.importance,
+                'usage', c.usage,
+                'specialConsiderations', c.special_considerations,
+                'fields', COALESCE(e.fields, c.fields),
+                'type', c.type
+            ) AS item, e.position
+            FROM aquarium_equipment e
+            JOIN equipment c ON c.id = e.equipment_id
+            WHERE e.aquarium_id = a.id
+            UNION ALL
+            SELECT u.item, u.position
+            FROM aquarium_stock_unmatched u
+            WHERE u.aquarium_id = a.id AND u.kind = 'equipment'
+        ) stock
+    ), '[]');
+
+DROP TABLE aquarium_stock_unmatched;
+DROP TABLE aquarium_equipment;
+DROP TABLE aquarium_plants;
+DROP TABLE aquarium_species;
@@ -0,0 +1,110 @@
+-- The species, plants and equipment of an aquarium reference the catalog through foreign
+-- keys instead of JSON arrays. Catalog rows in use cannot be deleted, and their names are
+-- always read from the catalog. position keeps the order in which the user listed them.
+CREATE TABLE IF NOT EXISTS aquarium_species (
+    aquarium_id UUID NOT NULL REFERENCES aquariums(id) ON DELETE CASCADE,
+    species_id  TEXT NOT NULL REFERENCES species(id) ON UPDATE CASCADE ON DELETE RESTRICT,
+    count       INTEGER NOT NULL DEFAULT 1,
+    position    INTEGER NOT NULL,
+    PRIMARY KEY (aquarium_id, species_id)
+);
+CREATE INDEX IF NOT EXISTS aquarium_species_species_id_idx ON aquarium_species (species_id);
+
+CREATE TABLE IF NOT EXISTS aquarium_plants (
+    aquarium_id UUID NOT NULL REFERENCES aquariums(id) ON DELETE CASCADE,
+    plant_id    TEXT NOT NULL REFERENCES plants(id) ON UPDATE CASCADE ON DELETE RESTRICT,
+    count       INTEGER NOT NULL DEFAULT 1,
+    position    INTEGER NOT NULL,
+    PRIMARY KEY (aquarium_id, plant_id)
+);
+CREATE INDEX IF NOT EXISTS aquarium_plants_plant_id_idx ON aquarium_plants (plant_id);
+
+-- The same equipment may be installed more than once. fields holds the settings the user
+-- entered for this installation; NULL shows the fields of the catalog entry.
+CREATE TABLE IF NOT EXISTS aquarium_equipment (
+    aquarium_id  UUID NOT NULL REFERENCES aquariums(id) ON DELETE CASCADE,
+    position     INTEGER NOT NULL,
+    equipment_id TEXT NOT NULL REFERENCES equipment(id) ON UPDATE CASCADE ON DELETE RESTRICT,
+    fields       JSONB,
+    PRIMARY KEY (aquarium_id, position)
+);
+CREATE INDEX IF NOT EXISTS aquarium_equipment_equipment_id_idx ON aquarium_equipment (equipment_id);
+
+-- Copy the JSON arrays, which are null for aquariums saved without any items. References
+-- to catalog rows that no longer exist were already hidden from users and are moved to
+-- aquarium_stock_unmatched below; an ID listed twice keeps its first position and the
+-- count listed last.
+INSERT INTO aquarium_species (aquarium_id, species_id, count, position)
+SELECT a.id, c.id,
+       (array_agg(COALESCE((item.value->>'count')::integer, 1) ORDER BY item.position DESC))[1],
+       min(item.position)::integer
+FROM aquariums a
+CROSS JOIN LATERAL jsonb_array_elements(CASE jsonb_typeof(a.species) WHEN 'array' THEN a.species ELSE '[]' END) WITH ORDINALITY AS item(value, position)
+JOIN species c ON c.id = item.value->>'id'
+GROUP BY a.id, c.id
+ON CONFLICT DO NOTHING;
+
+INSERT INTO aquarium_plants (aquarium_id, plant_id, count, position)
+SELECT a.id, c.id,
+       (array_agg(COALESCE((item.value->>'count')::integer, 1) ORDER BY item.position DESC))[1],
+       min(item.position)::integer
+FROM aquariums a
+CROSS JOIN LATERAL jsonb_array_elements(CASE jsonb_typeof(a.plants) WHEN 'array' THEN a.plants ELSE '[]' END) WITH ORDINALITY AS item(value, position)
+JOIN plants c ON c.id = item.value->>'id'
+GROUP BY a.id, c.id
+ON CONFLICT DO NOTHING;
+
+INSERT INTO aquarium_equipment (aquarium_id, position, equipment_id, fields)
+SELECT a.id, item.position::integer, c.id, NULLIF(item.value->'fields', 'null'::jsonb)
+FROM aquariums a
+CROSS JOIN LATERAL jsonb_array_elements(CASE jsonb_typeof(a.equipment) WHEN 'array' THEN a.equipment ELSE '[]' END) WITH ORDINALITY AS item(value, position)
+JOIN equipment c ON c.id = item.value->>'id'
+ON CONFLICT DO NOTHING;
+
+-- Items referencing catalog rows that no longer exist are kept as they were listed, so
+-- that they can be restored should the catalog rows return. position is the position of
+-- the item in its JSON array.
+CREATE TABLE IF NOT EXISTS aquarium_stock_unmatched (
+    aquarium_id UUID NOT NULL REFERENCES aquariums(id) ON DELETE CASCADE,
+    kind        TEXT NOT NULL CHECK (kind IN ('species', 'plant', 'equipment')),
+    position    INTEGER NOT NULL,
+    item        JSONB NOT NULL,
+    PRIMARY KEY (aquarium_id, kind, position)
+);
+
+INSERT INTO aquarium_stock_unmatched (aquarium_id, kind, position, item)
+SELECT a.id, 'species', item.position::integer, item.value
+FROM aquariums a
+CROSS JOIN LATERAL jsonb_array_elements(CASE jsonb_typeof(a.species) WHEN 'array' THEN a.species ELSE '[]' END) WITH ORDINALITY AS item(value, position)
+WHERE NOT EXISTS (SELECT 1 FROM species c WHERE c.id = item.value->>'id')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO aquarium_stock_unmatched (aquarium_id, kind, position, item)
+SELECT a.id, 'plant', item.position::integer, item.value
+FROM aquariums a
+CROSS JOIN LATERAL jsonb_array_elements(CASE jsonb_typeof(a.plants) WHEN 'array' THEN a.plants ELSE '[]' END) WITH ORDINALITY AS item(value, position)
+WHERE NOT EXISTS (SELECT 1 FROM plants c WHERE c.id = item.value->>'id')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO aquarium_stock_unmatched (aquarium_id, kind, position, item)
+SELECT a.id, 'equipment', item.position::integer, item.value
+FROM aquariums a
+CROSS JOIN LATERAL jsonb_array_elements(CASE jsonb_typeof(a.equipment) WHEN 'array' THEN a.equipment ELSE '[]' END) WITH ORDINALITY AS item(value, position)
+WHERE NOT EXISTS (SELECT 1 FROM equipment c WHERE c.id = item.value->>'id')
+ON CONFLICT DO NOTHING;
+
+DO $$
+DECLARE
+    unmatched BIGINT;
+BEGIN
+    SELECT count(*) INTO unmatched FROM aquarium_stock_unmatched;
+    IF unmatched > 0 THEN
+        RAISE NOTICE '% aquarium items reference catalog rows that no longer exist and were moved to aquarium_stock_unmatched', unmatched;
+    END IF;
+END
+$$;
+
+ALTER TABLE aquariums
+    DROP COLUMN IF EXISTS species,
+    DROP COLUMN IF EXISTS plants,
+    DROP COLUMN IF EXISTS equipment;
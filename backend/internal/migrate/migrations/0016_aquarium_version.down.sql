@@ -0,0 +1 @@
+ALTER TABLE aquariums DROP COLUMN version;
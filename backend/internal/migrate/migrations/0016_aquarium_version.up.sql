@@ -0,0 +1,3 @@
+-- Incremented by every update of an aquarium, so that clients can tell whether the
+-- aquarium changed since they read it.
+ALTER TABLE aquariums ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
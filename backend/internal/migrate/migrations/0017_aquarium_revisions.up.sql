@@ -0,0 +1,45 @@
+-- Every change of an aquarium is recorded as a revision, numbered by the version of the
+-- aquarium it produced. snapshot holds the aquarium as the change left it, and changes
+-- how it differs from the previous revision.
+CREATE TABLE IF NOT EXISTS aquarium_revisions (
+    aquarium_id   UUID NOT NULL REFERENCES aquariums(id) ON DELETE CASCADE,
+    version       BIGINT NOT NULL,
+    actor_id      UUID REFERENCES users(id) ON DELETE SET NULL,
+    action        TEXT NOT NULL,
+    restored_from BIGINT,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    snapshot      JSONB NOT NULL,
+    changes       JSONB NOT NULL DEFAULT '{}',
+    PRIMARY KEY (aquarium_id, version)
+);
+CREATE INDEX IF NOT EXISTS aquarium_revisions_created_at_idx ON aquarium_revisions (aquarium_id, created_at);
+
+-- The history of existing aquariums starts from their current state.
+INSERT INTO aquarium_revisions (aquarium_id, version, action, snapshot)
+SELECT a.id, a.version, 'baseline', jsonb_build_object(
+    'name', a.name,
+    'type', a.type,
+    'size', a.size,
+    'species', COALESCE((
+        SELECT jsonb_agg(jsonb_build_object('id', s.species_id, 'count', s.count, 'name', c.name) ORDER BY s.position)
+        FROM aquarium_species s
+        JOIN species c ON c.id = s.species_id
+        WHERE s.aquarium_id = a.id
+    ), '[]'),
+    'plants', COALESCE((
+        SELECT jsonb_agg(jsonb_build_object('id', p.plant_id, 'count', p.count, 'name', c.name) ORDER BY p.position)
+        FROM aquarium_plants p
+        JOIN plants c ON c.id = p.plant_id
+        WHERE p.aquarium_id = a.id
+    ), '[]'),
+    'equipment', COALESCE((
+        SELECT jsonb_agg(jsonb_build_object('id', e.equipment_id, 'name', c.name)
+            || CASE WHEN e.fields IS NULL THEN '{}' ELSE jsonb_build_object('fields', e.fields) END
+            ORDER BY e.position)
+        FROM aquarium_equipment e
+        JOIN equipment c ON c.id = e.equipment_id
+        WHERE e.aquarium_id = a.id
+    ), '[]')
+)
+FROM aquariums a
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,140 @@
+// models/access_token.go
+
+package models
+
+import (
+    "context"
+    "database/sql"
+    "time"
+
+    "github.com/lib/pq"
+)
+
+// PersonalAccessToken is a long-lived, revocable token a user mints for scripts and
+// devices. It grants only its scopes and, if AquariumID is set, only that aquarium.
+// Only the SHA-256 hash of the token is stored.
+//
+// The schema is defined by migration 0011_personal_access_tokens in internal/migrate.
+type PersonalAccessToken struct {
+    ID         string     `json:"id"`         // Unique identifier of the token
+    UserID     string     `json:"-"`          // Owner of the token
+    Name       string     `json:"name"`       // Label chosen by the user, e.g. "tank sensor"
+    Scopes     []string   `json:"scopes"`     // Permissions granted to the token
+    AquariumID string     `json:"aquariumId"` // The only aquarium the token may access, or "" for all
+    ExpiresAt  *time.Time `json:"expiresAt"`  // When the token stops working, nil if it never expires
+    LastUsedAt *time.Time `json:"lastUsedAt"` // When the token last authenticated a request
+    CreatedAt  time.Time  `json:"createdAt"`  // When the token was minted
+}
+
+// accessTokenColumns lists the columns scanned by scanAccessToken.
+const accessTokenColumns = `id, user_id, name, scopes, COALESCE(aquarium_id::text, ''), expires_at, last_used_at, created_at`
+
+// scanAccessToken scans a row selected with accessTokenColumns.
+func scanAccessToken(row rowScanner) (*PersonalAccessToken, error) {
+    var token PersonalAccessToken
+    err := row.Scan(
+        &token.ID,
+        &token.UserID,
+        &token.Name,
+        pq.Array(&token.Scopes),
+        &token.AquariumID,
+        &token.ExpiresAt,
+        &token.LastUsedAt,
+        &token.CreatedAt,
+    )
+    if err != nil {
+        return nil, err
+    }
+    return &token, nil
+}
+
+// CreatePersonalAccessToken stores a new personal access token, setting its ID and creation time.
+//
+// Params:
+//   - token: the token to store; ID and CreatedAt are filled in
+//   - tokenHash: the hash of the token value handed to the user
+//
+// Returns:
+//   - error: an error if the insert operation fails, otherwise nil
+func (s *PostgresStore) CreatePersonalAccessToken(ctx context.Context, token *PersonalAccessToken, tokenHash string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        INSERT INTO personal_access_tokens (user_id, name, token_hash, scopes, aquarium_id, expires_at)
+        VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid, $6)
+        RETURNING id, created_at
+    `
+    return queryError(ctx, s.db.QueryRowContext(ctx, query, token.UserID, token.Name, tokenHash, pq.Array(token.Scopes), token.AquariumID, token.ExpiresAt).
+        Scan(&token.ID, &token.CreatedAt))
+}
+
+// GetPersonalAccessTokenByHash looks up an unrevoked personal access token by the hash of its value.
+func (s *PostgresStore) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*PersonalAccessToken, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `SELECT ` + accessTokenColumns + ` FROM personal_access_tokens WHERE token_hash = $1 AND revoked_at IS NULL`
+    token, err := scanAccessToken(s.db.QueryRowContext(ctx, query, tokenHash))
+    return token, queryError(ctx, err)
+}
+
+// ListPersonalAccessTokens retrieves the unrevoked personal access tokens of a user.
+func (s *PostgresStore) ListPersonalAccessTokens(ctx context.Context, userID string) ([]PersonalAccessToken, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `SELECT ` + accessTokenColumns + ` FROM personal_access_tokens WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at`
+    rows, err := s.db.QueryContext(ctx, query, userID)
+    if err != nil {
+        return nil, queryError(ctx, err)
+    }
+    defer rows.Close()
+
+    tokens := []PersonalAccessToken{}
+    for rows.Next() {
+        token, err := scanAccessToken(rows)
+        if err != nil {
+            return nil, queryError(ctx, err)
+        }
+        tokens = append(tokens, *token)
+    }
+    return tokens, queryError(ctx, rows.Err())
+}
+
+// TouchPersonalAccessToken records that a token was used. To avoid a write on every
+// request, the timestamp is only advanced once a minute.
+func (s *PostgresStore) TouchPersonalAccessToken(ctx context.Context, tokenID string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        UPDATE personal_access_tokens SET last_used_at = now()
+        WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute')
+    `
+    _, err := s.db.ExecContext(ctx, query, tokenID)
+    return queryError(ctx, err)
+}
+
+// RevokePersonalAccessToken revokes a personal access token belonging to the given user.
+// It returns sql.ErrNoRows if no unrevoked token matched.
+func (s *PostgresStore) RevokePersonalAccessToken(ctx context.Context, tokenID string, userID string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `UPDATE personal_access_tokens SET revoked_at = now() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+    result, err := s.db.ExecContext(ctx, query, tokenID, userID)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    if rowsAffected == 0 {
+        return sql.ErrNoRows
+    }
+
+    return nil
+}
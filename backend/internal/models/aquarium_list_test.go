@@ -0,0 +1,137 @@
+package models
+
+import (
+    "context"
+    "database/sql"
+    "database/sql/driver"
+    "errors"
+    "fmt"
+    "io"
+    "strings"
+    "sync/atomic"
+    "testing"
+)
+
+// countingConnector opens connections to a fake database that answers the aquarium list
+// query with a fixed number of aquariums, answers every other query with no rows, and
+// counts the queries it receives.
+type countingConnector struct {
+    aquariums int
+    queries   atomic.Int64
+}
+
+func (c *countingConnector) Connect(context.Context) (driver.Conn, error) {
+    return &countingConn{connector: c}, nil
+}
+
+func (c *countingConnector) Driver() driver.Driver {
+    return countingDriver{}
+}
+
+type countingDriver struct{}
+
+func (countingDriver) Open(string) (driver.Conn, error) {
+    return nil, errors.New("countingDriver: use the connector")
+}
+
+type countingConn struct {
+    connector *countingConnector
+}
+
+func (c *countingConn) Prepare(string) (driver.Stmt, error) {
+    return nil, errors.New("countingConn: prepared statements are not supported")
+}
+
+func (c *countingConn) Close() error {
+    return nil
+}
+
+func (c *countingConn) Begin() (driver.Tx, error) {
+    return nil, errors.New("countingConn: transactions are not supported")
+}
+
+func (c *countingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+    c.connector.queries.Add(1)
+
+    if !strings.Contains(query, "FROM aquariums a") {
+        return &cannedRows{}, nil
+    }
+    rows := &cannedRows{columns: []string{"id", "user_id", "role", "version", "name", "type", "size"}}
+    for i := 0; i < c.connector.aquariums; i++ {
+        id := fmt.Sprintf("00000000-0000-0000-0000-%012d", i)
+        rows.values = append(rows.values, []driver.Value{id, "user-1", "owner", int64(1), fmt.Sprintf("Tank %d", i), "freshwater", "20"})
+    }
+    return rows, nil
+}
+
+type cannedRows struct {
+    columns []string
+    values  [][]driver.Value
+}
+
+func (r *cannedRows) Columns() []string {
+    return r.columns
+}
+
+func (r *cannedRows) Close() error {
+    return nil
+}
+
+func (r *cannedRows) Next(dest []driver.Value) error {
+    if len(r.values) == 0 {
+        return io.EOF
+    }
+    copy(dest, r.values[0])
+    r.values = r.values[1:]
+    return nil
+}
+
+// countAquariumListQueries lists the aquariums of a user owning the given number of
+// aquariums and returns how many queries it took.
+func countAquariumListQueries(t testing.TB, aquariums int, options AquariumListOptions) int64 {
+    connector := &countingConnector{aquariums: aquariums}
+    db := sql.OpenDB(connector)
+    defer db.Close()
+
+    listed, err := NewPostgresStore(db, 0).GetAquariumsByUserID(context.Background(), "user-1", options)
+    if err != nil {
+        t.Fatalf("GetAquariumsByUserID: %v", err)
+    }
+    if len(listed) != aquariums {
+        t.Fatalf("GetAquariumsByUserID listed %d aquariums, want %d", len(listed), aquariums)
+    }
+    return connector.queries.Load()
+}
+
+// The number of queries listing aquariums takes must not grow with the number of
+// aquariums: stock and parameter entries are retrieved for all of them at once.
+func TestGetAquariumsByUserIDQueryCount(t *testing.T) {
+    const maxQueries = 5
+
+    for _, options := range []AquariumListOptions{
+        {},
+        {IncludeParameters: true, ParameterLimit: 10},
+    } {
+        one := countAquariumListQueries(t, 1, options)
+        many := countAquariumListQueries(t, 15, options)
+
+        if many != one {
+            t.Errorf("options %+v: listing 15 aquariums took %d queries, listing 1 took %d", options, many, one)
+        }
+        if many > maxQueries {
+            t.Errorf("options %+v: listing 15 aquariums took %d queries, want at most %d", options, many, maxQueries)
+        }
+    }
+}
+
+func BenchmarkGetAquariumsByUserID(b *testing.B) {
+    for _, aquariums := range []int{1, 15} {
+        b.Run(fmt.Sprintf("%d aquariums", aquariums), func(b *testing.B) {
+            var queries int64
+            for i := 0; i < b.N; i++ {
+                queries += countAquariumListQueries(b, aquariums, AquariumListOptions{IncludeParameters: true})
+            }
+            b.ReportMetric(float64(queries)/float64(b.N), "queries/op")
+        })
+    }
+}
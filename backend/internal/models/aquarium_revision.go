@@ -0,0 +1,456 @@
+// models/aquarium_revision.go
+
+package models
+
+import (
+    "bytes"
+    "context"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "time"
+)
+
+// Every change of an aquarium is recorded as a revision, in the same transaction as the
+// change. A revision is numbered by the version of the aquarium it produced and holds the
+// aquarium as the change left it, who made the change and how it differs from the
+// previous revision. Revisions are deleted with their aquarium.
+//
+// The schema is defined by migration 0017_aquarium_revisions in internal/migrate.
+
+// Actions recorded by aquarium revisions.
+const (
+    RevisionCreate   = "create"   // The aquarium was created
+    RevisionUpdate   = "update"   // The aquarium was replaced or patched
+    RevisionStock    = "stock"    // Some of one species or plant was added or removed
+    RevisionRestore  = "restore"  // The aquarium was restored to an earlier revision
+    RevisionBaseline = "baseline" // The state of an aquarium when revisions were first recorded
+)
+
+// AquariumEquipment is an equipment item installed in an aquarium, as recorded by revisions.
+type AquariumEquipment struct {
+    Id     string          `json:"id"`
+    Name   string          `json:"name"`
+    Fields json.RawMessage `json:"fields,omitempty"` // Fields entered for the aquarium, if any
+}
+
+// AquariumSnapshot is the state of an aquarium recorded by a revision. Names are those
+// the catalog had at the time.
+type AquariumSnapshot struct {
+    Name      string              `json:"name"`
+    Type      string              `json:"type"`
+    Size      string              `json:"size"`
+    Species   []AquariumSpecies   `json:"species"`
+    Plants    []AquariumPlant     `json:"plants"`
+    Equipment []AquariumEquipment `json:"equipment"`
+}
+
+// FieldChange is the change of a field of an aquarium, such as its size.
+type FieldChange struct {
+    Field string `json:"field"`
+    From  string `json:"from"`
+    To    string `json:"to"`
+}
+
+// StockChange is the change of the count of a species or plant; a count of 0 means the
+// aquarium did not keep it.
+type StockChange struct {
+    Id   string `json:"id"`
+    Name string `json:"name"`
+    From int    `json:"from"`
+    To   int    `json:"to"`
+}
+
+// AquariumChanges is how a revision differs from the previous one.
+type AquariumChanges struct {
+    Fields           []FieldChange       `json:"fields,omitempty"`
+    Species          []StockChange       `json:"species,omitempty"`
+    Plants           []StockChange       `json:"plants,omitempty"`
+    EquipmentAdded   []AquariumEquipment `json:"equipmentAdded,omitempty"`
+    EquipmentRemoved []AquariumEquipment `json:"equipmentRemoved,omitempty"`
+}
+
+// AquariumRevision is a recorded change of an aquarium.
+type AquariumRevision struct {
+    AquariumID   string            `json:"aquariumId"`
+    Version      int64             `json:"version"`                // Version of the aquarium the change produced
+    ActorID      string            `json:"actorId"`                // User who made the change, "" if unknown
+    Action       string            `json:"action"`                 // One of the Revision action constants
+    RestoredFrom int64             `json:"restoredFrom,omitempty"` // Version restored, for restores
+    CreatedAt    time.Time         `json:"createdAt"`
+    Changes      AquariumChanges   `json:"changes"`
+    Snapshot     *AquariumSnapshot `json:"snapshot,omitempty"` // Set only when retrieving a single revision
+}
+
+// Aquarium returns the aquarium with the given ID as recorded by the snapshot, ready to be
+// saved by UpdateAquarium.
+func (snapshot *AquariumSnapshot) Aquarium(id string) Aquarium {
+    aquarium := Aquarium{
+        ID:      id,
+        Name:    snapshot.Name,
+        Type:    snapshot.Type,
+        Size:    snapshot.Size,
+        Species: append([]AquariumSpecies(nil), snapshot.Species...),
+        Plants:  append([]AquariumPlant(nil), snapshot.Plants...),
+    }
+    for _, equipment := range snapshot.Equipment {
+        aquarium.Equipment = append(aquarium.Equipment, Equipment{Id: equipment.Id, Name: equipment.Name, Fields: equipment.Fields})
+    }
+    return aquarium
+}
+
+// diffSnapshots returns how after differs from before, which is nil for a new aquarium.
+func diffSnapshots(before *AquariumSnapshot, after *AquariumSnapshot) AquariumChanges {
+    if before == nil {
+        before = &AquariumSnapshot{}
+    }
+    var changes AquariumChanges
+
+    fields := []FieldChange{
+        {Field: "name", From: before.Name, To: after.Name},
+        {Field: "type", From: before.Type, To: after.Type},
+        {Field: "size", From: before.Size, To: after.Size},
+    }
+    for _, field := range fields {
+        if field.From != field.To {
+            changes.Fields = append(changes.Fields, field)
+        }
+    }
+
+    changes.Species = diffStock(speciesItems(before.Species), speciesItems(after.Species), speciesNames(before.Species, after.Species))
+    changes.Plants = diffStock(plantItems(before.Plants), plantItems(after.Plants), plantNames(before.Plants, after.Plants))
+
+    // Equipment may be installed more than once, so it is compared as a multiset of
+    // installations; changing the fields of one shows as removing it and adding it back.
+    key := func(equipment AquariumEquipment) string {
+        var fields bytes.Buffer
+        if json.Compact(&fields, equipment.Fields) != nil {
+            fields.Write(equipment.Fields)
+        }
+        return equipment.Id + "\x00" + fields.String()
+    }
+    unmatched := make(map[string]int)
+    for _, equipment := range before.Equipment {
+        unmatched[key(equipment)]++
+    }
+    for _, equipment := range after.Equipment {
+        if unmatched[key(equipment)] > 0 {
+            unmatched[key(equipment)]--
+        } else {
+            changes.EquipmentAdded = append(changes.EquipmentAdded, equipment)
+        }
+    }
+    for _, equipment := range before.Equipment {
+        if unmatched[key(equipment)] > 0 {
+            unmatched[key(equipment)]--
+            changes.EquipmentRemoved = append(changes.EquipmentRemoved, equipment)
+        }
+    }
+    return changes
+}
+
+// diffStock returns the changes of the counts of species or plants, in the order of after
+// followed by those removed.
+func diffStock(before []stockItem, after []stockItem, names map[string]string) []StockChange {
+    from := make(map[string]int)
+    for _, item := range before {
+        from[item.id] = item.count
+    }
+    to := make(map[string]int)
+    for _, item := range after {
+        to[item.id] = item.count
+    }
+
+    var changes []StockChange
+    for _, item := range after {
+        if from[item.id] != item.count {
+            changes = append(changes, StockChange{Id: item.id, Name: names[item.id], From: from[item.id], To: item.count})
+        }
+    }
+    for _, item := range before {
+        if _, kept := to[item.id]; !kept {
+            changes = append(changes, StockChange{Id: item.id, Name: names[item.id], From: item.count})
+        }
+    }
+    return changes
+}
+
+// speciesNames maps the IDs of the given species to their names.
+func speciesNames(lists ...[]AquariumSpecies) map[string]string {
+    names := make(map[string]string)
+    for _, list := range lists {
+        for _, species := range list {
+            names[species.Id] = species.Name
+        }
+    }
+    return names
+}
+
+// plantNames maps the IDs of the given plants to their names.
+func plantNames(lists ...[]AquariumPlant) map[string]string {
+    names := make(map[string]string)
+    for _, list := range lists {
+        for _, plant := range list {
+            names[plant.Id] = plant.Name
+        }
+    }
+    return names
+}
+
+// loadAquariumSnapshot reads the current state of an aquarium within a transaction.
+func loadAquariumSnapshot(ctx context.Context, tx *sql.Tx, aquariumID string) (*AquariumSnapshot, error) {
+    snapshot := &AquariumSnapshot{
+        Species:   []AquariumSpecies{},
+        Plants:    []AquariumPlant{},
+        Equipment: []AquariumEquipment{},
+    }
+    err := tx.QueryRowContext(ctx, `SELECT name, type, size FROM aquariums WHERE id = $1`, aquariumID).
+        Scan(&snapshot.Name, &snapshot.Type, &snapshot.Size)
+    if err != nil {
+        return nil, err
+    }
+
+    for _, detailType := range []string{DetailSpecies, DetailPlant} {
+        stock := stockTables[detailType]
+        query := fmt.Sprintf(`
+            SELECT k.%[2]s, c.name, k.count
+            FROM %[1]s k
+            JOIN %[3]s c ON c.id = k.%[2]s
+            WHERE k.aquarium_id = $1
+            ORDER BY k.position
+        `, stock.table, stock.column, stock.catalog)
+        rows, err := tx.QueryContext(ctx, query, aquariumID)
+        if err != nil {
+            return nil, err
+        }
+        for rows.Next() {
+            var species AquariumSpecies
+            if err := rows.Scan(&species.Id, &species.Name, &species.Count); err != nil {
+                rows.Close()
+                return nil, err
+            }
+            if detailType == DetailSpecies {
+                snapshot.Species = append(snapshot.Species, species)
+            } else {
+                snapshot.Plants = append(snapshot.Plants, AquariumPlant(species))
+            }
+        }
+        rows.Close()
+        if err := rows.Err(); err != nil {
+            return nil, err
+        }
+    }
+
+    query := `
+        SELECT ae.equipment_id, e.name, ae.fields
+        FROM aquarium_equipment ae
+        JOIN equipment e ON e.id = ae.equipment_id
+        WHERE ae.aquarium_id = $1
+        ORDER BY ae.position
+    `
+    rows, err := tx.QueryContext(ctx, query, aquariumID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var equipment AquariumEquipment
+        var fields []byte
+        if err := rows.Scan(&equipment.Id, &equipment.Name, &fields); err != nil {
+            return nil, err
+        }
+        equipment.Fields = json.RawMessage(fields)
+        snapshot.Equipment = append(snapshot.Equipment, equipment)
+    }
+    return snapshot, rows.Err()
+}
+
+// recordAquariumRevision records the change of an aquarium to the given version within
+// the transaction that made it.
+func recordAquariumRevision(ctx context.Context, tx *sql.Tx, revision AquariumRevision) error {
+    after, err := loadAquariumSnapshot(ctx, tx, revision.AquariumID)
+    if err != nil {
+        return err
+    }
+
+    var before *AquariumSnapshot
+    var beforeJSON []byte
+    query := `SELECT snapshot FROM aquarium_revisions WHERE aquarium_id = $1 AND version < $2 ORDER BY version DESC LIMIT 1`
+    err = tx.QueryRowContext(ctx, query, revision.AquariumID, revision.Version).Scan(&beforeJSON)
+    switch {
+    case err == sql.ErrNoRows:
+    case err != nil:
+        return err
+    default:
+        before = &AquariumSnapshot{}
+        if err := json.Unmarshal(beforeJSON, before); err != nil {
+            return fmt.Errorf("error unmarshalling revision snapshot: %w", err)
+        }
+    }
+
+    snapshotJSON, err := json.Marshal(after)
+    if err != nil {
+        return err
+    }
+    changesJSON, err := json.Marshal(diffSnapshots(before, after))
+    if err != nil {
+        return err
+    }
+
+    query = `
+        INSERT INTO aquarium_revisions (aquarium_id, version, actor_id, action, restored_from, snapshot, changes)
+        VALUES ($1, $2, NULLIF($3, '')::uuid, $4, NULLIF($5, 0), $6, $7)
+    `
+    _, err = tx.ExecContext(ctx, query, revision.AquariumID, revision.Version, revision.ActorID, revision.Action,
+        revision.RestoredFrom, snapshotJSON, changesJSON)
+    return err
+}
+
+// scanAquariumRevision scans a row of the columns selected by aquariumRevisionColumns,
+// followed by the snapshot if withSnapshot is set.
+func scanAquariumRevision(row rowScanner, withSnapshot bool) (*AquariumRevision, error) {
+    var revision AquariumRevision
+    var changesJSON, snapshotJSON []byte
+    dest := []interface{}{&revision.AquariumID, &revision.Version, &revision.ActorID, &revision.Action,
+        &revision.RestoredFrom, &revision.CreatedAt, &changesJSON}
+    if withSnapshot {
+        dest = append(dest, &snapshotJSON)
+    }
+    if err := row.Scan(dest...); err != nil {
+        return nil, err
+    }
+
+    if err := json.Unmarshal(changesJSON, &revision.Changes); err != nil {
+        return nil, fmt.Errorf("error unmarshalling revision changes: %w", err)
+    }
+    if withSnapshot {
+        revision.Snapshot = &AquariumSnapshot{}
+        if err := json.Unmarshal(snapshotJSON, revision.Snapshot); err != nil {
+            return nil, fmt.Errorf("error unmarshalling revision snapshot: %w", err)
+        }
+    }
+    return &revision, nil
+}
+
+// aquariumRevisionColumns are the columns read by scanAquariumRevision, before the snapshot.
+const aquariumRevisionColumns = `aquarium_id, version, COALESCE(actor_id::text, ''), action,
+    COALESCE(restored_from, 0), created_at, changes`
+
+// ListAquariumRevisions lists the revisions of an aquarium, newest first, without their
+// snapshots.
+//
+// Params:
+//   - aquariumID: the aquarium whose history to list
+//   - limit: the maximum number of revisions; 0 lists all of them
+func (s *PostgresStore) ListAquariumRevisions(ctx context.Context, aquariumID string, limit int) ([]AquariumRevision, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `SELECT ` + aquariumRevisionColumns + `
+        FROM aquarium_revisions
+        WHERE aquarium_id = $1
+        ORDER BY version DESC
+        LIMIT NULLIF($2, 0)
+    `
+    rows, err := s.db.QueryContext(ctx, query, aquariumID, limit)
+    if err != nil {
+        return nil, queryError(ctx, err)
+    }
+    defer rows.Close()
+
+    revisions := []AquariumRevision{}
+    for rows.Next() {
+        revision, err := scanAquariumRevision(rows, false)
+        if err != nil {
+            return nil, queryError(ctx, err)
+        }
+        revisions = append(revisions, *revision)
+    }
+    return revisions, queryError(ctx, rows.Err())
+}
+
+// GetAquariumRevision retrieves the revision of an aquarium that produced the given
+// version, with its snapshot.
+func (s *PostgresStore) GetAquariumRevision(ctx context.Context, aquariumID string, version int64) (*AquariumRevision, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `SELECT ` + aquariumRevisionColumns + `, snapshot
+        FROM aquarium_revisions
+        WHERE aquarium_id = $1 AND version = $2
+    `
+    revision, err := scanAquariumRevision(s.db.QueryRowContext(ctx, query, aquariumID, version), true)
+    return revision, queryError(ctx, err)
+}
+
+// GetAquariumRevisionAt retrieves the revision of an aquarium in effect at the given time,
+// that is the last one recorded by then, with its snapshot. It returns sql.ErrNoRows if
+// no revision was recorded by then.
+func (s *PostgresStore) GetAquariumRevisionAt(ctx context.Context, aquariumID string, at time.Time) (*AquariumRevision, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `SELECT ` + aquariumRevisionColumns + `, snapshot
+        FROM aquarium_revisions
+        WHERE aquarium_id = $1 AND created_at <= $2
+        ORDER BY version DESC
+        LIMIT 1
+    `
+    revision, err := scanAquariumRevision(s.db.QueryRowContext(ctx, query, aquariumID, at), true)
+    return revision, queryError(ctx, err)
+}
+
+// RestoreAquariumRevision restores an aquarium to the state recorded by one of its
+// revisions, recording the restore as a new revision, and returns the new version.
+//
+// Params:
+//   - aquariumID: the aquarium to restore
+//   - revision: the version of the revision to restore
+//   - version: the version of the aquarium the restore is based on, or 0 for any
+//   - actor: who restores the aquarium
+//
+// It returns sql.ErrNoRows if the revision does not exist, ErrVersionConflict if the
+// aquarium is no longer at version and an *UnknownCatalogError if some of the stock of
+// the revision was since removed from the catalog.
+func (s *PostgresStore) RestoreAquariumRevision(ctx context.Context, aquariumID string, revision int64, version int64, actor Actor) (int64, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return 0, queryError(ctx, err)
+    }
+    defer tx.Rollback()
+
+    var snapshotJSON []byte
+    query := `SELECT snapshot FROM aquarium_revisions WHERE aquarium_id = $1 AND version = $2`
+    if err := tx.QueryRowContext(ctx, query, aquariumID, revision).Scan(&snapshotJSON); err != nil {
+        return 0, queryError(ctx, err)
+    }
+    var snapshot AquariumSnapshot
+    if err := json.Unmarshal(snapshotJSON, &snapshot); err != nil {
+        return 0, fmt.Errorf("error unmarshalling revision snapshot: %w", err)
+    }
+
+    aquarium := snapshot.Aquarium(aquariumID)
+    aquarium.Version = version
+    if err := updateAquarium(ctx, tx, &aquarium); err != nil {
+        return 0, queryError(ctx, err)
+    }
+
+    err = recordAquariumRevision(ctx, tx, AquariumRevision{
+        AquariumID:   aquariumID,
+        Version:      aquarium.Version,
+        ActorID:      actor.UserID,
+        Action:       RevisionRestore,
+        RestoredFrom: revision,
+    })
+    if err != nil {
+        return 0, queryError(ctx, err)
+    }
+
+    if err := tx.Commit(); err != nil {
+        return 0, queryError(ctx, err)
+    }
+    return aquarium.Version, nil
+}
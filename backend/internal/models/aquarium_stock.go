@@ -0,0 +1,461 @@
+// models/aquarium_stock.go
+
+package models
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "strings"
+
+    "github.com/lib/pq"
+)
+
+// The species, plants and equipment kept in an aquarium are its stock. They are stored in
+// the aquarium_species, aquarium_plants and aquarium_equipment tables, whose foreign keys
+// to the catalog reject unknown IDs and prevent catalog entries in use from being deleted.
+// Details such as names are always read from the catalog, so they never go stale.
+//
+// The schema is defined by migration 0015_aquarium_stock in internal/migrate. Items the
+// migration found referencing missing catalog entries are kept in aquarium_stock_unmatched.
+
+// ErrDetailInUse is returned when deleting a catalog detail kept in an aquarium.
+var ErrDetailInUse = errors.New("detail is kept in an aquarium")
+
+// ErrStockNotFound is returned when removing a species or plant an aquarium does not keep.
+var ErrStockNotFound = errors.New("not kept in the aquarium")
+
+// UnknownCatalogError reports the IDs of an aquarium's stock missing from the catalog.
+type UnknownCatalogError struct {
+    Species   []string
+    Plants    []string
+    Equipment []string
+}
+
+func (e *UnknownCatalogError) Error() string {
+    var parts []string
+    if len(e.Species) > 0 {
+        parts = append(parts, "species "+strings.Join(e.Species, ", "))
+    }
+    if len(e.Plants) > 0 {
+        parts = append(parts, "plants "+strings.Join(e.Plants, ", "))
+    }
+    if len(e.Equipment) > 0 {
+        parts = append(parts, "equipment "+strings.Join(e.Equipment, ", "))
+    }
+    return "unknown catalog IDs: " + strings.Join(parts, "; ")
+}
+
+// StockAdjustment changes how many of one species or plant an aquarium keeps.
+type StockAdjustment struct {
+    AquariumID string
+    DetailType string // DetailSpecies or DetailPlant
+    DetailID   string
+    Delta      int   // Added to the count; a species or plant left with none is removed
+    RemoveAll  bool  // Whether to remove the species or plant whatever its count
+    Version    int64 // Version of the aquarium the adjustment is based on; 0 applies to any
+
+    Count int // Count after the adjustment, filled in; 0 once removed
+}
+
+// stockTable describes the table keeping one kind of stock.
+type stockTable struct {
+    table   string // Table of the stock
+    column  string // Column of the stock table referencing the catalog
+    catalog string // Catalog table
+}
+
+// stockTables maps the detail types that are counted in aquariums to their tables.
+var stockTables = map[string]stockTable{
+    DetailSpecies: {table: "aquarium_species", column: "species_id", catalog: "species"},
+    DetailPlant:   {table: "aquarium_plants", column: "plant_id", catalog: "plants"},
+}
+
+// stockItem is a species or plant kept in an aquarium.
+type stockItem struct {
+    id    string
+    count int
+}
+
+// speciesItems returns the species of an aquarium as stock items.
+func speciesItems(species []AquariumSpecies) []stockItem {
+    items := make([]stockItem, len(species))
+    for i, s := range species {
+        items[i] = stockItem{id: s.Id, count: s.Count}
+    }
+    return items
+}
+
+// plantItems returns the plants of an aquarium as stock items.
+func plantItems(plants []AquariumPlant) []stockItem {
+    items := make([]stockItem, len(plants))
+    for i, p := range plants {
+        items[i] = stockItem{id: p.Id, count: p.Count}
+    }
+    return items
+}
+
+// distinctItems lists every ID once, where it was first listed, with the count listed last.
+func distinctItems(items []stockItem) []stockItem {
+    index := make(map[string]int)
+    var distinct []stockItem
+    for _, item := range items {
+        if i, ok := index[item.id]; ok {
+            distinct[i].count = item.count
+            continue
+        }
+        index[item.id] = len(distinct)
+        distinct = append(distinct, item)
+    }
+    return distinct
+}
+
+// lockCatalogNames returns the names of the catalog details with the given IDs from table,
+// locking them against deletion until the transaction ends.
+func lockCatalogNames(ctx context.Context, tx *sql.Tx, table string, ids []string) (map[string]string, error) {
+    names := make(map[string]string)
+    if len(ids) == 0 {
+        return names, nil
+    }
+
+    query := fmt.Sprintf(`SELECT id, name FROM %s WHERE id = ANY($1) FOR KEY SHARE`, table)
+    rows, err := tx.QueryContext(ctx, query, pq.Array(ids))
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var id, name string
+        if err := rows.Scan(&id, &name); err != nil {
+            return nil, err
+        }
+        names[id] = name
+    }
+    return names, rows.Err()
+}
+
+// missingIDs returns the IDs absent from names, in order and without repeats.
+func missingIDs(ids []string, names map[string]string) []string {
+    var missing []string
+    seen := make(map[string]bool)
+    for _, id := range ids {
+        if _, ok := names[id]; !ok && !seen[id] {
+            seen[id] = true
+            missing = append(missing, id)
+        }
+    }
+    return missing
+}
+
+// saveAquariumStock replaces the stock of an aquarium within a transaction and fills in
+// the catalog names of its species and plants.
+// It returns an *UnknownCatalogError if any of the stock is missing from the catalog.
+func saveAquariumStock(ctx context.Context, tx *sql.Tx, aquarium *Aquarium) error {
+    species := distinctItems(speciesItems(aquarium.Species))
+    plants := distinctItems(plantItems(aquarium.Plants))
+
+    var speciesIDs, plantIDs, equipmentIDs []string
+    for _, item := range species {
+        speciesIDs = append(speciesIDs, item.id)
+    }
+    for _, item := range plants {
+        plantIDs = append(plantIDs, item.id)
+    }
+    for _, equipment := range aquarium.Equipment {
+        equipmentIDs = append(equipmentIDs, equipment.Id)
+    }
+
+    speciesNames, err := lockCatalogNames(ctx, tx, "species", speciesIDs)
+    if err != nil {
+        return err
+    }
+    plantNames, err := lockCatalogNames(ctx, tx, "plants", plantIDs)
+    if err != nil {
+        return err
+    }
+    equipmentNames, err := lockCatalogNames(ctx, tx, "equipment", equipmentIDs)
+    if err != nil {
+        return err
+    }
+
+    unknown := &UnknownCatalogError{
+        Species:   missingIDs(speciesIDs, speciesNames),
+        Plants:    missingIDs(plantIDs, plantNames),
+        Equipment: missingIDs(equipmentIDs, equipmentNames),
+    }
+    if len(unknown.Species) > 0 || len(unknown.Plants) > 0 || len(unknown.Equipment) > 0 {
+        return unknown
+    }
+
+    for _, table := range []string{"aquarium_species", "aquarium_plants", "aquarium_equipment"} {
+        _, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE aquarium_id = $1`, table), aquarium.ID)
+        if err != nil {
+            return err
+        }
+    }
+
+    err = insertStockItems(ctx, tx, `
+        INSERT INTO aquarium_species (aquarium_id, species_id, count, position)
+        SELECT $1, item.id, item.count, item.position
+        FROM unnest($2::text[], $3::integer[]) WITH ORDINALITY AS item(id, count, position)
+    `, aquarium.ID, species)
+    if err != nil {
+        return err
+    }
+    err = insertStockItems(ctx, tx, `
+        INSERT INTO aquarium_plants (aquarium_id, plant_id, count, position)
+        SELECT $1, item.id, item.count, item.position
+        FROM unnest($2::text[], $3::integer[]) WITH ORDINALITY AS item(id, count, position)
+    `, aquarium.ID, plants)
+    if err != nil {
+        return err
+    }
+
+    if len(aquarium.Equipment) > 0 {
+        fields := make([]sql.NullString, len(aquarium.Equipment))
+        for i, equipment := range aquarium.Equipment {
+            if len(equipment.Fields) > 0 && string(equipment.Fields) != "null" {
+                fields[i] = sql.NullString{String: string(equipment.Fields), Valid: true}
+            }
+        }
+        query := `
+            INSERT INTO aquarium_equipment (aquarium_id, position, equipment_id, fields)
+            SELECT $1, item.position, item.id, item.fields::jsonb
+            FROM unnest($2::text[], $3::text[]) WITH ORDINALITY AS item(id, fields, position)
+        `
+        _, err := tx.ExecContext(ctx, query, aquarium.ID, pq.Array(equipmentIDs), pq.Array(fields))
+        if err != nil {
+            return err
+        }
+    }
+
+    for i := range aquarium.Species {
+        aquarium.Species[i].Name = speciesNames[aquarium.Species[i].Id]
+    }
+    for i := range aquarium.Plants {
+        aquarium.Plants[i].Name = plantNames[aquarium.Plants[i].Id]
+    }
+    return nil
+}
+
+// insertStockItems runs an insert of species or plants taking the aquarium ID, the item
+// IDs and the item counts as parameters.
+func insertStockItems(ctx context.Context, tx *sql.Tx, query string, aquariumID string, items []stockItem) error {
+    if len(items) == 0 {
+        return nil
+    }
+    ids := make([]string, len(items))
+    counts := make([]int64, len(items))
+    for i, item := range items {
+        ids[i] = item.id
+        counts[i] = int64(item.count)
+    }
+    _, err := tx.ExecContext(ctx, query, aquariumID, pq.Array(ids), pq.Array(counts))
+    return err
+}
+
+// staleAquariumError explains why an aquarium could not be updated at a given version:
+// ErrVersionConflict if it exists, so it must have been changed, or sql.ErrNoRows.
+func staleAquariumError(ctx context.Context, tx *sql.Tx, aquariumID string) error {
+    var exists bool
+    err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM aquariums WHERE id = $1)`, aquariumID).Scan(&exists)
+    if err != nil {
+        return err
+    }
+    if exists {
+        return ErrVersionConflict
+    }
+    return sql.ErrNoRows
+}
+
+// AdjustAquariumStock adds or removes some of one species or plant of an aquarium within
+// a transaction, and fills in the resulting count and the new version of the aquarium.
+// Species and plants added are listed after those already kept.
+//
+// It returns sql.ErrNoRows if the aquarium does not exist, ErrVersionConflict if it is no
+// longer at adjustment.Version, an *UnknownCatalogError when adding a species or plant
+// missing from the catalog and ErrStockNotFound when removing one the aquarium does not keep.
+// The change is recorded as a revision made by the actor.
+func (s *PostgresStore) AdjustAquariumStock(ctx context.Context, adjustment *StockAdjustment, actor Actor) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    stock, ok := stockTables[adjustment.DetailType]
+    if !ok {
+        return errors.New("Invalid detail type")
+    }
+
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    defer tx.Rollback()
+
+    // Bumping the version locks the aquarium, so concurrent adjustments apply one by one
+    query := `UPDATE aquariums SET version = version + 1 WHERE id = $1 AND ($2 = 0 OR version = $2) RETURNING version`
+    var version int64
+    err = tx.QueryRowContext(ctx, query, adjustment.AquariumID, adjustment.Version).Scan(&version)
+    if err == sql.ErrNoRows {
+        err = staleAquariumError(ctx, tx, adjustment.AquariumID)
+    }
+    if err != nil {
+        return queryError(ctx, err)
+    }
+
+    if adjustment.Delta > 0 && !adjustment.RemoveAll {
+        names, err := lockCatalogNames(ctx, tx, stock.catalog, []string{adjustment.DetailID})
+        if err != nil {
+            return queryError(ctx, err)
+        }
+        if _, ok := names[adjustment.DetailID]; !ok {
+            unknown := &UnknownCatalogError{}
+            if adjustment.DetailType == DetailSpecies {
+                unknown.Species = []string{adjustment.DetailID}
+            } else {
+                unknown.Plants = []string{adjustment.DetailID}
+            }
+            return unknown
+        }
+
+        query := fmt.Sprintf(`
+            INSERT INTO %[1]s (aquarium_id, %[2]s, count, position)
+            VALUES ($1, $2, $3, (SELECT COALESCE(max(position), 0) + 1 FROM %[1]s WHERE aquarium_id = $1))
+            ON CONFLICT (aquarium_id, %[2]s) DO UPDATE SET count = %[1]s.count + EXCLUDED.count
+            RETURNING count
+        `, stock.table, stock.column)
+        err = tx.QueryRowContext(ctx, query, adjustment.AquariumID, adjustment.DetailID, adjustment.Delta).Scan(&adjustment.Count)
+        if err != nil {
+            return queryError(ctx, err)
+        }
+    } else {
+        count := 0
+        if !adjustment.RemoveAll {
+            query := fmt.Sprintf(`UPDATE %s SET count = count + $3 WHERE aquarium_id = $1 AND %s = $2 RETURNING count`, stock.table, stock.column)
+            err = tx.QueryRowContext(ctx, query, adjustment.AquariumID, adjustment.DetailID, adjustment.Delta).Scan(&count)
+            if err == sql.ErrNoRows {
+                return ErrStockNotFound
+            }
+            if err != nil {
+                return queryError(ctx, err)
+            }
+        }
+
+        if count <= 0 {
+            query := fmt.Sprintf(`DELETE FROM %s WHERE aquarium_id = $1 AND %s = $2`, stock.table, stock.column)
+            result, err := tx.ExecContext(ctx, query, adjustment.AquariumID, adjustment.DetailID)
+            if err != nil {
+                return queryError(ctx, err)
+            }
+            if rowsAffected, err := result.RowsAffected(); err != nil {
+                return queryError(ctx, err)
+            } else if rowsAffected == 0 {
+                return ErrStockNotFound
+            }
+            count = 0
+        }
+        adjustment.Count = count
+    }
+
+    err = recordAquariumRevision(ctx, tx, AquariumRevision{
+        AquariumID: adjustment.AquariumID,
+        Version:    version,
+        ActorID:    actor.UserID,
+        Action:     RevisionStock,
+    })
+    if err != nil {
+        return queryError(ctx, err)
+    }
+
+    if err := tx.Commit(); err != nil {
+        return queryError(ctx, err)
+    }
+    adjustment.Version = version
+    return nil
+}
+
+// resolveAquariums fills in the species, plants and equipment of the given aquariums from
+// the catalog, with one query for each kind of stock whatever the number of aquariums.
+func (s *PostgresStore) resolveAquariums(ctx context.Context, aquariums []*AquariumResponse) error {
+    if len(aquariums) == 0 {
+        return nil
+    }
+    ids := make([]string, len(aquariums))
+    for i, aquarium := range aquariums {
+        ids[i] = aquarium.ID
+    }
+
+    species, err := s.getAquariumSpecies(ctx, ids)
+    if err != nil {
+        return err
+    }
+    plants, err := s.getAquariumPlants(ctx, ids)
+    if err != nil {
+        return err
+    }
+    equipment, err := s.getAquariumEquipment(ctx, ids)
+    if err != nil {
+        return err
+    }
+
+    for _, aquarium := range aquariums {
+        aquarium.Species = species[aquarium.ID]
+        if aquarium.Species == nil {
+            aquarium.Species = []Species{}
+        }
+        aquarium.Plants = plants[aquarium.ID]
+        if aquarium.Plants == nil {
+            aquarium.Plants = []Plant{}
+        }
+        aquarium.Equipment = equipment[aquarium.ID]
+        if aquarium.Equipment == nil {
+            aquarium.Equipment = []Equipment{}
+        }
+    }
+    return nil
+}
+
+// getAquariumEquipment retrieves the equipment of the given aquariums, in the order it was
+// listed, keyed by aquarium ID. Fields entered for an aquarium replace those of the catalog.
+func (s *PostgresStore) getAquariumEquipment(ctx context.Context, aquariumIDs []string) (map[string][]Equipment, error) {
+    query := `
+        SELECT ae.aquarium_id, e.id, e.name, e.description, e.role, e.importance, e.usage,
+               e.special_considerations, COALESCE(ae.fields, e.fields), e.type
+        FROM aquarium_equipment ae
+        JOIN equipment e ON e.id = ae.equipment_id
+        WHERE ae.aquarium_id = ANY($1::uuid[])
+        ORDER BY ae.aquarium_id, ae.position
+    `
+    rows, err := s.db.QueryContext(ctx, query, pq.Array(aquariumIDs))
+    if err != nil {
+        return nil, queryError(ctx, err)
+    }
+    defer rows.Close()
+
+    equipmentByAquarium := make(map[string][]Equipment)
+    for rows.Next() {
+        var aquariumID string
+        var equipment Equipment
+        var fields []byte
+        err := rows.Scan(
+            &aquariumID,
+            &equipment.Id,
+            &equipment.Name,
+            &equipment.Description,
+            &equipment.Role,
+            &equipment.Importance,
+            &equipment.Usage,
+            &equipment.SpecialConsiderations,
+            &fields,
+            &equipment.Type,
+        )
+        if err != nil {
+            return nil, queryError(ctx, err)
+        }
+        equipment.Fields = json.RawMessage(fields)
+        equipmentByAquarium[aquariumID] = append(equipmentByAquarium[aquariumID], equipment)
+    }
+    return equipmentByAquarium, queryError(ctx, rows.Err())
+}
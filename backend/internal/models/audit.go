@@ -0,0 +1,221 @@
+// models/audit.go
+
+package models
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "strings"
+    "time"
+)
+
+// AuditEvent is an entry of the append-only audit log, recording who did what to which
+// target, from where, and whether it succeeded. Events are kept when the users they
+// mention are deleted.
+//
+// The schema is defined by migration 0004_audit_events in internal/migrate.
+type AuditEvent struct {
+    ID         string                 `json:"id"`                // Unique identifier of the event
+    OccurredAt time.Time              `json:"occurredAt"`        // When the event happened
+    ActorID    string                 `json:"actorId"`           // User who acted, "" if unauthenticated
+    Action     string                 `json:"action"`            // One of the Audit action constants
+    TargetType string                 `json:"targetType"`        // Kind of object acted on, e.g. "user" or "aquarium"
+    TargetID   string                 `json:"targetId"`          // ID of the object acted on
+    IP         string                 `json:"ip"`                // Client IP address
+    UserAgent  string                 `json:"userAgent"`         // Client user agent
+    Outcome    string                 `json:"outcome"`           // One of the Outcome constants
+    Details    map[string]interface{} `json:"details,omitempty"` // Additional context
+}
+
+// Audit event outcomes.
+const (
+    OutcomeSuccess = "success" // The operation was carried out
+    OutcomeFailure = "failure" // The operation failed, e.g. wrong credentials
+    OutcomeDenied  = "denied"  // The caller was not allowed to perform the operation
+)
+
+// Audit event actions. Actions starting with "auth." or "account." form a user's security activity.
+const (
+    AuditRegister           = "auth.register"
+    AuditLogin              = "auth.login"
+    AuditLoginMFA           = "auth.login_mfa"
+    AuditOAuthLogin         = "auth.oauth_login"
+    AuditLoginLocked        = "auth.login_locked"
+    AuditIPBlocked          = "auth.ip_blocked"
+    AuditRefreshReuse       = "auth.refresh_token_reused"
+    AuditLogout             = "auth.logout"
+    AuditLogoutAll          = "auth.logout_all"
+    AuditSessionRevoked     = "auth.session_revoked"
+    AuditPasswordChanged    = "auth.password_changed"
+    AuditPasswordResetSent  = "auth.password_reset_requested"
+    AuditPasswordReset      = "auth.password_reset"
+    AuditEmailVerified      = "auth.email_verified"
+    AuditMFAEnabled         = "auth.mfa_enabled"
+    AuditMFADisabled        = "auth.mfa_disabled"
+    AuditRecoveryCodesReset = "auth.recovery_codes_regenerated"
+    AuditTokenCreated       = "auth.token_created"
+    AuditTokenRevoked       = "auth.token_revoked"
+    AuditIdentityLinked     = "auth.identity_linked"
+    AuditIdentityUnlinked   = "auth.identity_unlinked"
+    AuditAccountDeleted     = "account.deleted"
+    AuditAccountExported    = "account.exported"
+    AuditAquariumCreate     = "aquarium.create"
+    AuditAquariumUpdate     = "aquarium.update"
+    AuditAquariumRestore    = "aquarium.restore"
+    AuditAquariumDelete     = "aquarium.delete"
+    AuditAquariumDenied     = "aquarium.access_denied"
+    AuditMemberInvited      = "aquarium.member_invited"
+    AuditInvitationRevoked  = "aquarium.invitation_revoked"
+    AuditMemberJoined       = "aquarium.member_joined"
+    AuditMemberRoleChanged  = "aquarium.member_role_changed"
+    AuditMemberRemoved      = "aquarium.member_removed"
+    AuditShareLinkCreated   = "aquarium.share_link_created"
+    AuditShareLinkRevoked   = "aquarium.share_link_revoked"
+    AuditParametersCreate   = "parameters.create"
+    AuditRolesChanged       = "admin.roles_changed"
+)
+
+// Actor identifies who performs an audited change and from where.
+type Actor struct {
+    UserID    string // ID of the acting user
+    IP        string // Client IP address
+    UserAgent string // Client user agent
+}
+
+// execer is implemented by *sql.DB and *sql.Tx.
+type execer interface {
+    ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertAuditEvent appends an event to the audit log using db or a transaction.
+func insertAuditEvent(ctx context.Context, exec execer, event AuditEvent) error {
+    details := event.Details
+    if details == nil {
+        details = map[string]interface{}{}
+    }
+    detailsJSON, err := json.Marshal(details)
+    if err != nil {
+        return err
+    }
+
+    query := `
+        INSERT INTO audit_events (actor_id, action, target_type, target_id, ip, user_agent, outcome, details)
+        VALUES (NULLIF($1, '')::uuid, $2, $3, $4, $5, $6, $7, $8::jsonb)
+    `
+    _, err = exec.ExecContext(ctx, query, event.ActorID, event.Action, event.TargetType, event.TargetID,
+        event.IP, event.UserAgent, event.Outcome, string(detailsJSON))
+    return err
+}
+
+// RecordAuditEvent appends an event to the audit log.
+func (s *PostgresStore) RecordAuditEvent(ctx context.Context, event AuditEvent) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    return queryError(ctx, insertAuditEvent(ctx, s.db, event))
+}
+
+// AuditFilter selects audit events. Zero-valued fields do not filter.
+type AuditFilter struct {
+    ActorID    string     // Only events by this user
+    Action     string     // Only events with this action; a trailing "*" matches a prefix, e.g. "auth.*"
+    TargetType string     // Only events on this kind of target
+    TargetID   string     // Only events on this target
+    Outcome    string     // Only events with this outcome
+    Since      *time.Time // Only events at or after this time
+    Until      *time.Time // Only events before this time
+    Limit      int        // Maximum number of events, newest first
+}
+
+// ListAuditEvents retrieves audit events matching the filter, newest first.
+func (s *PostgresStore) ListAuditEvents(ctx context.Context, filter AuditFilter) ([]AuditEvent, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    var conditions []string
+    var args []interface{}
+    add := func(condition string, value interface{}) {
+        args = append(args, value)
+        conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+    }
+
+    if filter.ActorID != "" {
+        add("actor_id = $%d::uuid", filter.ActorID)
+    }
+    if prefix, ok := strings.CutSuffix(filter.Action, "*"); ok {
+        add("starts_with(action, $%d)", prefix)
+    } else if filter.Action != "" {
+        add("action = $%d", filter.Action)
+    }
+    if filter.TargetType != "" {
+        add("target_type = $%d", filter.TargetType)
+    }
+    if filter.TargetID != "" {
+        add("target_id = $%d", filter.TargetID)
+    }
+    if filter.Outcome != "" {
+        add("outcome = $%d", filter.Outcome)
+    }
+    if filter.Since != nil {
+        add("occurred_at >= $%d", *filter.Since)
+    }
+    if filter.Until != nil {
+        add("occurred_at < $%d", *filter.Until)
+    }
+
+    query := `SELECT ` + auditColumns + ` FROM audit_events`
+    if len(conditions) > 0 {
+        query += ` WHERE ` + strings.Join(conditions, " AND ")
+    }
+    args = append(args, filter.Limit)
+    query += fmt.Sprintf(` ORDER BY occurred_at DESC LIMIT $%d`, len(args))
+
+    return s.queryAuditEvents(ctx, query, args...)
+}
+
+// ListSecurityActivity retrieves the most recent authentication and account events
+// performed by or aimed at a user, newest first.
+func (s *PostgresStore) ListSecurityActivity(ctx context.Context, userID string, limit int) ([]AuditEvent, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        SELECT ` + auditColumns + `
+        FROM audit_events
+        WHERE (actor_id = $1::uuid OR (target_type = 'user' AND target_id = $1))
+          AND (starts_with(action, 'auth.') OR starts_with(action, 'account.'))
+        ORDER BY occurred_at DESC
+        LIMIT $2
+    `
+    return s.queryAuditEvents(ctx, query, userID, limit)
+}
+
+// auditColumns lists the columns scanned by queryAuditEvents.
+const auditColumns = `id, occurred_at, COALESCE(actor_id::text, ''), action, target_type, target_id, ip, user_agent, outcome, details`
+
+// queryAuditEvents runs a query selecting auditColumns.
+func (s *PostgresStore) queryAuditEvents(ctx context.Context, query string, args ...interface{}) ([]AuditEvent, error) {
+    rows, err := s.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, queryError(ctx, err)
+    }
+    defer rows.Close()
+
+    events := []AuditEvent{}
+    for rows.Next() {
+        var event AuditEvent
+        var details []byte
+        err := rows.Scan(&event.ID, &event.OccurredAt, &event.ActorID, &event.Action, &event.TargetType,
+            &event.TargetID, &event.IP, &event.UserAgent, &event.Outcome, &details)
+        if err != nil {
+            return nil, queryError(ctx, err)
+        }
+        if err := json.Unmarshal(details, &event.Details); err != nil {
+            return nil, queryError(ctx, err)
+        }
+        events = append(events, event)
+    }
+    return events, queryError(ctx, rows.Err())
+}
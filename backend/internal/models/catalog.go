@@ -0,0 +1,410 @@
+// models/catalog.go
+
+package models
+
+import (
+    "context"
+    "crypto/rand"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "sort"
+    "strings"
+
+    "github.com/lib/pq"
+)
+
+// Catalog detail types accepted by the catalog management functions.
+const (
+    DetailSpecies   = "species"
+    DetailPlant     = "plant"
+    DetailEquipment = "equipment"
+)
+
+// NormalizeDetailType maps the detail type spellings used by the API ("plant" and
+// "plants" are both in use) to one of the Detail constants.
+func NormalizeDetailType(detailType string) (string, error) {
+    switch detailType {
+    case "species":
+        return DetailSpecies, nil
+    case "plant", "plants":
+        return DetailPlant, nil
+    case "equipment":
+        return DetailEquipment, nil
+    default:
+        return "", errors.New("Invalid detail type")
+    }
+}
+
+// ValidationError reports every problem found with a catalog detail.
+type ValidationError struct {
+    Problems []string
+}
+
+func (e *ValidationError) Error() string {
+    return "invalid detail: " + strings.Join(e.Problems, "; ")
+}
+
+// requireFields collects a problem for every empty required field.
+func requireFields(fields map[string]string) []string {
+    var problems []string
+    for name, value := range fields {
+        if strings.TrimSpace(value) == "" {
+            problems = append(problems, name+" is required")
+        }
+    }
+    sort.Strings(problems)
+    return problems
+}
+
+// validationResult wraps problems in a ValidationError, or returns nil if there are none.
+func validationResult(problems []string) error {
+    if len(problems) == 0 {
+        return nil
+    }
+    return &ValidationError{Problems: problems}
+}
+
+// Validate checks that the required species fields are present.
+func (s *Species) Validate() error {
+    problems := requireFields(map[string]string{
+        "name":             s.Name,
+        "role":             s.Role,
+        "type":             s.Type,
+        "description":      s.Description,
+        "feedingHabits":    s.FeedingHabits,
+        "tankRequirements": s.TankRequirements,
+        "compatibility":    s.Compatibility,
+    })
+    if s.MinTankSize <= 0 {
+        problems = append(problems, "minTankSize must be positive")
+    }
+    return validationResult(problems)
+}
+
+// Validate checks that the required plant fields are present.
+func (p *Plant) Validate() error {
+    problems := requireFields(map[string]string{
+        "name":             p.Name,
+        "role":             p.Role,
+        "type":             p.Type,
+        "description":      p.Description,
+        "tankRequirements": p.TankRequirements,
+        "compatibility":    p.Compatibility,
+    })
+    if p.MinTankSize <= 0 {
+        problems = append(problems, "minTankSize must be positive")
+    }
+    return validationResult(problems)
+}
+
+// Validate checks that the required equipment fields are present and that Fields is
+// a JSON array of unique, non-empty field names such as ["Brand", "Model Name"].
+func (e *Equipment) Validate() error {
+    problems := requireFields(map[string]string{
+        "name":        e.Name,
+        "description": e.Description,
+        "role":        e.Role,
+        "importance":  e.Importance,
+        "usage":       e.Usage,
+        "type":        e.Type,
+    })
+
+    var fieldNames []string
+    if len(e.Fields) == 0 {
+        problems = append(problems, "fields is required")
+    } else if err := json.Unmarshal(e.Fields, &fieldNames); err != nil || fieldNames == nil {
+        problems = append(problems, "fields must be an array of field names")
+    } else {
+        seen := make(map[string]bool)
+        for _, name := range fieldNames {
+            if strings.TrimSpace(name) == "" {
+                problems = append(problems, "fields must not contain empty names")
+                break
+            }
+            if seen[name] {
+                problems = append(problems, fmt.Sprintf("fields contains duplicate name %q", name))
+                break
+            }
+            seen[name] = true
+        }
+    }
+    return validationResult(problems)
+}
+
+// CatalogAuditEntry is a change made to the catalog. It is recorded in the audit log
+// with the action "catalog.<Action>" and the detail type as the target type.
+type CatalogAuditEntry struct {
+    Actor      Actor       // User who made the change
+    Action     string      // "create", "update" or "delete"
+    DetailType string      // One of the Detail constants
+    DetailID   string      // ID of the changed detail
+    Before     interface{} // State before the change, nil for creates
+    After      interface{} // State after the change, nil for deletes
+}
+
+// withCatalogAudit runs a catalog mutation and records its audit entry in one transaction.
+func (s *PostgresStore) withCatalogAudit(ctx context.Context, entry CatalogAuditEntry, mutate func(tx *sql.Tx) (sql.Result, error)) error {
+    details := map[string]interface{}{}
+    if entry.Before != nil {
+        details["before"] = entry.Before
+    }
+    if entry.After != nil {
+        details["after"] = entry.After
+    }
+
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    defer tx.Rollback()
+
+    result, err := mutate(tx)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    if rowsAffected == 0 {
+        return sql.ErrNoRows
+    }
+
+    err = insertAuditEvent(ctx, tx, AuditEvent{
+        ActorID:    entry.Actor.UserID,
+        Action:     "catalog." + entry.Action,
+        TargetType: entry.DetailType,
+        TargetID:   entry.DetailID,
+        IP:         entry.Actor.IP,
+        UserAgent:  entry.Actor.UserAgent,
+        Outcome:    OutcomeSuccess,
+        Details:    details,
+    })
+    if err != nil {
+        return queryError(ctx, err)
+    }
+
+    return queryError(ctx, tx.Commit())
+}
+
+// marshalNullable marshals v to JSON, mapping nil to a SQL NULL.
+func marshalNullable(v interface{}) (interface{}, error) {
+    if v == nil {
+        return nil, nil
+    }
+    data, err := json.Marshal(v)
+    if err != nil {
+        return nil, err
+    }
+    return string(data), nil
+}
+
+// NewID generates a random (version 4) UUID.
+func NewID() (string, error) {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    b[6] = (b[6] & 0x0f) | 0x40
+    b[8] = (b[8] & 0x3f) | 0x80
+    return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// CreateSpecies inserts a new species into the catalog, assigning an ID if none was given.
+func (s *PostgresStore) CreateSpecies(ctx context.Context, species *Species, actor Actor) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    if species.Id == "" {
+        id, err := NewID()
+        if err != nil {
+            return queryError(ctx, err)
+        }
+        species.Id = id
+    }
+
+    entry := CatalogAuditEntry{Actor: actor, Action: "create", DetailType: DetailSpecies, DetailID: species.Id, After: species}
+    return s.withCatalogAudit(ctx, entry, func(tx *sql.Tx) (sql.Result, error) {
+        query := `
+            INSERT INTO species (id, name, image_url, role, type, description, feeding_habits, tank_requirements,
+                                 compatibility, lifespan, size, water_parameters, breeding_info, behavior, care_level,
+                                 dietary_restrictions, native_habitat, stocking_recommendations, special_considerations,
+                                 min_tank_size, scientific_name, wikipedia_link)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)
+        `
+        return tx.ExecContext(ctx, query, species.Id, species.Name, species.ImageURL, species.Role, species.Type, species.Description,
+            species.FeedingHabits, species.TankRequirements, species.Compatibility, species.Lifespan, species.Size,
+            species.WaterParameters, species.BreedingInfo, species.Behavior, species.CareLevel, species.DietaryRestrictions,
+            species.NativeHabitat, species.StockingRecommendations, species.SpecialConsiderations, species.MinTankSize,
+            species.ScientificName, species.WikipediaLink)
+    })
+}
+
+// UpdateSpecies replaces an existing species in the catalog.
+// It returns sql.ErrNoRows if the species does not exist.
+func (s *PostgresStore) UpdateSpecies(ctx context.Context, species *Species, actor Actor) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    before, err := s.GetDetailByID(ctx, species.Id, DetailSpecies)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+
+    entry := CatalogAuditEntry{Actor: actor, Action: "update", DetailType: DetailSpecies, DetailID: species.Id, Before: before, After: species}
+    return s.withCatalogAudit(ctx, entry, func(tx *sql.Tx) (sql.Result, error) {
+        query := `
+            UPDATE species
+            SET name = $2, image_url = $3, role = $4, type = $5, description = $6, feeding_habits = $7,
+                tank_requirements = $8, compatibility = $9, lifespan = $10, size = $11, water_parameters = $12,
+                breeding_info = $13, behavior = $14, care_level = $15, dietary_restrictions = $16, native_habitat = $17,
+                stocking_recommendations = $18, special_considerations = $19, min_tank_size = $20,
+                scientific_name = $21, wikipedia_link = $22
+            WHERE id = $1
+        `
+        return tx.ExecContext(ctx, query, species.Id, species.Name, species.ImageURL, species.Role, species.Type, species.Description,
+            species.FeedingHabits, species.TankRequirements, species.Compatibility, species.Lifespan, species.Size,
+            species.WaterParameters, species.BreedingInfo, species.Behavior, species.CareLevel, species.DietaryRestrictions,
+            species.NativeHabitat, species.StockingRecommendations, species.SpecialConsiderations, species.MinTankSize,
+            species.ScientificName, species.WikipediaLink)
+    })
+}
+
+// CreatePlant inserts a new plant into the catalog, assigning an ID if none was given.
+func (s *PostgresStore) CreatePlant(ctx context.Context, plant *Plant, actor Actor) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    if plant.Id == "" {
+        id, err := NewID()
+        if err != nil {
+            return queryError(ctx, err)
+        }
+        plant.Id = id
+    }
+
+    entry := CatalogAuditEntry{Actor: actor, Action: "create", DetailType: DetailPlant, DetailID: plant.Id, After: plant}
+    return s.withCatalogAudit(ctx, entry, func(tx *sql.Tx) (sql.Result, error) {
+        query := `
+            INSERT INTO plants (id, name, role, type, description, tank_requirements, min_tank_size, compatibility,
+                                lifespan, size, water_parameters, lighting_needs, growth_rate, care_level, native_habitat,
+                                propagation_methods, special_considerations, image_url, scientific_name, wikipedia_link)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
+        `
+        return tx.ExecContext(ctx, query, plant.Id, plant.Name, plant.Role, plant.Type, plant.Description, plant.TankRequirements,
+            plant.MinTankSize, plant.Compatibility, plant.Lifespan, plant.Size, plant.WaterParameters, plant.LightingNeeds,
+            plant.GrowthRate, plant.CareLevel, plant.NativeHabitat, plant.PropagationMethods, plant.SpecialConsiderations,
+            plant.ImageURL, plant.ScientificName, plant.WikipediaLink)
+    })
+}
+
+// UpdatePlant replaces an existing plant in the catalog.
+// It returns sql.ErrNoRows if the plant does not exist.
+func (s *PostgresStore) UpdatePlant(ctx context.Context, plant *Plant, actor Actor) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    before, err := s.GetDetailByID(ctx, plant.Id, DetailPlant)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+
+    entry := CatalogAuditEntry{Actor: actor, Action: "update", DetailType: DetailPlant, DetailID: plant.Id, Before: before, After: plant}
+    return s.withCatalogAudit(ctx, entry, func(tx *sql.Tx) (sql.Result, error) {
+        query := `
+            UPDATE plants
+            SET name = $2, role = $3, type = $4, description = $5, tank_requirements = $6, min_tank_size = $7,
+                compatibility = $8, lifespan = $9, size = $10, water_parameters = $11, lighting_needs = $12,
+                growth_rate = $13, care_level = $14, native_habitat = $15, propagation_methods = $16,
+                special_considerations = $17, image_url = $18, scientific_name = $19, wikipedia_link = $20
+            WHERE id = $1
+        `
+        return tx.ExecContext(ctx, query, plant.Id, plant.Name, plant.Role, plant.Type, plant.Description, plant.TankRequirements,
+            plant.MinTankSize, plant.Compatibility, plant.Lifespan, plant.Size, plant.WaterParameters, plant.LightingNeeds,
+            plant.GrowthRate, plant.CareLevel, plant.NativeHabitat, plant.PropagationMethods, plant.SpecialConsiderations,
+            plant.ImageURL, plant.ScientificName, plant.WikipediaLink)
+    })
+}
+
+// CreateEquipment inserts a new equipment item into the catalog, assigning an ID if none was given.
+func (s *PostgresStore) CreateEquipment(ctx context.Context, equipment *Equipment, actor Actor) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    if equipment.Id == "" {
+        id, err := NewID()
+        if err != nil {
+            return queryError(ctx, err)
+        }
+        equipment.Id = id
+    }
+
+    entry := CatalogAuditEntry{Actor: actor, Action: "create", DetailType: DetailEquipment, DetailID: equipment.Id, After: equipment}
+    return s.withCatalogAudit(ctx, entry, func(tx *sql.Tx) (sql.Result, error) {
+        query := `
+            INSERT INTO equipment (id, name, description, role, importance, usage, special_considerations, fields, type)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8::jsonb, $9)
+        `
+        return tx.ExecContext(ctx, query, equipment.Id, equipment.Name, equipment.Description, equipment.Role, equipment.Importance,
+            equipment.Usage, equipment.SpecialConsiderations, string(equipment.Fields), equipment.Type)
+    })
+}
+
+// UpdateEquipment replaces an existing equipment item in the catalog.
+// It returns sql.ErrNoRows if the equipment does not exist.
+func (s *PostgresStore) UpdateEquipment(ctx context.Context, equipment *Equipment, actor Actor) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    before, err := s.GetDetailByID(ctx, equipment.Id, DetailEquipment)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+
+    entry := CatalogAuditEntry{Actor: actor, Action: "update", DetailType: DetailEquipment, DetailID: equipment.Id, Before: before, After: equipment}
+    return s.withCatalogAudit(ctx, entry, func(tx *sql.Tx) (sql.Result, error) {
+        query := `
+            UPDATE equipment
+            SET name = $2, description = $3, role = $4, importance = $5, usage = $6,
+                special_considerations = $7, fields = $8::jsonb, type = $9
+            WHERE id = $1
+        `
+        return tx.ExecContext(ctx, query, equipment.Id, equipment.Name, equipment.Description, equipment.Role, equipment.Importance,
+            equipment.Usage, equipment.SpecialConsiderations, string(equipment.Fields), equipment.Type)
+    })
+}
+
+// DeleteDetail removes a species, plant or equipment item from the catalog.
+// It returns sql.ErrNoRows if the detail does not exist and ErrDetailInUse if it is kept
+// in an aquarium.
+func (s *PostgresStore) DeleteDetail(ctx context.Context, detailType string, id string, actor Actor) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    tables := map[string]string{
+        DetailSpecies:   "species",
+        DetailPlant:     "plants",
+        DetailEquipment: "equipment",
+    }
+    tableName, ok := tables[detailType]
+    if !ok {
+        return errors.New("Invalid detail type")
+    }
+
+    before, err := s.GetDetailByID(ctx, id, detailType)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+
+    entry := CatalogAuditEntry{Actor: actor, Action: "delete", DetailType: detailType, DetailID: id, Before: before}
+    return s.withCatalogAudit(ctx, entry, func(tx *sql.Tx) (sql.Result, error) {
+        result, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = $1`, tableName), id)
+        var pqErr *pq.Error
+        if errors.As(err, &pqErr) && pqErr.Code == "23503" { // foreign_key_violation
+            return nil, ErrDetailInUse
+        }
+        return result, err
+    })
+}
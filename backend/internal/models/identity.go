@@ -0,0 +1,151 @@
+// models/identity.go
+
+package models
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "time"
+
+    "github.com/lib/pq"
+)
+
+// Identity links an account at an external identity provider to a user. A user may
+// link any number of identities; each external identity belongs to at most one user.
+//
+// The schema is defined by migration 0010_user_identities in internal/migrate.
+type Identity struct {
+    Provider   string     `json:"provider"`   // Name of the identity provider
+    Subject    string     `json:"subject"`    // User identifier at the provider
+    Email      string     `json:"email"`      // Email address the provider reported when linking
+    CreatedAt  time.Time  `json:"createdAt"`  // When the identity was linked
+    LastUsedAt *time.Time `json:"lastUsedAt"` // When the identity was last used to sign in
+}
+
+// ErrIdentityLinked is returned when an external identity is already linked to a user.
+var ErrIdentityLinked = errors.New("identity already linked")
+
+// GetUserByIdentity retrieves the user an external identity is linked to and records
+// that the identity was used to sign in.
+func (s *PostgresStore) GetUserByIdentity(ctx context.Context, provider string, subject string) (*User, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        WITH used AS (
+            UPDATE user_identities SET last_used_at = now()
+            WHERE provider = $1 AND subject = $2
+            RETURNING user_id
+        )
+        SELECT ` + userColumns + ` FROM users WHERE id = (SELECT user_id FROM used)
+    `
+    user, err := scanUser(s.db.QueryRowContext(ctx, query, provider, subject))
+    return user, queryError(ctx, err)
+}
+
+// LinkIdentity links an external identity to a user.
+// It returns ErrIdentityLinked if the identity is already linked to any user.
+func (s *PostgresStore) LinkIdentity(ctx context.Context, userID string, provider string, subject string, email string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, NULLIF($4, ''))`
+    _, err := s.db.ExecContext(ctx, query, userID, provider, subject, email)
+    var pqErr *pq.Error
+    if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+        return ErrIdentityLinked
+    }
+    return queryError(ctx, err)
+}
+
+// CreateUserWithIdentity registers a new user signing up through an external identity,
+// as CreateUser does, and links the identity in the same transaction, so that a failed
+// link leaves no account behind to block the email address. The email is marked verified
+// if the provider vouches for it.
+// It returns ErrIdentityLinked if the identity is already linked to any user.
+func (s *PostgresStore) CreateUserWithIdentity(ctx context.Context, email, password, firstName string, username string, subscribe string, createdAt string, identity Identity, verified bool) (string, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return "", queryError(ctx, err)
+    }
+    defer tx.Rollback()
+
+    var userID string
+    query := `
+        INSERT INTO users (email, password, first_name, username, subscribe, created_at, verified_at)
+        VALUES ($1, $2, $3, $4, $5, $6, CASE WHEN $7::boolean THEN now() END)
+        RETURNING id
+    `
+    err = tx.QueryRowContext(ctx, query, email, password, firstName, username, subscribe, createdAt, verified).Scan(&userID)
+    if err != nil {
+        return "", queryError(ctx, err)
+    }
+
+    query = `INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, NULLIF($4, ''))`
+    _, err = tx.ExecContext(ctx, query, userID, identity.Provider, identity.Subject, identity.Email)
+    var pqErr *pq.Error
+    if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+        return "", ErrIdentityLinked
+    }
+    if err != nil {
+        return "", queryError(ctx, err)
+    }
+
+    return userID, queryError(ctx, tx.Commit())
+}
+
+// ListIdentities retrieves the external identities linked to a user.
+func (s *PostgresStore) ListIdentities(ctx context.Context, userID string) ([]Identity, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        SELECT provider, subject, COALESCE(email, ''), created_at, last_used_at
+        FROM user_identities
+        WHERE user_id = $1
+        ORDER BY created_at
+    `
+    rows, err := s.db.QueryContext(ctx, query, userID)
+    if err != nil {
+        return nil, queryError(ctx, err)
+    }
+    defer rows.Close()
+
+    identities := []Identity{}
+    for rows.Next() {
+        var identity Identity
+        err := rows.Scan(&identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt, &identity.LastUsedAt)
+        if err != nil {
+            return nil, queryError(ctx, err)
+        }
+        identities = append(identities, identity)
+    }
+    return identities, queryError(ctx, rows.Err())
+}
+
+// UnlinkIdentity removes an external identity from a user.
+// It returns sql.ErrNoRows if the user has no such identity.
+func (s *PostgresStore) UnlinkIdentity(ctx context.Context, userID string, provider string, subject string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `DELETE FROM user_identities WHERE user_id = $1 AND provider = $2 AND subject = $3`
+    result, err := s.db.ExecContext(ctx, query, userID, provider, subject)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    if rowsAffected == 0 {
+        return sql.ErrNoRows
+    }
+
+    return nil
+}
@@ -0,0 +1,75 @@
+// models/login_attempts.go
+
+package models
+
+import (
+    "context"
+    "database/sql"
+    "time"
+)
+
+// Failed login attempts are counted per throttle key, e.g. "account:<email>" or
+// "ip:<address>", so that lockouts survive restarts and are shared between replicas.
+//
+// The schema is defined by migration 0009_login_throttling in internal/migrate.
+
+// RecordLoginFailure counts a failed login attempt against a throttle key and returns the
+// number of consecutive failures. The count starts over when the previous failure is
+// older than resetAfter.
+func (s *PostgresStore) RecordLoginFailure(ctx context.Context, key string, resetAfter time.Duration) (int, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    var failures int
+    query := `
+        INSERT INTO login_attempts (key, failures, last_failure_at)
+        VALUES ($1, 1, now())
+        ON CONFLICT (key) DO UPDATE SET
+            failures = CASE
+                WHEN login_attempts.last_failure_at < now() - make_interval(secs => $2) THEN 1
+                ELSE login_attempts.failures + 1
+            END,
+            last_failure_at = now()
+        RETURNING failures
+    `
+    err := s.db.QueryRowContext(ctx, query, key, resetAfter.Seconds()).Scan(&failures)
+    return failures, queryError(ctx, err)
+}
+
+// SetLoginLockout blocks logins for a throttle key until the given time.
+func (s *PostgresStore) SetLoginLockout(ctx context.Context, key string, until time.Time) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `UPDATE login_attempts SET locked_until = $1 WHERE key = $2`
+    _, err := s.db.ExecContext(ctx, query, until, key)
+    return queryError(ctx, err)
+}
+
+// GetLoginLockout returns when the lockout of a throttle key ends.
+// The zero time is returned if the key is not locked out.
+func (s *PostgresStore) GetLoginLockout(ctx context.Context, key string) (time.Time, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    var lockedUntil sql.NullTime
+    query := `SELECT locked_until FROM login_attempts WHERE key = $1 AND locked_until > now()`
+    err := s.db.QueryRowContext(ctx, query, key).Scan(&lockedUntil)
+    if err == sql.ErrNoRows {
+        return time.Time{}, nil
+    }
+    if err != nil {
+        return time.Time{}, queryError(ctx, err)
+    }
+    return lockedUntil.Time, nil
+}
+
+// ClearLoginFailures forgets the failed attempts of a throttle key after a successful login.
+func (s *PostgresStore) ClearLoginFailures(ctx context.Context, key string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `DELETE FROM login_attempts WHERE key = $1`
+    _, err := s.db.ExecContext(ctx, query, key)
+    return queryError(ctx, err)
+}
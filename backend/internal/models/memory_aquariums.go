@@ -0,0 +1,1033 @@
+// models/memory_aquariums.go
+
+package models
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "sort"
+    "strings"
+    "time"
+)
+
+// The aquarium, sharing, catalog and parameter parts of MemoryStore.
+
+type memoryAquarium struct {
+    Aquarium
+    seq int64
+}
+
+type memoryMember struct {
+    Role      string
+    InvitedBy string
+    JoinedAt  time.Time
+    seq       int64
+}
+
+type memoryInvitation struct {
+    AquariumInvitation
+    seq int64
+}
+
+type memoryShareLink struct {
+    ShareLink
+    RevokedAt *time.Time
+    seq       int64
+}
+
+// cloneAquarium copies an aquarium so that stored and returned values share no slices.
+func cloneAquarium(aquarium Aquarium) Aquarium {
+    clone := aquarium
+    clone.Species = append([]AquariumSpecies(nil), aquarium.Species...)
+    clone.Plants = append([]AquariumPlant(nil), aquarium.Plants...)
+    clone.Equipment = nil
+    for _, equipment := range aquarium.Equipment {
+        clone.Equipment = append(clone.Equipment, cloneEquipment(equipment))
+    }
+    clone.ParameterEntries = nil
+    return clone
+}
+
+// checkAquariumStock fills in the catalog names of the species and plants of an aquarium,
+// as saveAquariumStock does, or returns an *UnknownCatalogError if any of its stock is
+// missing from the catalog.
+func (s *MemoryStore) checkAquariumStock(aquarium *Aquarium) error {
+    unknown := &UnknownCatalogError{}
+    seen := make(map[string]bool)
+    for _, species := range aquarium.Species {
+        if _, ok := s.species[species.Id]; !ok && !seen["species/"+species.Id] {
+            seen["species/"+species.Id] = true
+            unknown.Species = append(unknown.Species, species.Id)
+        }
+    }
+    for _, plant := range aquarium.Plants {
+        if _, ok := s.plants[plant.Id]; !ok && !seen["plant/"+plant.Id] {
+            seen["plant/"+plant.Id] = true
+            unknown.Plants = append(unknown.Plants, plant.Id)
+        }
+    }
+    for _, equipment := range aquarium.Equipment {
+        if _, ok := s.equipment[equipment.Id]; !ok && !seen["equipment/"+equipment.Id] {
+            seen["equipment/"+equipment.Id] = true
+            unknown.Equipment = append(unknown.Equipment, equipment.Id)
+        }
+    }
+    if len(unknown.Species) > 0 || len(unknown.Plants) > 0 || len(unknown.Equipment) > 0 {
+        return unknown
+    }
+
+    for i := range aquarium.Species {
+        aquarium.Species[i].Name = s.species[aquarium.Species[i].Id].Name
+    }
+    for i := range aquarium.Plants {
+        aquarium.Plants[i].Name = s.plants[aquarium.Plants[i].Id].Name
+    }
+    return nil
+}
+
+// CreateAquarium stores a new aquarium and records its first revision.
+func (s *MemoryStore) CreateAquarium(ctx context.Context, aquarium *Aquarium, actor Actor) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if aquarium.ID == "" {
+        return errors.New("aquarium ID is required")
+    }
+    if _, ok := s.aquariums[aquarium.ID]; ok {
+        return fmt.Errorf("aquarium %q already exists", aquarium.ID)
+    }
+    if _, ok := s.users[aquarium.UserID]; !ok {
+        return missingReference("user", aquarium.UserID)
+    }
+    if err := s.checkAquariumStock(aquarium); err != nil {
+        return err
+    }
+    aquarium.Version = 1
+    s.aquariums[aquarium.ID] = &memoryAquarium{Aquarium: cloneAquarium(*aquarium), seq: s.nextSeq()}
+    s.recordAquariumRevision(aquarium.ID, actor, RevisionCreate, 0)
+    return nil
+}
+
+// aquariumResponse resolves the catalog details of the stock of a stored aquarium.
+// Equipment fields entered for the aquarium replace those of the catalog.
+func (s *MemoryStore) aquariumResponse(aquarium *memoryAquarium) AquariumResponse {
+    response := AquariumResponse{
+        ID:        aquarium.ID,
+        UserID:    aquarium.UserID,
+        Version:   aquarium.Version,
+        Name:      aquarium.Name,
+        Type:      aquarium.Type,
+        Size:      aquarium.Size,
+        Species:   []Species{},
+        Plants:    []Plant{},
+        Equipment: []Equipment{},
+    }
+
+    speciesCounts := make(map[string]int)
+    var speciesIDs []string
+    for _, species := range aquarium.Species {
+        if _, seen := speciesCounts[species.Id]; !seen {
+            speciesIDs = append(speciesIDs, species.Id)
+        }
+        speciesCounts[species.Id] = species.Count
+    }
+    for _, id := range speciesIDs {
+        if species, ok := s.species[id]; ok {
+            species.Count = speciesCounts[id]
+            response.Species = append(response.Species, species)
+        }
+    }
+
+    plantCounts := make(map[string]int)
+    var plantIDs []string
+    for _, plant := range aquarium.Plants {
+        if _, seen := plantCounts[plant.Id]; !seen {
+            plantIDs = append(plantIDs, plant.Id)
+        }
+        plantCounts[plant.Id] = plant.Count
+    }
+    for _, id := range plantIDs {
+        if plant, ok := s.plants[id]; ok {
+            plant.Count = plantCounts[id]
+            response.Plants = append(response.Plants, plant)
+        }
+    }
+
+    for _, entry := range aquarium.Equipment {
+        if equipment, ok := s.equipment[entry.Id]; ok {
+            if len(entry.Fields) > 0 && string(entry.Fields) != "null" {
+                equipment.Fields = entry.Fields
+            }
+            response.Equipment = append(response.Equipment, cloneEquipment(equipment))
+        }
+    }
+    return response
+}
+
+// GetAquariumsByUserID retrieves the aquariums a user owns or that are shared with them,
+// along with the user's role on each.
+func (s *MemoryStore) GetAquariumsByUserID(ctx context.Context, userID string, options AquariumListOptions) ([]AquariumResponse, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var visible []*memoryAquarium
+    for _, aquarium := range s.aquariums {
+        if s.aquariumRole(aquarium, userID) != "" {
+            visible = append(visible, aquarium)
+        }
+    }
+    sort.Slice(visible, func(i, j int) bool { return visible[i].seq < visible[j].seq })
+
+    var aquariums []AquariumResponse
+    for _, aquarium := range visible {
+        response := s.aquariumResponse(aquarium)
+        response.Role = s.aquariumRole(aquarium, userID)
+        if options.IncludeParameters {
+            response.ParameterEntries = s.parameterEntriesOf(aquarium.ID)
+            if options.ParameterLimit > 0 && len(response.ParameterEntries) > options.ParameterLimit {
+                response.ParameterEntries = response.ParameterEntries[:options.ParameterLimit]
+            }
+        }
+        aquariums = append(aquariums, response)
+    }
+    return aquariums, nil
+}
+
+// GetAquariumByID retrieves an aquarium by its ID with all of its parameter entries.
+func (s *MemoryStore) GetAquariumByID(ctx context.Context, id string) (*AquariumResponse, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    aquarium, ok := s.aquariums[id]
+    if !ok {
+        return nil, sql.ErrNoRows
+    }
+    response := s.aquariumResponse(aquarium)
+    response.ParameterEntries = s.parameterEntriesOf(aquarium.ID)
+    return &response, nil
+}
+
+// UpdateAquarium updates an existing aquarium if it is still at aquarium.Version (any
+// version if 0), fills in its owner and new version and records the update as a revision.
+func (s *MemoryStore) UpdateAquarium(ctx context.Context, aquarium *Aquarium, actor Actor) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if err := s.updateAquarium(aquarium); err != nil {
+        return err
+    }
+    s.recordAquariumRevision(aquarium.ID, actor, RevisionUpdate, 0)
+    return nil
+}
+
+// updateAquarium updates an aquarium as described for UpdateAquarium, without recording
+// a revision.
+func (s *MemoryStore) updateAquarium(aquarium *Aquarium) error {
+    stored, ok := s.aquariums[aquarium.ID]
+    if !ok {
+        return sql.ErrNoRows
+    }
+    if aquarium.Version != 0 && stored.Version != aquarium.Version {
+        return ErrVersionConflict
+    }
+    if err := s.checkAquariumStock(aquarium); err != nil {
+        return err
+    }
+    aquarium.UserID = stored.UserID
+    aquarium.Version = stored.Version + 1
+    stored.Aquarium = cloneAquarium(*aquarium)
+    return nil
+}
+
+// AdjustAquariumStock adds or removes some of one species or plant of an aquarium, and
+// fills in the resulting count and the new version of the aquarium. The change is
+// recorded as a revision.
+func (s *MemoryStore) AdjustAquariumStock(ctx context.Context, adjustment *StockAdjustment, actor Actor) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if _, ok := stockTables[adjustment.DetailType]; !ok {
+        return errors.New("Invalid detail type")
+    }
+    stored, ok := s.aquariums[adjustment.AquariumID]
+    if !ok {
+        return sql.ErrNoRows
+    }
+    if adjustment.Version != 0 && stored.Version != adjustment.Version {
+        return ErrVersionConflict
+    }
+
+    // Work on the stock as stock items, whatever its kind
+    var items []stockItem
+    if adjustment.DetailType == DetailSpecies {
+        items = distinctItems(speciesItems(stored.Species))
+    } else {
+        items = distinctItems(plantItems(stored.Plants))
+    }
+    index := -1
+    for i, item := range items {
+        if item.id == adjustment.DetailID {
+            index = i
+        }
+    }
+
+    if adjustment.Delta > 0 && !adjustment.RemoveAll {
+        if index < 0 {
+            _, err := s.detail(adjustment.DetailID, adjustment.DetailType)
+            if errors.Is(err, sql.ErrNoRows) {
+                unknown := &UnknownCatalogError{}
+                if adjustment.DetailType == DetailSpecies {
+                    unknown.Species = []string{adjustment.DetailID}
+                } else {
+                    unknown.Plants = []string{adjustment.DetailID}
+                }
+                return unknown
+            }
+            if err != nil {
+                return err
+            }
+            items = append(items, stockItem{id: adjustment.DetailID})
+            index = len(items) - 1
+        }
+        items[index].count += adjustment.Delta
+        adjustment.Count = items[index].count
+    } else {
+        if index < 0 {
+            return ErrStockNotFound
+        }
+        items[index].count += adjustment.Delta
+        if adjustment.RemoveAll || items[index].count <= 0 {
+            items = append(items[:index], items[index+1:]...)
+            adjustment.Count = 0
+        } else {
+            adjustment.Count = items[index].count
+        }
+    }
+
+    if adjustment.DetailType == DetailSpecies {
+        stored.Species = nil
+        for _, item := range items {
+            stored.Species = append(stored.Species, AquariumSpecies{Id: item.id, Count: item.count, Name: s.species[item.id].Name})
+        }
+    } else {
+        stored.Plants = nil
+        for _, item := range items {
+            stored.Plants = append(stored.Plants, AquariumPlant{Id: item.id, Count: item.count, Name: s.plants[item.id].Name})
+        }
+    }
+    stored.Version++
+    adjustment.Version = stored.Version
+    s.recordAquariumRevision(adjustment.AquariumID, actor, RevisionStock, 0)
+    return nil
+}
+
+// aquariumSnapshot returns the state of a stored aquarium as recorded by revisions, as
+// loadAquariumSnapshot does.
+func (s *MemoryStore) aquariumSnapshot(aquarium *memoryAquarium) *AquariumSnapshot {
+    snapshot := &AquariumSnapshot{
+        Name:      aquarium.Name,
+        Type:      aquarium.Type,
+        Size:      aquarium.Size,
+        Species:   []AquariumSpecies{},
+        Plants:    []AquariumPlant{},
+        Equipment: []AquariumEquipment{},
+    }
+    for _, item := range distinctItems(speciesItems(aquarium.Species)) {
+        snapshot.Species = append(snapshot.Species, AquariumSpecies{Id: item.id, Count: item.count, Name: s.species[item.id].Name})
+    }
+    for _, item := range distinctItems(plantItems(aquarium.Plants)) {
+        snapshot.Plants = append(snapshot.Plants, AquariumPlant{Id: item.id, Count: item.count, Name: s.plants[item.id].Name})
+    }
+    for _, entry := range aquarium.Equipment {
+        equipment := AquariumEquipment{Id: entry.Id, Name: s.equipment[entry.Id].Name}
+        if len(entry.Fields) > 0 && string(entry.Fields) != "null" {
+            equipment.Fields = append(json.RawMessage(nil), entry.Fields...)
+        }
+        snapshot.Equipment = append(snapshot.Equipment, equipment)
+    }
+    return snapshot
+}
+
+// recordAquariumRevision records the current state of a stored aquarium as a revision.
+func (s *MemoryStore) recordAquariumRevision(aquariumID string, actor Actor, action string, restoredFrom int64) {
+    aquarium := s.aquariums[aquariumID]
+    snapshot := s.aquariumSnapshot(aquarium)
+
+    var before *AquariumSnapshot
+    if revisions := s.revisions[aquariumID]; len(revisions) > 0 {
+        before = revisions[len(revisions)-1].Snapshot
+    }
+    s.revisions[aquariumID] = append(s.revisions[aquariumID], AquariumRevision{
+        AquariumID:   aquariumID,
+        Version:      aquarium.Version,
+        ActorID:      actor.UserID,
+        Action:       action,
+        RestoredFrom: restoredFrom,
+        CreatedAt:    s.now(),
+        Changes:      diffSnapshots(before, snapshot),
+        Snapshot:     snapshot,
+    })
+}
+
+// ListAquariumRevisions lists the revisions of an aquarium, newest first, without their
+// snapshots. A limit of 0 lists all of them.
+func (s *MemoryStore) ListAquariumRevisions(ctx context.Context, aquariumID string, limit int) ([]AquariumRevision, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    revisions := []AquariumRevision{}
+    stored := s.revisions[aquariumID]
+    for i := len(stored) - 1; i >= 0; i-- {
+        if limit > 0 && len(revisions) == limit {
+            break
+        }
+        revision := stored[i]
+        revision.Snapshot = nil
+        revisions = append(revisions, revision)
+    }
+    return revisions, nil
+}
+
+// GetAquariumRevision retrieves the revision of an aquarium that produced the given
+// version, with its snapshot.
+func (s *MemoryStore) GetAquariumRevision(ctx context.Context, aquariumID string, version int64) (*AquariumRevision, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for _, revision := range s.revisions[aquariumID] {
+        if revision.Version == version {
+            return &revision, nil
+        }
+    }
+    return nil, sql.ErrNoRows
+}
+
+// GetAquariumRevisionAt retrieves the last revision of an aquarium recorded by the given
+// time, with its snapshot.
+func (s *MemoryStore) GetAquariumRevisionAt(ctx context.Context, aquariumID string, at time.Time) (*AquariumRevision, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    revisions := s.revisions[aquariumID]
+    for i := len(revisions) - 1; i >= 0; i-- {
+        if !revisions[i].CreatedAt.After(at) {
+            revision := revisions[i]
+            return &revision, nil
+        }
+    }
+    return nil, sql.ErrNoRows
+}
+
+// RestoreAquariumRevision restores an aquarium to the state recorded by one of its
+// revisions if it is still at version (any version if 0), records the restore as a new
+// revision and returns the new version.
+func (s *MemoryStore) RestoreAquariumRevision(ctx context.Context, aquariumID string, revision int64, version int64, actor Actor) (int64, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var snapshot *AquariumSnapshot
+    for _, stored := range s.revisions[aquariumID] {
+        if stored.Version == revision {
+            snapshot = stored.Snapshot
+        }
+    }
+    if snapshot == nil {
+        return 0, sql.ErrNoRows
+    }
+
+    aquarium := snapshot.Aquarium(aquariumID)
+    aquarium.Version = version
+    if err := s.updateAquarium(&aquarium); err != nil {
+        return 0, err
+    }
+    s.recordAquariumRevision(aquariumID, actor, RevisionRestore, revision)
+    return aquarium.Version, nil
+}
+
+// DeleteAquarium deletes an aquarium.
+func (s *MemoryStore) DeleteAquarium(ctx context.Context, id string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if _, ok := s.aquariums[id]; !ok {
+        return sql.ErrNoRows
+    }
+    s.deleteAquarium(id)
+    return nil
+}
+
+// deleteAquarium deletes an aquarium together with everything referring to it.
+func (s *MemoryStore) deleteAquarium(id string) {
+    entries := s.parameterEntries[:0]
+    for _, entry := range s.parameterEntries {
+        if entry.AquariumID != id {
+            entries = append(entries, entry)
+        }
+    }
+    s.parameterEntries = entries
+
+    delete(s.members, id)
+    delete(s.revisions, id)
+    for hash, invitation := range s.invitations {
+        if invitation.AquariumID == id {
+            delete(s.invitations, hash)
+        }
+    }
+    for hash, link := range s.shareLinks {
+        if link.AquariumID == id {
+            delete(s.shareLinks, hash)
+        }
+    }
+    for hash, token := range s.accessTokens {
+        if token.AquariumID == id {
+            delete(s.accessTokens, hash)
+        }
+    }
+    delete(s.aquariums, id)
+}
+
+// aquariumRole returns the role a user holds on an aquarium, or "" if they have none.
+func (s *MemoryStore) aquariumRole(aquarium *memoryAquarium, userID string) string {
+    if aquarium.UserID == userID {
+        return AquariumRoleOwner
+    }
+    if member, ok := s.members[aquarium.ID][userID]; ok {
+        return member.Role
+    }
+    return ""
+}
+
+// GetAquariumRole returns the role a user holds on an aquarium, or "" if the aquarium
+// is not shared with them. It returns sql.ErrNoRows if the aquarium does not exist.
+func (s *MemoryStore) GetAquariumRole(ctx context.Context, aquariumID string, userID string) (string, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    aquarium, ok := s.aquariums[aquariumID]
+    if !ok {
+        return "", sql.ErrNoRows
+    }
+    return s.aquariumRole(aquarium, userID), nil
+}
+
+// ListAquariumMembers lists everyone with access to an aquarium, primary owner first.
+func (s *MemoryStore) ListAquariumMembers(ctx context.Context, aquariumID string) ([]AquariumMember, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    members := []AquariumMember{}
+    aquarium, ok := s.aquariums[aquariumID]
+    if !ok {
+        return members, nil
+    }
+    owner := s.users[aquarium.UserID]
+    members = append(members, AquariumMember{
+        UserID:    owner.ID,
+        Email:     owner.Email,
+        FirstName: owner.FirstName,
+        Role:      AquariumRoleOwner,
+        Primary:   true,
+    })
+
+    userIDs := make([]string, 0, len(s.members[aquariumID]))
+    for userID := range s.members[aquariumID] {
+        userIDs = append(userIDs, userID)
+    }
+    sort.Slice(userIDs, func(i, j int) bool {
+        return s.members[aquariumID][userIDs[i]].seq < s.members[aquariumID][userIDs[j]].seq
+    })
+    for _, userID := range userIDs {
+        member := s.members[aquariumID][userID]
+        user := s.users[userID]
+        joinedAt := member.JoinedAt
+        members = append(members, AquariumMember{
+            UserID:    user.ID,
+            Email:     user.Email,
+            FirstName: user.FirstName,
+            Role:      member.Role,
+            JoinedAt:  &joinedAt,
+        })
+    }
+    return members, nil
+}
+
+// SetAquariumMemberRole changes the role of a member of an aquarium.
+// It returns sql.ErrNoRows if the user is not a member.
+func (s *MemoryStore) SetAquariumMemberRole(ctx context.Context, aquariumID string, userID string, role string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if !ValidAquariumRole(role) {
+        return fmt.Errorf("invalid aquarium role %q", role)
+    }
+    member, ok := s.members[aquariumID][userID]
+    if !ok {
+        return sql.ErrNoRows
+    }
+    member.Role = role
+    return nil
+}
+
+// RemoveAquariumMember revokes a member's access to an aquarium.
+// It returns sql.ErrNoRows if the user is not a member.
+func (s *MemoryStore) RemoveAquariumMember(ctx context.Context, aquariumID string, userID string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if _, ok := s.members[aquariumID][userID]; !ok {
+        return sql.ErrNoRows
+    }
+    delete(s.members[aquariumID], userID)
+    return nil
+}
+
+// CreateAquariumInvitation stores a new invitation, setting its ID and creation time.
+// Pending invitations of the same email address to the same aquarium are replaced.
+func (s *MemoryStore) CreateAquariumInvitation(ctx context.Context, invitation *AquariumInvitation, tokenHash string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if !ValidAquariumRole(invitation.Role) {
+        return fmt.Errorf("invalid aquarium role %q", invitation.Role)
+    }
+    if _, ok := s.aquariums[invitation.AquariumID]; !ok {
+        return missingReference("aquarium", invitation.AquariumID)
+    }
+    for hash, pending := range s.invitations {
+        if pending.AquariumID == invitation.AquariumID && strings.EqualFold(pending.Email, invitation.Email) {
+            delete(s.invitations, hash)
+        }
+    }
+    if _, ok := s.invitations[tokenHash]; ok {
+        return fmt.Errorf("invitation token already exists")
+    }
+
+    id, err := NewID()
+    if err != nil {
+        return err
+    }
+    invitation.ID = id
+    invitation.CreatedAt = s.now()
+    s.invitations[tokenHash] = &memoryInvitation{AquariumInvitation: *invitation, seq: s.nextSeq()}
+    return nil
+}
+
+// ListAquariumInvitations lists the unexpired invitations to an aquarium, newest first.
+func (s *MemoryStore) ListAquariumInvitations(ctx context.Context, aquariumID string) ([]AquariumInvitation, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var pending []*memoryInvitation
+    for _, invitation := range s.invitations {
+        if invitation.AquariumID == aquariumID && invitation.ExpiresAt.After(s.now()) {
+            pending = append(pending, invitation)
+        }
+    }
+    sort.Slice(pending, func(i, j int) bool { return pending[i].seq > pending[j].seq })
+
+    invitations := []AquariumInvitation{}
+    for _, invitation := range pending {
+        invitations = append(invitations, invitation.AquariumInvitation)
+    }
+    return invitations, nil
+}
+
+// RevokeAquariumInvitation deletes an invitation to an aquarium.
+// It returns sql.ErrNoRows if there is no such invitation.
+func (s *MemoryStore) RevokeAquariumInvitation(ctx context.Context, aquariumID string, invitationID string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for hash, invitation := range s.invitations {
+        if invitation.ID == invitationID && invitation.AquariumID == aquariumID {
+            delete(s.invitations, hash)
+            return nil
+        }
+    }
+    return sql.ErrNoRows
+}
+
+// AcceptAquariumInvitation consumes an invitation and makes the user a member of the
+// aquarium with the invited role, unless they are its primary owner.
+// It returns sql.ErrNoRows if the token is unknown or expired and
+// ErrInvitationEmailMismatch if the invitation was sent to another address.
+func (s *MemoryStore) AcceptAquariumInvitation(ctx context.Context, tokenHash string, userID string, email string) (*AquariumInvitation, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    invitation, ok := s.invitations[tokenHash]
+    if !ok || !invitation.ExpiresAt.After(s.now()) {
+        return nil, sql.ErrNoRows
+    }
+    if !strings.EqualFold(invitation.Email, email) {
+        return nil, ErrInvitationEmailMismatch
+    }
+    if _, ok := s.users[userID]; !ok {
+        return nil, missingReference("user", userID)
+    }
+    delete(s.invitations, tokenHash)
+
+    aquarium := s.aquariums[invitation.AquariumID]
+    if aquarium.UserID != userID {
+        if s.members[aquarium.ID] == nil {
+            s.members[aquarium.ID] = make(map[string]*memoryMember)
+        }
+        if member, ok := s.members[aquarium.ID][userID]; ok {
+            member.Role = invitation.Role
+        } else {
+            s.members[aquarium.ID][userID] = &memoryMember{
+                Role:      invitation.Role,
+                InvitedBy: invitation.InvitedBy,
+                JoinedAt:  s.now(),
+                seq:       s.nextSeq(),
+            }
+        }
+    }
+
+    accepted := invitation.AquariumInvitation
+    return &accepted, nil
+}
+
+// CreateShareLink stores a new share link, setting its ID and creation time.
+func (s *MemoryStore) CreateShareLink(ctx context.Context, link *ShareLink, tokenHash string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if _, ok := s.aquariums[link.AquariumID]; !ok {
+        return missingReference("aquarium", link.AquariumID)
+    }
+    if _, ok := s.shareLinks[tokenHash]; ok {
+        return fmt.Errorf("share link token already exists")
+    }
+    id, err := NewID()
+    if err != nil {
+        return err
+    }
+    link.ID = id
+    link.CreatedAt = s.now()
+    s.shareLinks[tokenHash] = &memoryShareLink{ShareLink: *link, seq: s.nextSeq()}
+    return nil
+}
+
+// ListShareLinks retrieves the unrevoked share links of an aquarium, including expired ones.
+func (s *MemoryStore) ListShareLinks(ctx context.Context, aquariumID string) ([]ShareLink, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var active []*memoryShareLink
+    for _, link := range s.shareLinks {
+        if link.AquariumID == aquariumID && link.RevokedAt == nil {
+            active = append(active, link)
+        }
+    }
+    sort.Slice(active, func(i, j int) bool { return active[i].seq < active[j].seq })
+
+    links := []ShareLink{}
+    for _, link := range active {
+        links = append(links, link.ShareLink)
+    }
+    return links, nil
+}
+
+// GetAquariumIDByShareToken resolves the token of an unrevoked, unexpired share link to
+// the aquarium it shows and records that the link was used.
+func (s *MemoryStore) GetAquariumIDByShareToken(ctx context.Context, tokenHash string) (string, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    link, ok := s.shareLinks[tokenHash]
+    if !ok || link.RevokedAt != nil || (link.ExpiresAt != nil && !link.ExpiresAt.After(s.now())) {
+        return "", sql.ErrNoRows
+    }
+    link.LastUsedAt = s.timestamp()
+    return link.AquariumID, nil
+}
+
+// RevokeShareLink revokes a share link of an aquarium.
+// It returns sql.ErrNoRows if no unrevoked link matched.
+func (s *MemoryStore) RevokeShareLink(ctx context.Context, aquariumID string, linkID string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for _, link := range s.shareLinks {
+        if link.ID == linkID && link.AquariumID == aquariumID && link.RevokedAt == nil {
+            link.RevokedAt = s.timestamp()
+            return nil
+        }
+    }
+    return sql.ErrNoRows
+}
+
+// GetDetailByID retrieves a species, plant or equipment item from the catalog.
+func (s *MemoryStore) GetDetailByID(ctx context.Context, id string, detailType string) (interface{}, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.detail(id, detailType)
+}
+
+// detail looks up a catalog detail of one of the Detail types.
+func (s *MemoryStore) detail(id string, detailType string) (interface{}, error) {
+    var detail interface{}
+    var ok bool
+    switch detailType {
+    case DetailSpecies:
+        detail, ok = s.species[id]
+    case DetailPlant:
+        detail, ok = s.plants[id]
+    case DetailEquipment:
+        detail, ok = s.equipment[id]
+    default:
+        return nil, errors.New("Invalid detail type")
+    }
+    if !ok {
+        return nil, sql.ErrNoRows
+    }
+    return detail, nil
+}
+
+// GetAllDetails retrieves all records of a given type (species, plants, equipment), ordered by name.
+func (s *MemoryStore) GetAllDetails(ctx context.Context, detailType string) (interface{}, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    switch detailType {
+    case "species":
+        var speciesList []Species
+        for _, species := range s.species {
+            speciesList = append(speciesList, species)
+        }
+        sort.Slice(speciesList, func(i, j int) bool { return speciesList[i].Name < speciesList[j].Name })
+        return speciesList, nil
+    case "plants":
+        var plants []Plant
+        for _, plant := range s.plants {
+            plants = append(plants, plant)
+        }
+        sort.Slice(plants, func(i, j int) bool { return plants[i].Name < plants[j].Name })
+        return plants, nil
+    case "equipment":
+        var equipmentList []Equipment
+        for _, equipment := range s.equipment {
+            equipmentList = append(equipmentList, equipment)
+        }
+        sort.Slice(equipmentList, func(i, j int) bool { return equipmentList[i].Name < equipmentList[j].Name })
+        return equipmentList, nil
+    default:
+        return nil, errors.New("Invalid detail type")
+    }
+}
+
+// changeCatalog applies a catalog change and records its audit entry, as withCatalogAudit does.
+// Updates and deletes of details that do not exist return sql.ErrNoRows; creates of
+// details that already exist fail.
+func (s *MemoryStore) changeCatalog(entry CatalogAuditEntry, apply func()) error {
+    before, err := s.detail(entry.DetailID, entry.DetailType)
+    switch {
+    case entry.Action == "create" && err == nil:
+        return fmt.Errorf("%s %q already exists", entry.DetailType, entry.DetailID)
+    case entry.Action == "create" && !errors.Is(err, sql.ErrNoRows):
+        return err
+    case entry.Action != "create" && err != nil:
+        return err
+    }
+
+    details := map[string]interface{}{}
+    if entry.Action != "create" {
+        details["before"] = before
+    }
+    if entry.After != nil {
+        details["after"] = entry.After
+    }
+    err = s.appendAuditEvent(AuditEvent{
+        ActorID:    entry.Actor.UserID,
+        Action:     "catalog." + entry.Action,
+        TargetType: entry.DetailType,
+        TargetID:   entry.DetailID,
+        IP:         entry.Actor.IP,
+        UserAgent:  entry.Actor.UserAgent,
+        Outcome:    OutcomeSuccess,
+        Details:    details,
+    })
+    if err != nil {
+        return err
+    }
+
+    apply()
+    return nil
+}
+
+// assignDetailID gives a new catalog detail a random ID if it has none.
+func assignDetailID(id *string) error {
+    if *id != "" {
+        return nil
+    }
+    newID, err := NewID()
+    if err != nil {
+        return err
+    }
+    *id = newID
+    return nil
+}
+
+// CreateSpecies adds a new species to the catalog, assigning an ID if none was given.
+func (s *MemoryStore) CreateSpecies(ctx context.Context, species *Species, actor Actor) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if err := assignDetailID(&species.Id); err != nil {
+        return err
+    }
+    entry := CatalogAuditEntry{Actor: actor, Action: "create", DetailType: DetailSpecies, DetailID: species.Id, After: species}
+    return s.changeCatalog(entry, func() { s.species[species.Id] = *species })
+}
+
+// UpdateSpecies replaces an existing species in the catalog.
+func (s *MemoryStore) UpdateSpecies(ctx context.Context, species *Species, actor Actor) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    entry := CatalogAuditEntry{Actor: actor, Action: "update", DetailType: DetailSpecies, DetailID: species.Id, After: species}
+    return s.changeCatalog(entry, func() { s.species[species.Id] = *species })
+}
+
+// CreatePlant adds a new plant to the catalog, assigning an ID if none was given.
+func (s *MemoryStore) CreatePlant(ctx context.Context, plant *Plant, actor Actor) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if err := assignDetailID(&plant.Id); err != nil {
+        return err
+    }
+    entry := CatalogAuditEntry{Actor: actor, Action: "create", DetailType: DetailPlant, DetailID: plant.Id, After: plant}
+    return s.changeCatalog(entry, func() { s.plants[plant.Id] = *plant })
+}
+
+// UpdatePlant replaces an existing plant in the catalog.
+func (s *MemoryStore) UpdatePlant(ctx context.Context, plant *Plant, actor Actor) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    entry := CatalogAuditEntry{Actor: actor, Action: "update", DetailType: DetailPlant, DetailID: plant.Id, After: plant}
+    return s.changeCatalog(entry, func() { s.plants[plant.Id] = *plant })
+}
+
+// CreateEquipment adds a new equipment item to the catalog, assigning an ID if none was given.
+func (s *MemoryStore) CreateEquipment(ctx context.Context, equipment *Equipment, actor Actor) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if err := assignDetailID(&equipment.Id); err != nil {
+        return err
+    }
+    entry := CatalogAuditEntry{Actor: actor, Action: "create", DetailType: DetailEquipment, DetailID: equipment.Id, After: equipment}
+    return s.changeCatalog(entry, func() { s.equipment[equipment.Id] = cloneEquipment(*equipment) })
+}
+
+// UpdateEquipment replaces an existing equipment item in the catalog.
+func (s *MemoryStore) UpdateEquipment(ctx context.Context, equipment *Equipment, actor Actor) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    entry := CatalogAuditEntry{Actor: actor, Action: "update", DetailType: DetailEquipment, DetailID: equipment.Id, After: equipment}
+    return s.changeCatalog(entry, func() { s.equipment[equipment.Id] = cloneEquipment(*equipment) })
+}
+
+// cloneEquipment copies an equipment item so that it shares no memory with the caller's.
+func cloneEquipment(equipment Equipment) Equipment {
+    equipment.Fields = append(json.RawMessage(nil), equipment.Fields...)
+    return equipment
+}
+
+// DeleteDetail removes a species, plant or equipment item from the catalog.
+// It returns sql.ErrNoRows if the detail does not exist and ErrDetailInUse if it is kept
+// in an aquarium.
+func (s *MemoryStore) DeleteDetail(ctx context.Context, detailType string, id string, actor Actor) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.detailInUse(detailType, id) {
+        return ErrDetailInUse
+    }
+
+    entry := CatalogAuditEntry{Actor: actor, Action: "delete", DetailType: detailType, DetailID: id}
+    return s.changeCatalog(entry, func() {
+        switch detailType {
+        case DetailSpecies:
+            delete(s.species, id)
+        case DetailPlant:
+            delete(s.plants, id)
+        case DetailEquipment:
+            delete(s.equipment, id)
+        }
+    })
+}
+
+// detailInUse reports whether a catalog detail is kept in any aquarium.
+func (s *MemoryStore) detailInUse(detailType string, id string) bool {
+    for _, aquarium := range s.aquariums {
+        switch detailType {
+        case DetailSpecies:
+            for _, species := range aquarium.Species {
+                if species.Id == id {
+                    return true
+                }
+            }
+        case DetailPlant:
+            for _, plant := range aquarium.Plants {
+                if plant.Id == id {
+                    return true
+                }
+            }
+        case DetailEquipment:
+            for _, equipment := range aquarium.Equipment {
+                if equipment.Id == id {
+                    return true
+                }
+            }
+        }
+    }
+    return false
+}
+
+// CreateWaterParameterEntry stores a new parameter entry.
+func (s *MemoryStore) CreateWaterParameterEntry(ctx context.Context, entry *WaterParameterEntry) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if entry.ID == "" {
+        return errors.New("parameter entry ID is required")
+    }
+    if _, ok := s.aquariums[entry.AquariumID]; !ok {
+        return missingReference("aquarium", entry.AquariumID)
+    }
+    for _, existing := range s.parameterEntries {
+        if existing.ID == entry.ID {
+            return fmt.Errorf("parameter entry %q already exists", entry.ID)
+        }
+    }
+    s.parameterEntries = append(s.parameterEntries, *entry)
+    return nil
+}
+
+// GetWaterParameterEntriesByAquariumID retrieves all parameter entries for a specific aquarium, newest first.
+func (s *MemoryStore) GetWaterParameterEntriesByAquariumID(ctx context.Context, aquariumID string) ([]WaterParameterEntry, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.parameterEntriesOf(aquariumID), nil
+}
+
+// parameterEntriesOf returns the parameter entries of an aquarium, newest first,
+// or nil if there are none.
+func (s *MemoryStore) parameterEntriesOf(aquariumID string) []WaterParameterEntry {
+    var entries []WaterParameterEntry
+    for _, entry := range s.parameterEntries {
+        if entry.AquariumID == aquariumID {
+            entries = append(entries, entry)
+        }
+    }
+    sort.SliceStable(entries, func(i, j int) bool { return entries[i].Timestamp > entries[j].Timestamp })
+    return entries
+}
@@ -0,0 +1,1162 @@
+// models/memory_store.go
+
+package models
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+// MemoryStore implements Store in memory. It follows the behavior of PostgresStore,
+// including cascading deletes and the audit entries written by catalog changes, so the
+// HTTP handlers can be run end to end without a database. Nothing is persisted.
+// Its calls never wait on I/O, so they ignore the deadline and cancellation of their
+// context. A MemoryStore is safe for concurrent use.
+type MemoryStore struct {
+    mu  sync.Mutex
+    now func() time.Time
+    seq int64 // Insertion counter, standing in for creation order where rows share a timestamp
+
+    users         map[string]*memoryUser
+    resetTokens   map[string]*memoryResetToken          // By token hash
+    recoveryCodes map[string]map[string]*time.Time      // By user ID, then code hash; the value is when the code was used
+    identities    map[[2]string]*memoryIdentity         // By provider and subject
+    sessions      map[string]*memorySession
+    refreshTokens map[string]*memoryRefreshToken        // By token hash
+    accessTokens  map[string]*memoryAccessToken         // By token hash
+    loginAttempts map[string]*memoryLoginAttempt
+    auditEvents   []AuditEvent                          // Oldest first
+
+    aquariums        map[string]*memoryAquarium
+    members          map[string]map[string]*memoryMember // By aquarium ID, then user ID
+    invitations      map[string]*memoryInvitation        // By token hash
+    shareLinks       map[string]*memoryShareLink         // By token hash
+    species          map[string]Species
+    plants           map[string]Plant
+    equipment        map[string]Equipment
+    revisions        map[string][]AquariumRevision       // By aquarium ID, oldest first
+    parameterEntries []WaterParameterEntry               // In insertion order
+}
+
+type memoryUser struct {
+    User
+    Username           string
+    Subscribe          string
+    CreatedAt          time.Time
+    Bio                *string
+    ProfilePictureURL  *string
+    VerificationSentAt *time.Time
+    TOTPSecret         string
+    TOTPEnabledAt      *time.Time
+    TOTPLastStep       *int64
+}
+
+type memoryResetToken struct {
+    UserID    string
+    ExpiresAt time.Time
+    UsedAt    *time.Time
+}
+
+type memoryIdentity struct {
+    Identity
+    UserID string
+    seq    int64
+}
+
+type memorySession struct {
+    Session
+    seq int64
+}
+
+type memoryRefreshToken struct {
+    ID        string
+    SessionID string
+    ExpiresAt time.Time
+    UsedAt    *time.Time
+}
+
+type memoryAccessToken struct {
+    PersonalAccessToken
+    RevokedAt *time.Time
+    seq       int64
+}
+
+type memoryLoginAttempt struct {
+    Failures      int
+    LastFailureAt time.Time
+    LockedUntil   *time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+    return &MemoryStore{
+        now:           time.Now,
+        users:         make(map[string]*memoryUser),
+        resetTokens:   make(map[string]*memoryResetToken),
+        recoveryCodes: make(map[string]map[string]*time.Time),
+        identities:    make(map[[2]string]*memoryIdentity),
+        sessions:      make(map[string]*memorySession),
+        refreshTokens: make(map[string]*memoryRefreshToken),
+        accessTokens:  make(map[string]*memoryAccessToken),
+        loginAttempts: make(map[string]*memoryLoginAttempt),
+        aquariums:     make(map[string]*memoryAquarium),
+        members:       make(map[string]map[string]*memoryMember),
+        invitations:   make(map[string]*memoryInvitation),
+        shareLinks:    make(map[string]*memoryShareLink),
+        species:       make(map[string]Species),
+        plants:        make(map[string]Plant),
+        equipment:     make(map[string]Equipment),
+        revisions:     make(map[string][]AquariumRevision),
+    }
+}
+
+// SetClock replaces the clock used for timestamps and expiry checks, letting tests
+// move time forward instead of waiting.
+func (s *MemoryStore) SetClock(now func() time.Time) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.now = now
+}
+
+// Ping always succeeds.
+func (s *MemoryStore) Ping(ctx context.Context) error {
+    return nil
+}
+
+// DBStats returns empty statistics, as there is no connection pool.
+func (s *MemoryStore) DBStats() sql.DBStats {
+    return sql.DBStats{}
+}
+
+// The helpers below expect s.mu to be held.
+
+// nextSeq returns the next value of the insertion counter.
+func (s *MemoryStore) nextSeq() int64 {
+    s.seq++
+    return s.seq
+}
+
+// timestamp returns the current time of the store's clock as a pointer.
+func (s *MemoryStore) timestamp() *time.Time {
+    now := s.now()
+    return &now
+}
+
+// missingReference reports a row referring to one that does not exist, which
+// PostgreSQL rejects with a foreign key violation.
+func missingReference(kind string, id string) error {
+    return fmt.Errorf("%s %q does not exist", kind, id)
+}
+
+// user returns a copy of a stored user safe to hand to callers.
+func (u *memoryUser) user() *User {
+    user := u.User
+    user.Roles = append([]string(nil), u.Roles...)
+    user.MFAEnabled = u.TOTPEnabledAt != nil
+    return &user
+}
+
+// userByEmail finds a user by email address.
+func (s *MemoryStore) userByEmail(email string) *memoryUser {
+    for _, user := range s.users {
+        if user.Email == email {
+            return user
+        }
+    }
+    return nil
+}
+
+// revokeSessions revokes the active sessions of a user, except keepSessionID,
+// returning how many were revoked.
+func (s *MemoryStore) revokeSessions(userID string, keepSessionID string) int64 {
+    var revoked int64
+    for _, session := range s.sessions {
+        if session.UserID == userID && session.ID != keepSessionID && session.RevokedAt == nil {
+            session.RevokedAt = s.timestamp()
+            revoked++
+        }
+    }
+    return revoked
+}
+
+// CreateUser stores a new user with the default role.
+func (s *MemoryStore) CreateUser(ctx context.Context, email, password, first_name string, username string, subscribe string, created_at string) (string, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    return s.createUser(email, password, first_name, username, subscribe, created_at)
+}
+
+// createUser stores a new user as described for CreateUser.
+func (s *MemoryStore) createUser(email, password, first_name string, username string, subscribe string, created_at string) (string, error) {
+    if s.userByEmail(email) != nil {
+        return "", fmt.Errorf("a user with email %q already exists", email)
+    }
+    createdAt := s.now()
+    if created_at != "" {
+        parsed, err := time.Parse(time.RFC3339, created_at)
+        if err != nil {
+            return "", fmt.Errorf("invalid created_at %q: %w", created_at, err)
+        }
+        createdAt = parsed
+    }
+    id, err := NewID()
+    if err != nil {
+        return "", err
+    }
+
+    s.users[id] = &memoryUser{
+        User:      User{ID: id, Email: email, Password: password, FirstName: first_name, Roles: []string{RoleUser}},
+        Username:  username,
+        Subscribe: subscribe,
+        CreatedAt: createdAt,
+    }
+    return id, nil
+}
+
+// GetUserByEmail retrieves a user by their email address.
+func (s *MemoryStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    user := s.userByEmail(email)
+    if user == nil {
+        return nil, sql.ErrNoRows
+    }
+    return user.user(), nil
+}
+
+// GetUserByID retrieves a user by their ID.
+func (s *MemoryStore) GetUserByID(ctx context.Context, id string) (*User, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    user, ok := s.users[id]
+    if !ok {
+        return nil, sql.ErrNoRows
+    }
+    return user.user(), nil
+}
+
+// UserExists checks whether a user with the specified email exists.
+func (s *MemoryStore) UserExists(ctx context.Context, email string) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.userByEmail(email) != nil
+}
+
+// ListUsers retrieves every user, ordered by email.
+func (s *MemoryStore) ListUsers(ctx context.Context) ([]User, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var users []User
+    for _, user := range s.users {
+        users = append(users, *user.user())
+    }
+    sort.Slice(users, func(i, j int) bool { return users[i].Email < users[j].Email })
+    return users, nil
+}
+
+// SetUserRoles replaces the roles granted to a user.
+func (s *MemoryStore) SetUserRoles(ctx context.Context, userID string, roles []string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    user, ok := s.users[userID]
+    if !ok {
+        return sql.ErrNoRows
+    }
+    user.Roles = append([]string{}, roles...)
+    return nil
+}
+
+// GrantRoleByEmail adds a role to the user with the given email if they do not already have it.
+func (s *MemoryStore) GrantRoleByEmail(ctx context.Context, email string, role string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    user := s.userByEmail(email)
+    if user == nil {
+        return sql.ErrNoRows
+    }
+    for _, granted := range user.Roles {
+        if granted == role {
+            return nil
+        }
+    }
+    user.Roles = append(user.Roles, role)
+    return nil
+}
+
+// GetUserProfile retrieves the profile of a user.
+func (s *MemoryStore) GetUserProfile(ctx context.Context, userID string) (*Profile, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    user, ok := s.users[userID]
+    if !ok {
+        return nil, sql.ErrNoRows
+    }
+    return &Profile{
+        ID:                user.ID,
+        Email:             user.Email,
+        Username:          user.Username,
+        FirstName:         user.FirstName,
+        Bio:               user.Bio,
+        ProfilePictureURL: user.ProfilePictureURL,
+        Roles:             append([]string(nil), user.Roles...),
+        Verified:          user.VerifiedAt != nil,
+        CreatedAt:         user.CreatedAt.Format(time.RFC3339Nano),
+    }, nil
+}
+
+// UpdateUserProfile applies a partial update to a user's profile.
+func (s *MemoryStore) UpdateUserProfile(ctx context.Context, userID string, update ProfileUpdate) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if update.Username != nil {
+        for _, other := range s.users {
+            if other.ID != userID && other.Username == *update.Username {
+                return ErrUsernameTaken
+            }
+        }
+    }
+    if update.Username == nil && update.FirstName == nil && update.Bio == nil && update.ProfilePictureURL == nil {
+        return nil
+    }
+
+    user, ok := s.users[userID]
+    if !ok {
+        return sql.ErrNoRows
+    }
+    if update.Username != nil {
+        user.Username = *update.Username
+    }
+    if update.FirstName != nil {
+        user.FirstName = *update.FirstName
+    }
+    if update.Bio != nil {
+        bio := *update.Bio
+        user.Bio = &bio
+    }
+    if update.ProfilePictureURL != nil {
+        url := *update.ProfilePictureURL
+        user.ProfilePictureURL = &url
+    }
+    return nil
+}
+
+// ChangeUserPassword sets a new password hash and revokes every other session of the user.
+func (s *MemoryStore) ChangeUserPassword(ctx context.Context, userID string, passwordHash string, keepSessionID string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if user, ok := s.users[userID]; ok {
+        user.Password = passwordHash
+    }
+    s.revokeSessions(userID, keepSessionID)
+    return nil
+}
+
+// DeleteUser permanently deletes a user and everything that belongs to them.
+// Audit events mentioning the user are kept.
+func (s *MemoryStore) DeleteUser(ctx context.Context, userID string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if _, ok := s.users[userID]; !ok {
+        return sql.ErrNoRows
+    }
+
+    for id, aquarium := range s.aquariums {
+        if aquarium.UserID == userID {
+            s.deleteAquarium(id)
+        }
+    }
+    for aquariumID, members := range s.members {
+        delete(members, userID)
+        for _, member := range members {
+            if member.InvitedBy == userID {
+                member.InvitedBy = ""
+            }
+        }
+        if len(members) == 0 {
+            delete(s.members, aquariumID)
+        }
+    }
+    for _, invitation := range s.invitations {
+        if invitation.InvitedBy == userID {
+            invitation.InvitedBy = ""
+        }
+    }
+    for _, link := range s.shareLinks {
+        if link.CreatedBy == userID {
+            link.CreatedBy = ""
+        }
+    }
+    for _, revisions := range s.revisions {
+        for i := range revisions {
+            if revisions[i].ActorID == userID {
+                revisions[i].ActorID = ""
+            }
+        }
+    }
+
+    for hash, token := range s.accessTokens {
+        if token.UserID == userID {
+            delete(s.accessTokens, hash)
+        }
+    }
+    for id, session := range s.sessions {
+        if session.UserID == userID {
+            s.deleteSession(id)
+        }
+    }
+    for hash, token := range s.resetTokens {
+        if token.UserID == userID {
+            delete(s.resetTokens, hash)
+        }
+    }
+    for key, identity := range s.identities {
+        if identity.UserID == userID {
+            delete(s.identities, key)
+        }
+    }
+    delete(s.recoveryCodes, userID)
+    delete(s.users, userID)
+    return nil
+}
+
+// MarkUserVerified records that the user's current email address has been verified.
+func (s *MemoryStore) MarkUserVerified(ctx context.Context, userID string, email string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    user, ok := s.users[userID]
+    if !ok || user.Email != email {
+        return sql.ErrNoRows
+    }
+    if user.VerifiedAt == nil {
+        user.VerifiedAt = s.timestamp()
+    }
+    return nil
+}
+
+// ReserveVerificationEmail records that a verification email is about to be sent to an
+// unverified user, unless one was already sent within minInterval.
+func (s *MemoryStore) ReserveVerificationEmail(ctx context.Context, userID string, minInterval time.Duration) (bool, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    user, ok := s.users[userID]
+    if !ok || user.VerifiedAt != nil {
+        return false, nil
+    }
+    if user.VerificationSentAt != nil && !user.VerificationSentAt.Before(s.now().Add(-minInterval)) {
+        return false, nil
+    }
+    user.VerificationSentAt = s.timestamp()
+    return true, nil
+}
+
+// ClaimUnverifiedAccount replaces the password of an unverified account, marks it
+// verified and removes every way its previous holder had into it, as the PostgresStore
+// version does.
+func (s *MemoryStore) ClaimUnverifiedAccount(ctx context.Context, userID string, passwordHash string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    user, ok := s.users[userID]
+    if !ok || user.VerifiedAt != nil {
+        return nil
+    }
+    user.Password = passwordHash
+    user.VerifiedAt = s.timestamp()
+    user.TOTPSecret = ""
+    user.TOTPEnabledAt = nil
+    user.TOTPLastStep = nil
+    s.revokeSessions(userID, "")
+
+    for key, identity := range s.identities {
+        if identity.UserID == userID {
+            delete(s.identities, key)
+        }
+    }
+    for hash, token := range s.accessTokens {
+        if token.UserID == userID {
+            delete(s.accessTokens, hash)
+        }
+    }
+    delete(s.recoveryCodes, userID)
+
+    owned := func(aquariumID string) bool {
+        aquarium, ok := s.aquariums[aquariumID]
+        return ok && aquarium.UserID == userID
+    }
+    for aquariumID, members := range s.members {
+        if owned(aquariumID) {
+            delete(s.members, aquariumID)
+            continue
+        }
+        delete(members, userID)
+        if len(members) == 0 {
+            delete(s.members, aquariumID)
+        }
+    }
+    for hash, invitation := range s.invitations {
+        if invitation.InvitedBy == userID || owned(invitation.AquariumID) {
+            delete(s.invitations, hash)
+        }
+    }
+    for hash, link := range s.shareLinks {
+        if link.CreatedBy == userID || owned(link.AquariumID) {
+            delete(s.shareLinks, hash)
+        }
+    }
+    return nil
+}
+
+// CreatePasswordResetToken stores the hash of a newly issued password reset token.
+func (s *MemoryStore) CreatePasswordResetToken(ctx context.Context, userID string, tokenHash string, expiresAt time.Time) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if _, ok := s.users[userID]; !ok {
+        return missingReference("user", userID)
+    }
+    if _, ok := s.resetTokens[tokenHash]; ok {
+        return fmt.Errorf("password reset token already exists")
+    }
+    s.resetTokens[tokenHash] = &memoryResetToken{UserID: userID, ExpiresAt: expiresAt}
+    return nil
+}
+
+// ResetPassword consumes a password reset token and sets the user's new password,
+// invalidating every outstanding reset token and session of the user.
+func (s *MemoryStore) ResetPassword(ctx context.Context, tokenHash string, passwordHash string) (string, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    token, ok := s.resetTokens[tokenHash]
+    if !ok || token.UsedAt != nil || !token.ExpiresAt.After(s.now()) {
+        return "", sql.ErrNoRows
+    }
+
+    if user, ok := s.users[token.UserID]; ok {
+        user.Password = passwordHash
+        if user.VerifiedAt == nil {
+            user.VerifiedAt = s.timestamp()
+        }
+    }
+    for _, other := range s.resetTokens {
+        if other.UserID == token.UserID && other.UsedAt == nil {
+            other.UsedAt = s.timestamp()
+        }
+    }
+    s.revokeSessions(token.UserID, "")
+    return token.UserID, nil
+}
+
+// GetTOTPState retrieves a user's TOTP enrollment.
+func (s *MemoryStore) GetTOTPState(ctx context.Context, userID string) (*TOTPState, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    user, ok := s.users[userID]
+    if !ok {
+        return nil, sql.ErrNoRows
+    }
+    state := &TOTPState{Secret: user.TOTPSecret, Enabled: user.TOTPEnabledAt != nil}
+    if user.TOTPLastStep != nil {
+        state.LastStep = *user.TOTPLastStep
+    }
+    return state, nil
+}
+
+// SetPendingTOTPSecret stores a new, unconfirmed TOTP secret for a user who has not
+// enabled TOTP yet. It returns sql.ErrNoRows if TOTP is already enabled.
+func (s *MemoryStore) SetPendingTOTPSecret(ctx context.Context, userID string, secret string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    user, ok := s.users[userID]
+    if !ok || user.TOTPEnabledAt != nil {
+        return sql.ErrNoRows
+    }
+    user.TOTPSecret = secret
+    user.TOTPLastStep = nil
+    return nil
+}
+
+// replaceRecoveryCodes replaces every recovery code of a user.
+func (s *MemoryStore) replaceRecoveryCodes(userID string, codeHashes []string) {
+    codes := make(map[string]*time.Time, len(codeHashes))
+    for _, hash := range codeHashes {
+        codes[hash] = nil
+    }
+    s.recoveryCodes[userID] = codes
+}
+
+// EnableTOTP confirms a user's pending TOTP enrollment and stores their recovery codes.
+// It returns sql.ErrNoRows if there is no pending enrollment.
+func (s *MemoryStore) EnableTOTP(ctx context.Context, userID string, step int64, codeHashes []string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    user, ok := s.users[userID]
+    if !ok || user.TOTPSecret == "" || user.TOTPEnabledAt != nil {
+        return sql.ErrNoRows
+    }
+    user.TOTPEnabledAt = s.timestamp()
+    user.TOTPLastStep = &step
+    s.replaceRecoveryCodes(userID, codeHashes)
+    return nil
+}
+
+// ReplaceRecoveryCodes discards a user's recovery codes and stores new ones.
+func (s *MemoryStore) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if _, ok := s.users[userID]; !ok {
+        return missingReference("user", userID)
+    }
+    s.replaceRecoveryCodes(userID, codeHashes)
+    return nil
+}
+
+// RecordTOTPStep records that a code for the given time step was accepted.
+// It returns false if a code for this or a later step was already accepted.
+func (s *MemoryStore) RecordTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    user, ok := s.users[userID]
+    if !ok || (user.TOTPLastStep != nil && *user.TOTPLastStep >= step) {
+        return false, nil
+    }
+    user.TOTPLastStep = &step
+    return true, nil
+}
+
+// UseRecoveryCode marks an unused recovery code of the user as used.
+// It returns false if no unused code with that hash exists.
+func (s *MemoryStore) UseRecoveryCode(ctx context.Context, userID string, codeHash string) (bool, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    codes := s.recoveryCodes[userID]
+    usedAt, ok := codes[codeHash]
+    if !ok || usedAt != nil {
+        return false, nil
+    }
+    codes[codeHash] = s.timestamp()
+    return true, nil
+}
+
+// DisableTOTP removes a user's TOTP enrollment and recovery codes.
+func (s *MemoryStore) DisableTOTP(ctx context.Context, userID string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if user, ok := s.users[userID]; ok {
+        user.TOTPSecret = ""
+        user.TOTPEnabledAt = nil
+        user.TOTPLastStep = nil
+    }
+    delete(s.recoveryCodes, userID)
+    return nil
+}
+
+// GetUserByIdentity retrieves the user an external identity is linked to and records
+// that the identity was used to sign in.
+func (s *MemoryStore) GetUserByIdentity(ctx context.Context, provider string, subject string) (*User, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    identity, ok := s.identities[[2]string{provider, subject}]
+    if !ok {
+        return nil, sql.ErrNoRows
+    }
+    identity.LastUsedAt = s.timestamp()
+    return s.users[identity.UserID].user(), nil
+}
+
+// LinkIdentity links an external identity to a user.
+// It returns ErrIdentityLinked if the identity is already linked to any user.
+func (s *MemoryStore) LinkIdentity(ctx context.Context, userID string, provider string, subject string, email string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    key := [2]string{provider, subject}
+    if _, ok := s.identities[key]; ok {
+        return ErrIdentityLinked
+    }
+    if _, ok := s.users[userID]; !ok {
+        return missingReference("user", userID)
+    }
+    s.identities[key] = &memoryIdentity{
+        Identity: Identity{Provider: provider, Subject: subject, Email: email, CreatedAt: s.now()},
+        UserID:   userID,
+        seq:      s.nextSeq(),
+    }
+    return nil
+}
+
+// CreateUserWithIdentity stores a new user together with the external identity they
+// signed up with, marking their email verified if the provider vouches for it.
+func (s *MemoryStore) CreateUserWithIdentity(ctx context.Context, email, password, firstName string, username string, subscribe string, createdAt string, identity Identity, verified bool) (string, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    key := [2]string{identity.Provider, identity.Subject}
+    if _, ok := s.identities[key]; ok {
+        return "", ErrIdentityLinked
+    }
+    userID, err := s.createUser(email, password, firstName, username, subscribe, createdAt)
+    if err != nil {
+        return "", err
+    }
+    s.identities[key] = &memoryIdentity{
+        Identity: Identity{Provider: identity.Provider, Subject: identity.Subject, Email: identity.Email, CreatedAt: s.now()},
+        UserID:   userID,
+        seq:      s.nextSeq(),
+    }
+    if verified {
+        s.users[userID].VerifiedAt = s.timestamp()
+    }
+    return userID, nil
+}
+
+// ListIdentities retrieves the external identities linked to a user.
+func (s *MemoryStore) ListIdentities(ctx context.Context, userID string) ([]Identity, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var linked []*memoryIdentity
+    for _, identity := range s.identities {
+        if identity.UserID == userID {
+            linked = append(linked, identity)
+        }
+    }
+    sort.Slice(linked, func(i, j int) bool { return linked[i].seq < linked[j].seq })
+
+    identities := []Identity{}
+    for _, identity := range linked {
+        identities = append(identities, identity.Identity)
+    }
+    return identities, nil
+}
+
+// UnlinkIdentity removes an external identity from a user.
+// It returns sql.ErrNoRows if the user has no such identity.
+func (s *MemoryStore) UnlinkIdentity(ctx context.Context, userID string, provider string, subject string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    key := [2]string{provider, subject}
+    identity, ok := s.identities[key]
+    if !ok || identity.UserID != userID {
+        return sql.ErrNoRows
+    }
+    delete(s.identities, key)
+    return nil
+}
+
+// CreateSession starts a new session for the given user.
+func (s *MemoryStore) CreateSession(ctx context.Context, userID string, userAgent string, ip string) (*Session, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if _, ok := s.users[userID]; !ok {
+        return nil, missingReference("user", userID)
+    }
+    id, err := NewID()
+    if err != nil {
+        return nil, err
+    }
+    now := s.now()
+    session := &memorySession{
+        Session: Session{ID: id, UserID: userID, UserAgent: userAgent, IP: ip, CreatedAt: now, LastSeenAt: now},
+        seq:     s.nextSeq(),
+    }
+    s.sessions[id] = session
+    created := session.Session
+    return &created, nil
+}
+
+// ListActiveSessions retrieves the unrevoked sessions of a user, most recently used first.
+func (s *MemoryStore) ListActiveSessions(ctx context.Context, userID string) ([]Session, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var active []*memorySession
+    for _, session := range s.sessions {
+        if session.UserID == userID && session.RevokedAt == nil {
+            active = append(active, session)
+        }
+    }
+    sort.Slice(active, func(i, j int) bool {
+        if !active[i].LastSeenAt.Equal(active[j].LastSeenAt) {
+            return active[i].LastSeenAt.After(active[j].LastSeenAt)
+        }
+        return active[i].seq > active[j].seq
+    })
+
+    sessions := []Session{}
+    for _, session := range active {
+        sessions = append(sessions, session.Session)
+    }
+    return sessions, nil
+}
+
+// TouchSession records that a session was used from the given IP address, at most once a minute.
+func (s *MemoryStore) TouchSession(ctx context.Context, sessionID string, ip string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    session, ok := s.sessions[sessionID]
+    if ok && session.RevokedAt == nil && session.LastSeenAt.Before(s.now().Add(-time.Minute)) {
+        session.LastSeenAt = s.now()
+        session.IP = ip
+    }
+    return nil
+}
+
+// IsSessionActive reports whether the session exists and has not been revoked.
+func (s *MemoryStore) IsSessionActive(ctx context.Context, sessionID string) (bool, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    session, ok := s.sessions[sessionID]
+    return ok && session.RevokedAt == nil, nil
+}
+
+// RevokeSession revokes a single session belonging to the given user.
+// It returns sql.ErrNoRows if no active session matched.
+func (s *MemoryStore) RevokeSession(ctx context.Context, sessionID string, userID string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    session, ok := s.sessions[sessionID]
+    if !ok || session.UserID != userID || session.RevokedAt != nil {
+        return sql.ErrNoRows
+    }
+    session.RevokedAt = s.timestamp()
+    return nil
+}
+
+// RevokeUserSessions revokes every active session of the given user.
+func (s *MemoryStore) RevokeUserSessions(ctx context.Context, userID string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.revokeSessions(userID, "")
+    return nil
+}
+
+// RevokeOtherSessions revokes every active session of the given user except keepSessionID,
+// returning the number of sessions revoked.
+func (s *MemoryStore) RevokeOtherSessions(ctx context.Context, userID string, keepSessionID string) (int64, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.revokeSessions(userID, keepSessionID), nil
+}
+
+// deleteSession deletes a session together with its refresh tokens.
+func (s *MemoryStore) deleteSession(sessionID string) {
+    for hash, token := range s.refreshTokens {
+        if token.SessionID == sessionID {
+            delete(s.refreshTokens, hash)
+        }
+    }
+    delete(s.sessions, sessionID)
+}
+
+// CreateRefreshToken stores the hash of a newly minted refresh token for a session.
+func (s *MemoryStore) CreateRefreshToken(ctx context.Context, sessionID string, tokenHash string, expiresAt time.Time) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if _, ok := s.sessions[sessionID]; !ok {
+        return missingReference("session", sessionID)
+    }
+    if _, ok := s.refreshTokens[tokenHash]; ok {
+        return fmt.Errorf("refresh token already exists")
+    }
+    id, err := NewID()
+    if err != nil {
+        return err
+    }
+    s.refreshTokens[tokenHash] = &memoryRefreshToken{ID: id, SessionID: sessionID, ExpiresAt: expiresAt}
+    return nil
+}
+
+// GetRefreshTokenByHash looks up a refresh token by the hash of its value,
+// together with the owning session's user and revocation state.
+func (s *MemoryStore) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    token, ok := s.refreshTokens[tokenHash]
+    if !ok {
+        return nil, sql.ErrNoRows
+    }
+    session := s.sessions[token.SessionID]
+    return &RefreshToken{
+        ID:               token.ID,
+        SessionID:        token.SessionID,
+        UserID:           session.UserID,
+        ExpiresAt:        token.ExpiresAt,
+        UsedAt:           token.UsedAt,
+        SessionRevokedAt: session.RevokedAt,
+    }, nil
+}
+
+// MarkRefreshTokenUsed marks a refresh token as exchanged.
+// It returns false if the token had already been used, which indicates reuse.
+func (s *MemoryStore) MarkRefreshTokenUsed(ctx context.Context, tokenID string) (bool, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for _, token := range s.refreshTokens {
+        if token.ID == tokenID {
+            if token.UsedAt != nil {
+                return false, nil
+            }
+            token.UsedAt = s.timestamp()
+            return true, nil
+        }
+    }
+    return false, nil
+}
+
+// CreatePersonalAccessToken stores a new personal access token, setting its ID and creation time.
+func (s *MemoryStore) CreatePersonalAccessToken(ctx context.Context, token *PersonalAccessToken, tokenHash string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if _, ok := s.users[token.UserID]; !ok {
+        return missingReference("user", token.UserID)
+    }
+    if _, ok := s.aquariums[token.AquariumID]; token.AquariumID != "" && !ok {
+        return missingReference("aquarium", token.AquariumID)
+    }
+    if _, ok := s.accessTokens[tokenHash]; ok {
+        return fmt.Errorf("personal access token already exists")
+    }
+    id, err := NewID()
+    if err != nil {
+        return err
+    }
+    token.ID = id
+    token.CreatedAt = s.now()
+
+    stored := *token
+    stored.Scopes = append([]string(nil), token.Scopes...)
+    s.accessTokens[tokenHash] = &memoryAccessToken{PersonalAccessToken: stored, seq: s.nextSeq()}
+    return nil
+}
+
+// accessToken returns a copy of a stored personal access token safe to hand to callers.
+func (t *memoryAccessToken) accessToken() *PersonalAccessToken {
+    token := t.PersonalAccessToken
+    token.Scopes = append([]string(nil), t.Scopes...)
+    return &token
+}
+
+// GetPersonalAccessTokenByHash looks up an unrevoked personal access token by the hash of its value.
+func (s *MemoryStore) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*PersonalAccessToken, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    token, ok := s.accessTokens[tokenHash]
+    if !ok || token.RevokedAt != nil {
+        return nil, sql.ErrNoRows
+    }
+    return token.accessToken(), nil
+}
+
+// ListPersonalAccessTokens retrieves the unrevoked personal access tokens of a user.
+func (s *MemoryStore) ListPersonalAccessTokens(ctx context.Context, userID string) ([]PersonalAccessToken, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var owned []*memoryAccessToken
+    for _, token := range s.accessTokens {
+        if token.UserID == userID && token.RevokedAt == nil {
+            owned = append(owned, token)
+        }
+    }
+    sort.Slice(owned, func(i, j int) bool { return owned[i].seq < owned[j].seq })
+
+    tokens := []PersonalAccessToken{}
+    for _, token := range owned {
+        tokens = append(tokens, *token.accessToken())
+    }
+    return tokens, nil
+}
+
+// TouchPersonalAccessToken records that a token was used, at most once a minute.
+func (s *MemoryStore) TouchPersonalAccessToken(ctx context.Context, tokenID string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for _, token := range s.accessTokens {
+        if token.ID == tokenID && (token.LastUsedAt == nil || token.LastUsedAt.Before(s.now().Add(-time.Minute))) {
+            token.LastUsedAt = s.timestamp()
+        }
+    }
+    return nil
+}
+
+// RevokePersonalAccessToken revokes a personal access token belonging to the given user.
+// It returns sql.ErrNoRows if no unrevoked token matched.
+func (s *MemoryStore) RevokePersonalAccessToken(ctx context.Context, tokenID string, userID string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for _, token := range s.accessTokens {
+        if token.ID == tokenID && token.UserID == userID && token.RevokedAt == nil {
+            token.RevokedAt = s.timestamp()
+            return nil
+        }
+    }
+    return sql.ErrNoRows
+}
+
+// RecordLoginFailure counts a failed login attempt against a throttle key and returns the
+// number of consecutive failures, starting over when the previous failure is older than resetAfter.
+func (s *MemoryStore) RecordLoginFailure(ctx context.Context, key string, resetAfter time.Duration) (int, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    attempt, ok := s.loginAttempts[key]
+    if !ok {
+        attempt = &memoryLoginAttempt{}
+        s.loginAttempts[key] = attempt
+    }
+    if attempt.LastFailureAt.Before(s.now().Add(-resetAfter)) {
+        attempt.Failures = 1
+    } else {
+        attempt.Failures++
+    }
+    attempt.LastFailureAt = s.now()
+    return attempt.Failures, nil
+}
+
+// SetLoginLockout blocks logins for a throttle key until the given time.
+func (s *MemoryStore) SetLoginLockout(ctx context.Context, key string, until time.Time) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if attempt, ok := s.loginAttempts[key]; ok {
+        attempt.LockedUntil = &until
+    }
+    return nil
+}
+
+// GetLoginLockout returns when the lockout of a throttle key ends, or the zero time if
+// the key is not locked out.
+func (s *MemoryStore) GetLoginLockout(ctx context.Context, key string) (time.Time, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    attempt, ok := s.loginAttempts[key]
+    if !ok || attempt.LockedUntil == nil || !attempt.LockedUntil.After(s.now()) {
+        return time.Time{}, nil
+    }
+    return *attempt.LockedUntil, nil
+}
+
+// ClearLoginFailures forgets the failed attempts of a throttle key.
+func (s *MemoryStore) ClearLoginFailures(ctx context.Context, key string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    delete(s.loginAttempts, key)
+    return nil
+}
+
+// appendAuditEvent appends an event to the audit log. Details go through JSON, as they
+// do in the database, so they read back the same way from both stores.
+func (s *MemoryStore) appendAuditEvent(event AuditEvent) error {
+    details := event.Details
+    if details == nil {
+        details = map[string]interface{}{}
+    }
+    detailsJSON, err := json.Marshal(details)
+    if err != nil {
+        return err
+    }
+    event.Details = nil
+    if err := json.Unmarshal(detailsJSON, &event.Details); err != nil {
+        return err
+    }
+
+    event.ID, err = NewID()
+    if err != nil {
+        return err
+    }
+    event.OccurredAt = s.now()
+    s.auditEvents = append(s.auditEvents, event)
+    return nil
+}
+
+// RecordAuditEvent appends an event to the audit log.
+func (s *MemoryStore) RecordAuditEvent(ctx context.Context, event AuditEvent) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.appendAuditEvent(event)
+}
+
+// listAuditEvents returns up to limit events matching keep, newest first.
+func (s *MemoryStore) listAuditEvents(limit int, keep func(event *AuditEvent) bool) []AuditEvent {
+    events := []AuditEvent{}
+    for i := len(s.auditEvents) - 1; i >= 0 && len(events) < limit; i-- {
+        if keep(&s.auditEvents[i]) {
+            events = append(events, s.auditEvents[i])
+        }
+    }
+    return events
+}
+
+// ListAuditEvents retrieves audit events matching the filter, newest first.
+func (s *MemoryStore) ListAuditEvents(ctx context.Context, filter AuditFilter) ([]AuditEvent, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    return s.listAuditEvents(filter.Limit, func(event *AuditEvent) bool {
+        if prefix, ok := strings.CutSuffix(filter.Action, "*"); ok {
+            if !strings.HasPrefix(event.Action, prefix) {
+                return false
+            }
+        } else if filter.Action != "" && event.Action != filter.Action {
+            return false
+        }
+        return (filter.ActorID == "" || event.ActorID == filter.ActorID) &&
+            (filter.TargetType == "" || event.TargetType == filter.TargetType) &&
+            (filter.TargetID == "" || event.TargetID == filter.TargetID) &&
+            (filter.Outcome == "" || event.Outcome == filter.Outcome) &&
+            (filter.Since == nil || !event.OccurredAt.Before(*filter.Since)) &&
+            (filter.Until == nil || event.OccurredAt.Before(*filter.Until))
+    }), nil
+}
+
+// ListSecurityActivity retrieves the most recent authentication and account events
+// performed by or aimed at a user, newest first.
+func (s *MemoryStore) ListSecurityActivity(ctx context.Context, userID string, limit int) ([]AuditEvent, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    return s.listAuditEvents(limit, func(event *AuditEvent) bool {
+        involved := event.ActorID == userID || (event.TargetType == "user" && event.TargetID == userID)
+        return involved && (strings.HasPrefix(event.Action, "auth.") || strings.HasPrefix(event.Action, "account."))
+    }), nil
+}
@@ -0,0 +1,198 @@
+// models/mfa.go
+
+package models
+
+import (
+    "context"
+    "database/sql"
+)
+
+// TOTP two-factor authentication state is kept on the users table; recovery codes are
+// stored hashed in their own table.
+//
+// The schema is defined by migration 0008_totp in internal/migrate.
+
+// TOTPState is a user's TOTP enrollment.
+type TOTPState struct {
+    Secret   string // Base32 encoded shared secret, empty if never enrolled
+    Enabled  bool   // Whether enrollment has been confirmed
+    LastStep int64  // Last time step a code was accepted for, to prevent replay
+}
+
+// GetTOTPState retrieves a user's TOTP enrollment.
+func (s *PostgresStore) GetTOTPState(ctx context.Context, userID string) (*TOTPState, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    var state TOTPState
+    var secret sql.NullString
+    var lastStep sql.NullInt64
+    query := `SELECT totp_secret, totp_enabled_at IS NOT NULL, totp_last_step FROM users WHERE id = $1`
+    err := s.db.QueryRowContext(ctx, query, userID).Scan(&secret, &state.Enabled, &lastStep)
+    if err != nil {
+        return nil, queryError(ctx, err)
+    }
+    state.Secret = secret.String
+    state.LastStep = lastStep.Int64
+    return &state, nil
+}
+
+// SetPendingTOTPSecret stores a new, unconfirmed TOTP secret for a user who has not
+// enabled TOTP yet. It returns sql.ErrNoRows if TOTP is already enabled.
+func (s *PostgresStore) SetPendingTOTPSecret(ctx context.Context, userID string, secret string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `UPDATE users SET totp_secret = $1, totp_last_step = NULL WHERE id = $2 AND totp_enabled_at IS NULL`
+    result, err := s.db.ExecContext(ctx, query, secret, userID)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    if rowsAffected == 0 {
+        return sql.ErrNoRows
+    }
+
+    return nil
+}
+
+// insertRecoveryCodes replaces every recovery code of a user within a transaction.
+func insertRecoveryCodes(ctx context.Context, tx *sql.Tx, userID string, codeHashes []string) error {
+    if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+        return err
+    }
+    for _, hash := range codeHashes {
+        if _, err := tx.ExecContext(ctx, `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// EnableTOTP confirms a user's pending TOTP enrollment and stores their recovery codes.
+//
+// Params:
+//   - userID: the ID of the user
+//   - step: the time step of the code that confirmed the enrollment
+//   - codeHashes: hashes of the newly issued recovery codes
+//
+// Returns:
+//   - error: sql.ErrNoRows if there is no pending enrollment, otherwise any database error
+func (s *PostgresStore) EnableTOTP(ctx context.Context, userID string, step int64, codeHashes []string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    defer tx.Rollback()
+
+    query := `
+        UPDATE users
+        SET totp_enabled_at = now(), totp_last_step = $1
+        WHERE id = $2 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL
+    `
+    result, err := tx.ExecContext(ctx, query, step, userID)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    if rowsAffected == 0 {
+        return sql.ErrNoRows
+    }
+
+    if err := insertRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+        return queryError(ctx, err)
+    }
+
+    return queryError(ctx, tx.Commit())
+}
+
+// ReplaceRecoveryCodes discards a user's recovery codes and stores new ones.
+func (s *PostgresStore) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    defer tx.Rollback()
+
+    if err := insertRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+        return queryError(ctx, err)
+    }
+
+    return queryError(ctx, tx.Commit())
+}
+
+// RecordTOTPStep records that a code for the given time step was accepted.
+// It returns false if a code for this or a later step was already accepted, which
+// means the code is being replayed.
+func (s *PostgresStore) RecordTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `UPDATE users SET totp_last_step = $1 WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`
+    result, err := s.db.ExecContext(ctx, query, step, userID)
+    if err != nil {
+        return false, queryError(ctx, err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return false, queryError(ctx, err)
+    }
+    return rowsAffected == 1, nil
+}
+
+// UseRecoveryCode marks an unused recovery code of the user as used.
+// It returns false if no unused code with that hash exists.
+func (s *PostgresStore) UseRecoveryCode(ctx context.Context, userID string, codeHash string) (bool, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `UPDATE mfa_recovery_codes SET used_at = now() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+    result, err := s.db.ExecContext(ctx, query, userID, codeHash)
+    if err != nil {
+        return false, queryError(ctx, err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return false, queryError(ctx, err)
+    }
+    return rowsAffected == 1, nil
+}
+
+// DisableTOTP removes a user's TOTP enrollment and recovery codes.
+func (s *PostgresStore) DisableTOTP(ctx context.Context, userID string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    defer tx.Rollback()
+
+    _, err = tx.ExecContext(ctx, `UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL WHERE id = $1`, userID)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+
+    _, err = tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+
+    return queryError(ctx, tx.Commit())
+}
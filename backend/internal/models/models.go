@@ -1,33 +1,51 @@
-// Package models provides data access to the database for the User entity.
-// It includes functions to create users, check user existence, and retrieve users by their email.
+// Package models defines the entities of the service and the stores that persist them.
+// The stores are described by interfaces (see store.go) implemented by PostgresStore for
+// production and by MemoryStore for running without a database.
 package models
 
 import (
+    "context"
     "database/sql"
     "encoding/json"
     "errors"
     "fmt"
-    _ "github.com/lib/pq" // PostgreSQL driver
-)
-
-// db is a package-level variable for the database connection.
-var db *sql.DB
+    "time"
 
-// InitDB initializes the global database connection.
-// It should be called once from the main function to establish the connection.
-//
-// Params:
-//   - database: the initialized sql.DB connection object
-func InitDB(database *sql.DB) {
-    db = database
-}
+    "github.com/lib/pq" // PostgreSQL driver and array support
+)
 
-// User represents a user in the system with their ID, email, password, and first name.
+// User represents a user in the system with their ID, email, password, first name and roles.
 type User struct {
     ID       string    // Unique identifier of the user
     Email    string // Email address of the user
     Password string // Hashed password of the user
     FirstName string // First name of the user
+    Roles    []string // Roles granted to the user (users.roles TEXT[] NOT NULL DEFAULT '{user}')
+    VerifiedAt *time.Time // When the email address was verified, nil if unverified (users.verified_at TIMESTAMPTZ)
+    MFAEnabled bool       // Whether TOTP two-factor authentication is enabled
+}
+
+// Verified reports whether the user has verified their email address.
+func (u *User) Verified() bool {
+    return u.VerifiedAt != nil
+}
+
+// userColumns lists the columns scanned by scanUser, in order.
+const userColumns = `id, email, password, first_name, roles, verified_at, totp_enabled_at IS NOT NULL`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+    Scan(dest ...interface{}) error
+}
+
+// scanUser scans a row selected with userColumns into a User.
+func scanUser(row rowScanner) (*User, error) {
+    var user User
+    err := row.Scan(&user.ID, &user.Email, &user.Password, &user.FirstName, pq.Array(&user.Roles), &user.VerifiedAt, &user.MFAEnabled)
+    if err != nil {
+        return nil, err
+    }
+    return &user, nil
 }
 
 
@@ -40,11 +58,16 @@ type User struct {
 //   - username: the user's username
 //
 // Returns:
+//   - string: the ID assigned to the new user
 //   - error: an error if the insert operation fails, otherwise nil
-func CreateUser(email, password, first_name string, username string, subscribe string, created_at string) error {
-    query := `INSERT INTO users (email, password, first_name, username, subscribe, created_at) VALUES ($1, $2, $3, $4, $5, $6)`
-    _, err := db.Exec(query, email, password, first_name, username, subscribe, created_at)
-    return err
+func (s *PostgresStore) CreateUser(ctx context.Context, email, password, first_name string, username string, subscribe string, created_at string) (string, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    var id string
+    query := `INSERT INTO users (email, password, first_name, username, subscribe, created_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+    err := s.db.QueryRowContext(ctx, query, email, password, first_name, username, subscribe, created_at).Scan(&id)
+    return id, queryError(ctx, err)
 }
 
 
@@ -56,14 +79,30 @@ func CreateUser(email, password, first_name string, username string, subscribe s
 // Returns:
 //   - *User: a pointer to the User struct if the user is found
 //   - error: an error if the query fails or the user is not found
-func GetUserByEmail(email string) (*User, error) {
-    var user User
-    query := `SELECT id, email, password, first_name FROM users WHERE email = $1`
-    err := db.QueryRow(query, email).Scan(&user.ID, &user.Email, &user.Password, &user.FirstName)
-    if err != nil {
-        return nil, err
-    }
-    return &user, nil
+func (s *PostgresStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `SELECT ` + userColumns + ` FROM users WHERE email = $1`
+    user, err := scanUser(s.db.QueryRowContext(ctx, query, email))
+    return user, queryError(ctx, err)
+}
+
+// GetUserByID retrieves a user from the database by their ID.
+//
+// Params:
+//   - id: the user's ID to search by
+//
+// Returns:
+//   - *User: a pointer to the User struct if the user is found
+//   - error: an error if the query fails or the user is not found
+func (s *PostgresStore) GetUserByID(ctx context.Context, id string) (*User, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+    user, err := scanUser(s.db.QueryRowContext(ctx, query, id))
+    return user, queryError(ctx, err)
 }
 
 // UserExists checks whether a user with the specified email exists in the database.
@@ -73,10 +112,13 @@ func GetUserByEmail(email string) (*User, error) {
 //
 // Returns:
 //   - bool: true if the user exists, false otherwise
-func UserExists(email string) bool {
+func (s *PostgresStore) UserExists(ctx context.Context, email string) bool {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
     var exists bool
     query := `SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)`
-    db.QueryRow(query, email).Scan(&exists)
+    s.db.QueryRowContext(ctx, query, email).Scan(&exists)
     return exists
 }
 
@@ -98,6 +140,7 @@ type AquariumPlant struct {
 type Aquarium struct {
     ID               string                `json:"id"`
     UserID           string                `json:"userId"`
+    Version          int64                 `json:"version"` // Incremented by every update
     Name             string                `json:"name"`
     Type             string                `json:"type"`
     Size             string                `json:"size"`
@@ -110,6 +153,8 @@ type Aquarium struct {
 type AquariumResponse struct {
     ID               string                `json:"id"`
     UserID           string                `json:"userId"`
+    Role             string                `json:"role,omitempty"` // Role of the requesting user on the aquarium
+    Version          int64                 `json:"version"`
     Name             string                `json:"name"`
     Type             string                `json:"type"`
     Size             string                `json:"size"`
@@ -194,213 +239,137 @@ type WaterParameterEntry struct {
 
 
 
-// CreateAquarium inserts a new aquarium into the database.
-func CreateAquarium(aquarium *Aquarium) error {
-    speciesJSON, err := json.Marshal(aquarium.Species)
+// ErrVersionConflict is returned when updating an aquarium that was changed since the
+// version the update is based on.
+var ErrVersionConflict = errors.New("aquarium was changed by another update")
+
+// CreateAquarium inserts a new aquarium into the database together with its stock, and
+// fills in its version and the catalog names of its species and plants. The actor is
+// recorded as the author of its first revision.
+// It returns an *UnknownCatalogError if any of the stock is missing from the catalog.
+func (s *PostgresStore) CreateAquarium(ctx context.Context, aquarium *Aquarium, actor Actor) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    tx, err := s.db.BeginTx(ctx, nil)
     if err != nil {
-        return err
+        return queryError(ctx, err)
     }
-    plantsJSON, err := json.Marshal(aquarium.Plants)
+    defer tx.Rollback()
+
+    query := `
+        INSERT INTO aquariums (id, user_id, name, type, size)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING version
+    `
+    err = tx.QueryRowContext(ctx, query, aquarium.ID, aquarium.UserID, aquarium.Name, aquarium.Type, aquarium.Size).Scan(&aquarium.Version)
     if err != nil {
-        return err
+        return queryError(ctx, err)
+    }
+
+    if err := saveAquariumStock(ctx, tx, aquarium); err != nil {
+        return queryError(ctx, err)
     }
-    equipmentJSON, err := json.Marshal(aquarium.Equipment)
+
+    err = recordAquariumRevision(ctx, tx, AquariumRevision{
+        AquariumID: aquarium.ID,
+        Version:    aquarium.Version,
+        ActorID:    actor.UserID,
+        Action:     RevisionCreate,
+    })
     if err != nil {
-        return err
+        return queryError(ctx, err)
     }
 
-    query := `
-        INSERT INTO aquariums (id, user_id, name, type, size, species, plants, equipment)
-        VALUES ($1, $2, $3, $4, $5, $6::jsonb, $7::jsonb, $8::jsonb)
-    `
-    _, err = db.Exec(query, aquarium.ID, aquarium.UserID, aquarium.Name, aquarium.Type, aquarium.Size, speciesJSON, plantsJSON, equipmentJSON)
-    return err
+    return queryError(ctx, tx.Commit())
 }
 
 
-func GetAquariumsByUserID(userID string) ([]AquariumResponse, error) {
+// AquariumListOptions selects what GetAquariumsByUserID loads besides the aquariums and
+// their stock.
+type AquariumListOptions struct {
+    IncludeParameters bool // Whether to load parameter entries
+    ParameterLimit    int  // Most recent parameter entries loaded per aquarium; 0 loads all of them
+}
+
+// GetAquariumsByUserID retrieves the aquariums a user owns or that are shared with them,
+// along with the user's role on each. However many aquariums there are, it runs at most
+// five queries: the aquariums, their species, their plants, their equipment and, if
+// requested, their parameter entries.
+func (s *PostgresStore) GetAquariumsByUserID(ctx context.Context, userID string, options AquariumListOptions) ([]AquariumResponse, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
     query := `
-        SELECT id, user_id, name, type, size, species, plants, equipment
-        FROM aquariums
-        WHERE user_id = $1
+        SELECT a.id, a.user_id, CASE WHEN a.user_id = $1 THEN 'owner' ELSE m.role END,
+               a.version, a.name, a.type, a.size
+        FROM aquariums a
+        LEFT JOIN aquarium_members m ON m.aquarium_id = a.id AND m.user_id = $1
+        WHERE a.user_id = $1 OR m.user_id IS NOT NULL
     `
-    rows, err := db.Query(query, userID)
+    rows, err := s.db.QueryContext(ctx, query, userID)
     if err != nil {
-        return nil, err
+        return nil, queryError(ctx, err)
     }
     defer rows.Close()
 
-    var aquariums []AquariumResponse
-
+    var listed []*AquariumResponse
+    var aquariumIDs []string
     for rows.Next() {
         var aquarium AquariumResponse
-        var speciesJSON, plantsJSON, equipmentJSON []byte
-
-        err := rows.Scan(&aquarium.ID, &aquarium.UserID, &aquarium.Name, &aquarium.Type, &aquarium.Size, &speciesJSON, &plantsJSON, &equipmentJSON)
-        if err != nil {
-            return nil, err
-        }
-
-        // Unmarshal species JSON into a slice of AquariumSpecies
-        var speciesData []AquariumSpecies
-        if err := json.Unmarshal(speciesJSON, &speciesData); err != nil {
-            return nil, fmt.Errorf("error unmarshalling species JSON: %w", err)
-        }
-
-        // Create a map of species ID to count
-        speciesIDToCount := make(map[string]int)
-        var speciesIDs []string
-        for _, species := range speciesData {
-            speciesIDs = append(speciesIDs, species.Id)
-            speciesIDToCount[species.Id] = species.Count
-        }
-
-        // Retrieve species details by IDs
-        speciesDetails, err := GetSpeciesDetailsByIDs(speciesIDs)
+        err := rows.Scan(&aquarium.ID, &aquarium.UserID, &aquarium.Role, &aquarium.Version, &aquarium.Name, &aquarium.Type, &aquarium.Size)
         if err != nil {
-            return nil, err
-        }
-
-        // Add count to speciesDetails
-        for i, species := range speciesDetails {
-            if count, ok := speciesIDToCount[species.Id]; ok {
-                speciesDetails[i].Count = count
-            }
-        }
-        aquarium.Species = speciesDetails
-
-        // Unmarshal plants JSON into a slice of AquariumPlant
-        var plantData []AquariumPlant
-        if err := json.Unmarshal(plantsJSON, &plantData); err != nil {
-            return nil, err
+            return nil, queryError(ctx, err)
         }
-
-        // Create a map of plant ID to count
-        plantIDToCount := make(map[string]int)
-        var plantIDs []string
-        for _, plant := range plantData {
-            plantIDs = append(plantIDs, plant.Id)
-            plantIDToCount[plant.Id] = plant.Count
-        }
-
-        // Retrieve plant details by IDs
-        plantDetails, err := GetPlantsDetailsByIDs(plantIDs)
-        if err != nil {
-            return nil, err
-        }
-
-        // Add count to plantDetails
-        for i, plant := range plantDetails {
-            if count, ok := plantIDToCount[plant.Id]; ok {
-                plantDetails[i].Count = count
-            }
-        }
-        aquarium.Plants = plantDetails
-
-        // Unmarshal equipment JSON
-        if err := json.Unmarshal(equipmentJSON, &aquarium.Equipment); err != nil {
-            return nil, fmt.Errorf("error unmarshalling equipment JSON: %w", err)
-        }
-
-        // Retrieve parameter entries for this aquarium
-        parameterEntries, err := GetWaterParameterEntriesByAquariumID(aquarium.ID)
-        if err != nil {
-            return nil, err
-        }
-        aquarium.ParameterEntries = parameterEntries
-
-        // Ensure species and plants are not null
-        if aquarium.Species == nil {
-            aquarium.Species = []Species{}
-        }
-        if aquarium.Plants == nil {
-            aquarium.Plants = []Plant{}
-        }
-
-        aquariums = append(aquariums, aquarium)
+        listed = append(listed, &aquarium)
+        aquariumIDs = append(aquariumIDs, aquarium.ID)
     }
-
-    return aquariums, nil
-}
-
-
-// GetAquariumByID retrieves an aquarium by its ID.
-func GetAquariumByID(id string) (*AquariumResponse, error) {
-    query := `SELECT id, user_id, name, type, size, species, plants, equipment FROM aquariums WHERE id = $1`
-    var aquarium AquariumResponse
-    var speciesJSON, plantsJSON, equipmentJSON []byte
-
-    // Scan species, plants, and equipment as raw JSON (byte slices)
-    err := db.QueryRow(query, id).Scan(&aquarium.ID, &aquarium.UserID, &aquarium.Name, &aquarium.Type, &aquarium.Size, &speciesJSON, &plantsJSON, &equipmentJSON)
-    if err != nil {
-        return nil, err
+    if err := rows.Err(); err != nil {
+        return nil, queryError(ctx, err)
     }
+    rows.Close() // Release the connection before the next queries
 
-    // Unmarshal species JSON into a slice of AquariumSpecies
-    var speciesData []AquariumSpecies
-    if err := json.Unmarshal(speciesJSON, &speciesData); err != nil {
-        return nil, fmt.Errorf("error unmarshalling species JSON: %w", err)
+    if err := s.resolveAquariums(ctx, listed); err != nil {
+        return nil, queryError(ctx, err)
     }
 
-    // Create a map of species ID to count
-    speciesIDToCount := make(map[string]int)
-    var speciesIDs []string
-    for _, species := range speciesData {
-        speciesIDs = append(speciesIDs, species.Id)
-        speciesIDToCount[species.Id] = species.Count
-    }
-
-    // Retrieve species details by IDs
-    speciesDetails, err := GetSpeciesDetailsByIDs(speciesIDs)
-    if err != nil {
-        return nil, err
-    }
-
-    // Add count to speciesDetails
-    for i, species := range speciesDetails {
-        if count, ok := speciesIDToCount[species.Id]; ok {
-            speciesDetails[i].Count = count
+    var entries map[string][]WaterParameterEntry
+    if options.IncludeParameters {
+        entries, err = s.getRecentParameterEntries(ctx, aquariumIDs, options.ParameterLimit)
+        if err != nil {
+            return nil, queryError(ctx, err)
         }
     }
-    aquarium.Species = speciesDetails
 
-    // Unmarshal plants JSON into a slice of AquariumPlant
-    var plantData []AquariumPlant
-    if err := json.Unmarshal(plantsJSON, &plantData); err != nil {
-        return nil, err
+    var aquariums []AquariumResponse
+    for _, aquarium := range listed {
+        aquarium.ParameterEntries = entries[aquarium.ID]
+        aquariums = append(aquariums, *aquarium)
     }
+    return aquariums, nil
+}
 
-    // Create a map of plant ID to count
-    plantIDToCount := make(map[string]int)
-    var plantIDs []string
-    for _, plant := range plantData {
-        plantIDs = append(plantIDs, plant.Id)
-        plantIDToCount[plant.Id] = plant.Count
-    }
 
-    // Retrieve plant details by IDs
-    plantDetails, err := GetPlantsDetailsByIDs(plantIDs)
-    if err != nil {
-        return nil, err
-    }
+// GetAquariumByID retrieves an aquarium by its ID with all of its parameter entries.
+func (s *PostgresStore) GetAquariumByID(ctx context.Context, id string) (*AquariumResponse, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
 
-    // Add count to plantDetails
-    for i, plant := range plantDetails {
-        if count, ok := plantIDToCount[plant.Id]; ok {
-            plantDetails[i].Count = count
-        }
+    query := `SELECT id, user_id, version, name, type, size FROM aquariums WHERE id = $1`
+    var aquarium AquariumResponse
+    err := s.db.QueryRowContext(ctx, query, id).Scan(&aquarium.ID, &aquarium.UserID, &aquarium.Version, &aquarium.Name, &aquarium.Type, &aquarium.Size)
+    if err != nil {
+        return nil, queryError(ctx, err)
     }
-    aquarium.Plants = plantDetails
 
-    // Unmarshal equipment JSON
-    if err := json.Unmarshal(equipmentJSON, &aquarium.Equipment); err != nil {
-        return nil, fmt.Errorf("error unmarshalling equipment JSON: %w", err)
+    if err := s.resolveAquariums(ctx, []*AquariumResponse{&aquarium}); err != nil {
+        return nil, queryError(ctx, err)
     }
 
     // Retrieve parameter entries for this aquarium
-    parameterEntries, err := GetWaterParameterEntriesByAquariumID(aquarium.ID)
+    parameterEntries, err := s.GetWaterParameterEntriesByAquariumID(ctx, aquarium.ID)
     if err != nil {
-        return nil, err
+        return nil, queryError(ctx, err)
     }
     aquarium.ParameterEntries = parameterEntries
 
@@ -409,55 +378,77 @@ func GetAquariumByID(id string) (*AquariumResponse, error) {
 
 
 
-// UpdateAquarium updates an existing aquarium in the database.
-func UpdateAquarium(aquarium *Aquarium) error {
+// UpdateAquarium updates an existing aquarium and replaces its stock in the database, and
+// fills in its owner, its new version and the catalog names of its species and plants.
+// Callers must check that the user may edit the aquarium.
+// The update applies only if the aquarium is still at aquarium.Version, or to any version
+// if it is 0; otherwise it returns ErrVersionConflict. It returns an *UnknownCatalogError
+// if any of the stock is missing from the catalog. The update is recorded as a revision
+// made by the actor.
+func (s *PostgresStore) UpdateAquarium(ctx context.Context, aquarium *Aquarium, actor Actor) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
 
-    speciesJSON, err := json.Marshal(aquarium.Species)
+    tx, err := s.db.BeginTx(ctx, nil)
     if err != nil {
-        return err
+        return queryError(ctx, err)
     }
-    plantsJSON, err := json.Marshal(aquarium.Plants)
-    if err != nil {
-        return err
+    defer tx.Rollback()
+
+    if err := updateAquarium(ctx, tx, aquarium); err != nil {
+        return queryError(ctx, err)
     }
-    equipmentJSON, err := json.Marshal(aquarium.Equipment)
+
+    err = recordAquariumRevision(ctx, tx, AquariumRevision{
+        AquariumID: aquarium.ID,
+        Version:    aquarium.Version,
+        ActorID:    actor.UserID,
+        Action:     RevisionUpdate,
+    })
     if err != nil {
-        return err
+        return queryError(ctx, err)
     }
 
+    return queryError(ctx, tx.Commit())
+}
+
+// updateAquarium updates an aquarium at aquarium.Version and replaces its stock within a
+// transaction, as described for UpdateAquarium.
+func updateAquarium(ctx context.Context, tx *sql.Tx, aquarium *Aquarium) error {
     query := `
         UPDATE aquariums
-        SET name = $1, type = $2, size = $3, species = $4::jsonb, plants = $5::jsonb, equipment = $6::jsonb
-        WHERE id = $7 AND user_id = $8
+        SET name = $1, type = $2, size = $3, version = version + 1
+        WHERE id = $4 AND ($5 = 0 OR version = $5)
+        RETURNING user_id, version
     `
-    result, err := db.Exec(query, aquarium.Name, aquarium.Type, aquarium.Size, speciesJSON, plantsJSON, equipmentJSON, aquarium.ID, aquarium.UserID)
-    if err != nil {
-        return err
+    err := tx.QueryRowContext(ctx, query, aquarium.Name, aquarium.Type, aquarium.Size, aquarium.ID, aquarium.Version).
+        Scan(&aquarium.UserID, &aquarium.Version)
+    if err == sql.ErrNoRows {
+        err = staleAquariumError(ctx, tx, aquarium.ID)
     }
-
-    rowsAffected, err := result.RowsAffected()
     if err != nil {
         return err
     }
-    if rowsAffected == 0 {
-        return sql.ErrNoRows
-    }
 
-    return nil
+    return saveAquariumStock(ctx, tx, aquarium)
 }
 
 
 // DeleteAquarium deletes an aquarium from the database.
-func DeleteAquarium(id string, userID string) error {
-    query := `DELETE FROM aquariums WHERE id = $1 AND user_id = $2`
-    result, err := db.Exec(query, id, userID)
+// Callers must check that the user owns the aquarium.
+func (s *PostgresStore) DeleteAquarium(ctx context.Context, id string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `DELETE FROM aquariums WHERE id = $1`
+    result, err := s.db.ExecContext(ctx, query, id)
     if err != nil {
-        return err
+        return queryError(ctx, err)
     }
 
     rowsAffected, err := result.RowsAffected()
     if err != nil {
-        return err
+        return queryError(ctx, err)
     }
     if rowsAffected == 0 {
         return sql.ErrNoRows
@@ -467,7 +458,10 @@ func DeleteAquarium(id string, userID string) error {
 }
 
 
-func GetDetailByID(id string, detailType string) (interface{}, error) {
+func (s *PostgresStore) GetDetailByID(ctx context.Context, id string, detailType string) (interface{}, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
     var tableName string
     switch detailType {
     case "species":
@@ -513,7 +507,7 @@ func GetDetailByID(id string, detailType string) (interface{}, error) {
     switch detailType {
     case "species":
         var species Species
-        err := db.QueryRow(query, id).Scan(
+        err := s.db.QueryRowContext(ctx, query, id).Scan(
             &species.Id,
             &species.Name,
             &species.ImageURL,
@@ -536,12 +530,12 @@ func GetDetailByID(id string, detailType string) (interface{}, error) {
             &species.MinTankSize,
         )
         if err != nil {
-            return nil, err
+            return nil, queryError(ctx, err)
         }
         detail = species
     case "plant":
         var plant Plant
-        err := db.QueryRow(query, id).Scan(
+        err := s.db.QueryRowContext(ctx, query, id).Scan(
             &plant.Id,
             &plant.Name,
             &plant.Role,
@@ -562,12 +556,12 @@ func GetDetailByID(id string, detailType string) (interface{}, error) {
             &plant.ImageURL,
         )
         if err != nil {
-            return nil, err
+            return nil, queryError(ctx, err)
         }
         detail = plant
     case "equipment":
         var equipment Equipment
-        err := db.QueryRow(query, id).Scan(
+        err := s.db.QueryRowContext(ctx, query, id).Scan(
             &equipment.Id,
             &equipment.Name,
             &equipment.Description,
@@ -579,7 +573,7 @@ func GetDetailByID(id string, detailType string) (interface{}, error) {
             &equipment.Type,
         )
         if err != nil {
-            return nil, err
+            return nil, queryError(ctx, err)
         }
         detail = equipment
     default:
@@ -591,7 +585,10 @@ func GetDetailByID(id string, detailType string) (interface{}, error) {
 
 
 // GetAllDetails retrieves all records of a given type (species, plants, equipment) from the database.
-func GetAllDetails(detailType string) (interface{}, error) {
+func (s *PostgresStore) GetAllDetails(ctx context.Context, detailType string) (interface{}, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
     var query string
     switch detailType {
     case "species":
@@ -611,9 +608,9 @@ func GetAllDetails(detailType string) (interface{}, error) {
         return nil, errors.New("Invalid detail type")
     }
 
-    rows, err := db.Query(query)
+    rows, err := s.db.QueryContext(ctx, query)
     if err != nil {
-        return nil, err
+        return nil, queryError(ctx, err)
     }
     defer rows.Close()
 
@@ -645,7 +642,7 @@ func GetAllDetails(detailType string) (interface{}, error) {
                 &species.MinTankSize,
             )
             if err != nil {
-                return nil, err
+                return nil, queryError(ctx, err)
             }
             speciesList = append(speciesList, species)
         }
@@ -675,7 +672,7 @@ func GetAllDetails(detailType string) (interface{}, error) {
                 &plant.ImageURL,
             )
             if err != nil {
-                return nil, err
+                return nil, queryError(ctx, err)
             }
             plants = append(plants, plant)
         }
@@ -696,7 +693,7 @@ func GetAllDetails(detailType string) (interface{}, error) {
                 &equipment.Type,
             )
             if err != nil {
-                return nil, err
+                return nil, queryError(ctx, err)
             }
             equipmentList = append(equipmentList, equipment)
         }
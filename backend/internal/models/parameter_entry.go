@@ -3,21 +3,30 @@
 package models
 
 import (
+    "context"
+
+    "github.com/lib/pq"
 )
 
 // CreateWaterParameterEntry inserts a new parameter entry into the database.
-func CreateWaterParameterEntry(entry *WaterParameterEntry) error {
+func (s *PostgresStore) CreateWaterParameterEntry(ctx context.Context, entry *WaterParameterEntry) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
     query := `
         INSERT INTO parameter_entries (id, aquarium_id, timestamp, temperature, ph, hardness)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        VALUES ($1, $2, $3, $4, $5, $6)
     `
 
-    _, err := db.Exec(query, entry.ID, entry.AquariumID, entry.Timestamp, entry.Temperature, entry.Ph, entry.Hardness)
-    return err
+    _, err := s.db.ExecContext(ctx, query, entry.ID, entry.AquariumID, entry.Timestamp, entry.Temperature, entry.Ph, entry.Hardness)
+    return queryError(ctx, err)
 }
 
 // GetWaterParameterEntriesByAquariumID retrieves all parameter entries for a specific aquarium.
-func GetWaterParameterEntriesByAquariumID(aquariumID string) ([]WaterParameterEntry, error) {
+func (s *PostgresStore) GetWaterParameterEntriesByAquariumID(ctx context.Context, aquariumID string) ([]WaterParameterEntry, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
     query := `
         SELECT id, aquarium_id, timestamp, temperature, ph, hardness
         FROM parameter_entries
@@ -25,9 +34,9 @@ func GetWaterParameterEntriesByAquariumID(aquariumID string) ([]WaterParameterEn
         ORDER BY timestamp DESC
     `
 
-    rows, err := db.Query(query, aquariumID)
+    rows, err := s.db.QueryContext(ctx, query, aquariumID)
     if err != nil {
-        return nil, err
+        return nil, queryError(ctx, err)
     }
     defer rows.Close()
 
@@ -43,9 +52,55 @@ func GetWaterParameterEntriesByAquariumID(aquariumID string) ([]WaterParameterEn
             &entry.Hardness,
         )
         if err != nil {
-            return nil, err
+            return nil, queryError(ctx, err)
         }
         entries = append(entries, entry)
     }
     return entries, nil
-}
\ No newline at end of file
+}
+// getRecentParameterEntries retrieves in one query the most recent parameter entries of
+// each of the given aquariums, newest first, keyed by aquarium ID.
+//
+// Params:
+//   - aquariumIDs: the aquariums whose entries to retrieve
+//   - limit: how many entries to keep per aquarium; 0 keeps all of them
+func (s *PostgresStore) getRecentParameterEntries(ctx context.Context, aquariumIDs []string, limit int) (map[string][]WaterParameterEntry, error) {
+    entries := make(map[string][]WaterParameterEntry)
+    if len(aquariumIDs) == 0 {
+        return entries, nil
+    }
+
+    query := `
+        SELECT id, aquarium_id, timestamp, temperature, ph, hardness
+        FROM (
+            SELECT *, row_number() OVER (PARTITION BY aquarium_id ORDER BY timestamp DESC) AS recency
+            FROM parameter_entries
+            WHERE aquarium_id = ANY($1::uuid[])
+        ) ranked
+        WHERE $2 = 0 OR recency <= $2
+        ORDER BY aquarium_id, timestamp DESC
+    `
+
+    rows, err := s.db.QueryContext(ctx, query, pq.Array(aquariumIDs), limit)
+    if err != nil {
+        return nil, queryError(ctx, err)
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var entry WaterParameterEntry
+        err := rows.Scan(
+            &entry.ID,
+            &entry.AquariumID,
+            &entry.Timestamp,
+            &entry.Temperature,
+            &entry.Ph,
+            &entry.Hardness,
+        )
+        if err != nil {
+            return nil, queryError(ctx, err)
+        }
+        entries[entry.AquariumID] = append(entries[entry.AquariumID], entry)
+    }
+    return entries, queryError(ctx, rows.Err())
+}
@@ -0,0 +1,75 @@
+// models/password_reset.go
+
+package models
+
+import (
+    "context"
+    "time"
+)
+
+// Password reset tokens are single use and expire. Only the SHA-256 hash of a
+// token is stored.
+//
+// The schema is defined by migration 0005_password_reset_tokens in internal/migrate.
+
+// CreatePasswordResetToken stores the hash of a newly issued password reset token.
+func (s *PostgresStore) CreatePasswordResetToken(ctx context.Context, userID string, tokenHash string, expiresAt time.Time) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+    _, err := s.db.ExecContext(ctx, query, userID, tokenHash, expiresAt)
+    return queryError(ctx, err)
+}
+
+// ResetPassword consumes a password reset token and sets the user's new password in one
+// transaction. Every outstanding reset token and every session of the user is invalidated,
+// so anyone holding an old password or token is logged out. Because the reset link was
+// delivered to the user's inbox, the email address is marked as verified as well.
+//
+// Params:
+//   - tokenHash: the hash of the reset token presented by the user
+//   - passwordHash: the bcrypt hash of the new password
+//
+// Returns:
+//   - string: the ID of the user whose password was reset
+//   - error: sql.ErrNoRows if the token is unknown, used or expired, otherwise any database error
+func (s *PostgresStore) ResetPassword(ctx context.Context, tokenHash string, passwordHash string) (string, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return "", queryError(ctx, err)
+    }
+    defer tx.Rollback()
+
+    var userID string
+    query := `
+        UPDATE password_reset_tokens
+        SET used_at = now()
+        WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+        RETURNING user_id
+    `
+    err = tx.QueryRowContext(ctx, query, tokenHash).Scan(&userID)
+    if err != nil {
+        return "", queryError(ctx, err)
+    }
+
+    _, err = tx.ExecContext(ctx, `UPDATE users SET password = $1, verified_at = COALESCE(verified_at, now()) WHERE id = $2`, passwordHash, userID)
+    if err != nil {
+        return "", queryError(ctx, err)
+    }
+
+    _, err = tx.ExecContext(ctx, `UPDATE password_reset_tokens SET used_at = now() WHERE user_id = $1 AND used_at IS NULL`, userID)
+    if err != nil {
+        return "", queryError(ctx, err)
+    }
+
+    _, err = tx.ExecContext(ctx, `UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+    if err != nil {
+        return "", queryError(ctx, err)
+    }
+
+    return userID, queryError(ctx, tx.Commit())
+}
@@ -1,45 +1,41 @@
 package models
 
 import (
-    "fmt"
-    "strings"
-)
-
-
-// GetPlantsDetailsByIDs retrieves the details of plants by their IDs.
-func GetPlantsDetailsByIDs(plantIDs []string) ([]Plant, error) {
-    if len(plantIDs) == 0 {
-        return nil, nil
-    }
+    "context"
 
-    // Create a placeholder string for SQL IN clause
-    placeholders := make([]string, len(plantIDs))
-    args := make([]interface{}, len(plantIDs))
-    for i, id := range plantIDs {
-        placeholders[i] = fmt.Sprintf("$%d", i+1)
-        args[i] = id
-    }
+    "github.com/lib/pq"
+)
 
-    query := fmt.Sprintf(`
-        SELECT 
-            id, name, role, type, description, tank_requirements, min_tank_size,
-            compatibility, lifespan, size, water_parameters, lighting_needs,
-            growth_rate, care_level, native_habitat, propagation_methods,
-            special_considerations, image_url, scientific_name, wikipedia_link
-        FROM plants
-        WHERE id IN (%s)
-    `, strings.Join(placeholders, ", "))
+// getAquariumPlants retrieves the catalog details of the plants kept in the given
+// aquariums, in the order they were listed, keyed by aquarium ID. Each detail carries the
+// count kept in its aquarium.
+func (s *PostgresStore) getAquariumPlants(ctx context.Context, aquariumIDs []string) (map[string][]Plant, error) {
+    query := `
+        SELECT
+            k.aquarium_id, k.count, c.id, c.name, c.role, c.type, c.description, c.tank_requirements,
+            c.min_tank_size, c.compatibility, c.lifespan, c.size, c.water_parameters,
+            c.lighting_needs, c.growth_rate, c.care_level, c.native_habitat,
+            c.propagation_methods, c.special_considerations, c.image_url,
+            c.scientific_name, c.wikipedia_link
+        FROM aquarium_plants k
+        JOIN plants c ON c.id = k.plant_id
+        WHERE k.aquarium_id = ANY($1::uuid[])
+        ORDER BY k.aquarium_id, k.position
+    `
 
-    rows, err := db.Query(query, args...)
+    rows, err := s.db.QueryContext(ctx, query, pq.Array(aquariumIDs))
     if err != nil {
-        return nil, err
+        return nil, queryError(ctx, err)
     }
     defer rows.Close()
 
-    var plantList []Plant
+    plantsByAquarium := make(map[string][]Plant)
     for rows.Next() {
+        var aquariumID string
         var plant Plant
         err := rows.Scan(
+            &aquariumID,
+            &plant.Count,
             &plant.Id,
             &plant.Name,
             &plant.Role,
@@ -62,10 +58,10 @@ func GetPlantsDetailsByIDs(plantIDs []string) ([]Plant, error) {
             &plant.WikipediaLink,
         )
         if err != nil {
-            return nil, err
+            return nil, queryError(ctx, err)
         }
-        plantList = append(plantList, plant)
+        plantsByAquarium[aquariumID] = append(plantsByAquarium[aquariumID], plant)
     }
 
-    return plantList, nil
+    return plantsByAquarium, queryError(ctx, rows.Err())
 }
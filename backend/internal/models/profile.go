@@ -0,0 +1,196 @@
+// models/profile.go
+
+package models
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "strings"
+
+    "github.com/lib/pq"
+)
+
+// Profile is the self-service view of a user account.
+//
+// The schema is defined by migration 0007_profile_fields in internal/migrate.
+type Profile struct {
+    ID                string   `json:"id"`
+    Email             string   `json:"email"`
+    Username          string   `json:"username"`
+    FirstName         string   `json:"firstName"`
+    Bio               *string  `json:"bio"`
+    ProfilePictureURL *string  `json:"profilePictureUrl"`
+    Roles             []string `json:"roles"`
+    Verified          bool     `json:"verified"`
+    CreatedAt         string   `json:"createdAt"`
+}
+
+// ProfileUpdate holds the profile fields to change. Nil fields are left untouched.
+type ProfileUpdate struct {
+    Username          *string `json:"username"`
+    FirstName         *string `json:"firstName"`
+    Bio               *string `json:"bio"`
+    ProfilePictureURL *string `json:"profilePictureUrl"`
+}
+
+// ErrUsernameTaken is returned when a profile update asks for a username already in use.
+var ErrUsernameTaken = errors.New("username already taken")
+
+// GetUserProfile retrieves the profile of a user.
+func (s *PostgresStore) GetUserProfile(ctx context.Context, userID string) (*Profile, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    var profile Profile
+    var username, createdAt sql.NullString
+    query := `
+        SELECT id, email, username, first_name, bio, profile_picture_url, roles, verified_at IS NOT NULL, created_at
+        FROM users
+        WHERE id = $1
+    `
+    err := s.db.QueryRowContext(ctx, query, userID).Scan(
+        &profile.ID,
+        &profile.Email,
+        &username,
+        &profile.FirstName,
+        &profile.Bio,
+        &profile.ProfilePictureURL,
+        pq.Array(&profile.Roles),
+        &profile.Verified,
+        &createdAt,
+    )
+    if err != nil {
+        return nil, queryError(ctx, err)
+    }
+    profile.Username = username.String
+    profile.CreatedAt = createdAt.String
+    return &profile, nil
+}
+
+// UpdateUserProfile applies a partial update to a user's profile.
+// It returns ErrUsernameTaken if another user already has the requested username.
+func (s *PostgresStore) UpdateUserProfile(ctx context.Context, userID string, update ProfileUpdate) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    var sets []string
+    var args []interface{}
+    add := func(column string, value interface{}) {
+        args = append(args, value)
+        sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+    }
+
+    if update.Username != nil {
+        var taken bool
+        query := `SELECT EXISTS(SELECT 1 FROM users WHERE username = $1 AND id <> $2)`
+        if err := s.db.QueryRowContext(ctx, query, *update.Username, userID).Scan(&taken); err != nil {
+            return queryError(ctx, err)
+        }
+        if taken {
+            return ErrUsernameTaken
+        }
+        add("username", *update.Username)
+    }
+    if update.FirstName != nil {
+        add("first_name", *update.FirstName)
+    }
+    if update.Bio != nil {
+        add("bio", *update.Bio)
+    }
+    if update.ProfilePictureURL != nil {
+        add("profile_picture_url", *update.ProfilePictureURL)
+    }
+    if len(sets) == 0 {
+        return nil
+    }
+
+    args = append(args, userID)
+    query := fmt.Sprintf(`UPDATE users SET %s WHERE id = $%d`, strings.Join(sets, ", "), len(args))
+    result, err := s.db.ExecContext(ctx, query, args...)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    if rowsAffected == 0 {
+        return sql.ErrNoRows
+    }
+
+    return nil
+}
+
+// ChangeUserPassword sets a new password hash and revokes every other session of the user,
+// keeping only the session the change was made from.
+func (s *PostgresStore) ChangeUserPassword(ctx context.Context, userID string, passwordHash string, keepSessionID string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    defer tx.Rollback()
+
+    _, err = tx.ExecContext(ctx, `UPDATE users SET password = $1 WHERE id = $2`, passwordHash, userID)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+
+    _, err = tx.ExecContext(ctx, `UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL`, userID, keepSessionID)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+
+    return queryError(ctx, tx.Commit())
+}
+
+// DeleteUser permanently deletes a user together with their aquariums, parameter entries,
+// sessions and outstanding tokens in one transaction.
+func (s *PostgresStore) DeleteUser(ctx context.Context, userID string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    defer tx.Rollback()
+
+    statements := []string{
+        `DELETE FROM parameter_entries WHERE aquarium_id IN (SELECT id FROM aquariums WHERE user_id = $1)`,
+        `DELETE FROM personal_access_tokens WHERE user_id = $1`,
+        `DELETE FROM aquarium_members WHERE user_id = $1 OR aquarium_id IN (SELECT id FROM aquariums WHERE user_id = $1)`,
+        `DELETE FROM aquarium_invitations WHERE aquarium_id IN (SELECT id FROM aquariums WHERE user_id = $1)`,
+        `DELETE FROM aquarium_share_links WHERE aquarium_id IN (SELECT id FROM aquariums WHERE user_id = $1)`,
+        `DELETE FROM aquariums WHERE user_id = $1`,
+        `DELETE FROM refresh_tokens WHERE session_id IN (SELECT id FROM sessions WHERE user_id = $1)`,
+        `DELETE FROM sessions WHERE user_id = $1`,
+        `DELETE FROM password_reset_tokens WHERE user_id = $1`,
+        `DELETE FROM mfa_recovery_codes WHERE user_id = $1`,
+        `DELETE FROM user_identities WHERE user_id = $1`,
+    }
+    for _, statement := range statements {
+        if _, err := tx.ExecContext(ctx, statement, userID); err != nil {
+            return queryError(ctx, err)
+        }
+    }
+
+    result, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, userID)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    if rowsAffected == 0 {
+        return sql.ErrNoRows
+    }
+
+    return queryError(ctx, tx.Commit())
+}
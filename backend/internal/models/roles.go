@@ -0,0 +1,95 @@
+// models/roles.go
+
+package models
+
+import (
+    "context"
+    "database/sql"
+
+    "github.com/lib/pq"
+)
+
+// Roles that can be granted to users. Every user has RoleUser; RoleAdmin grants
+// access to catalog management, user administration and diagnostics endpoints.
+const (
+    RoleUser  = "user"
+    RoleAdmin = "admin"
+)
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+    return role == RoleUser || role == RoleAdmin
+}
+
+// ListUsers retrieves every user, ordered by email.
+func (s *PostgresStore) ListUsers(ctx context.Context) ([]User, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `SELECT ` + userColumns + ` FROM users ORDER BY email`
+    rows, err := s.db.QueryContext(ctx, query)
+    if err != nil {
+        return nil, queryError(ctx, err)
+    }
+    defer rows.Close()
+
+    var users []User
+    for rows.Next() {
+        user, err := scanUser(rows)
+        if err != nil {
+            return nil, queryError(ctx, err)
+        }
+        users = append(users, *user)
+    }
+    return users, queryError(ctx, rows.Err())
+}
+
+// SetUserRoles replaces the roles granted to a user.
+// It returns sql.ErrNoRows if the user does not exist.
+func (s *PostgresStore) SetUserRoles(ctx context.Context, userID string, roles []string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `UPDATE users SET roles = $1 WHERE id = $2`
+    result, err := s.db.ExecContext(ctx, query, pq.Array(roles), userID)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    if rowsAffected == 0 {
+        return sql.ErrNoRows
+    }
+
+    return nil
+}
+
+// GrantRoleByEmail adds a role to the user with the given email if they do not already have it.
+// It returns sql.ErrNoRows if the user does not exist.
+func (s *PostgresStore) GrantRoleByEmail(ctx context.Context, email string, role string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        UPDATE users
+        SET roles = CASE WHEN $1 = ANY(roles) THEN roles ELSE array_append(roles, $1) END
+        WHERE email = $2
+    `
+    result, err := s.db.ExecContext(ctx, query, role, email)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    if rowsAffected == 0 {
+        return sql.ErrNoRows
+    }
+
+    return nil
+}
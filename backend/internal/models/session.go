@@ -0,0 +1,217 @@
+// models/session.go
+
+package models
+
+import (
+    "context"
+    "database/sql"
+    "time"
+)
+
+// Session represents a single login of a user. Every refresh token minted for
+// that login belongs to the same session (the token "family"), so revoking the
+// session invalidates all access and refresh tokens derived from it.
+//
+// The schema is defined by migrations 0002_sessions and 0012_session_devices in internal/migrate.
+type Session struct {
+    ID         string     `json:"id"`         // Unique identifier of the session
+    UserID     string     `json:"-"`          // Owner of the session
+    UserAgent  string     `json:"userAgent"`  // User agent of the device that logged in
+    IP         string     `json:"ip"`         // IP address the session was last used from
+    CreatedAt  time.Time  `json:"createdAt"`  // When the user logged in
+    LastSeenAt time.Time  `json:"lastSeenAt"` // When the session was last used
+    RevokedAt  *time.Time `json:"-"`          // When the session was revoked, nil while active
+}
+
+// RefreshToken represents a single-use refresh token belonging to a session.
+// Only the SHA-256 hash of the token is stored.
+//
+// The schema is defined by migration 0002_sessions in internal/migrate.
+type RefreshToken struct {
+    ID               string     // Unique identifier of the refresh token
+    SessionID        string     // Session (family) the token belongs to
+    UserID           string     // Owner of the session
+    ExpiresAt        time.Time  // When the token stops being accepted
+    UsedAt           *time.Time // When the token was exchanged, nil if unused
+    SessionRevokedAt *time.Time // When the owning session was revoked, nil while active
+}
+
+// CreateSession starts a new session for the given user.
+//
+// Params:
+//   - userID: the ID of the user logging in
+//   - userAgent: the User-Agent header of the device logging in
+//   - ip: the client IP address of the device logging in
+//
+// Returns:
+//   - *Session: the newly created session
+//   - error: an error if the insert operation fails, otherwise nil
+func (s *PostgresStore) CreateSession(ctx context.Context, userID string, userAgent string, ip string) (*Session, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    session := Session{UserID: userID, UserAgent: userAgent, IP: ip}
+    query := `INSERT INTO sessions (user_id, user_agent, ip) VALUES ($1, $2, $3) RETURNING id, created_at, last_seen_at`
+    err := s.db.QueryRowContext(ctx, query, userID, userAgent, ip).Scan(&session.ID, &session.CreatedAt, &session.LastSeenAt)
+    if err != nil {
+        return nil, queryError(ctx, err)
+    }
+    return &session, nil
+}
+
+// ListActiveSessions retrieves the unrevoked sessions of a user, most recently used first.
+func (s *PostgresStore) ListActiveSessions(ctx context.Context, userID string) ([]Session, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        SELECT id, user_id, user_agent, ip, created_at, last_seen_at
+        FROM sessions
+        WHERE user_id = $1 AND revoked_at IS NULL
+        ORDER BY last_seen_at DESC
+    `
+    rows, err := s.db.QueryContext(ctx, query, userID)
+    if err != nil {
+        return nil, queryError(ctx, err)
+    }
+    defer rows.Close()
+
+    sessions := []Session{}
+    for rows.Next() {
+        var session Session
+        err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt)
+        if err != nil {
+            return nil, queryError(ctx, err)
+        }
+        sessions = append(sessions, session)
+    }
+    return sessions, queryError(ctx, rows.Err())
+}
+
+// TouchSession records that a session was used from the given IP address. To avoid a
+// write on every request, it only updates sessions not seen in the last minute.
+func (s *PostgresStore) TouchSession(ctx context.Context, sessionID string, ip string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        UPDATE sessions SET last_seen_at = now(), ip = $2
+        WHERE id = $1 AND revoked_at IS NULL AND last_seen_at < now() - interval '1 minute'
+    `
+    _, err := s.db.ExecContext(ctx, query, sessionID, ip)
+    return queryError(ctx, err)
+}
+
+// IsSessionActive reports whether the session exists and has not been revoked.
+func (s *PostgresStore) IsSessionActive(ctx context.Context, sessionID string) (bool, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    var active bool
+    query := `SELECT EXISTS(SELECT 1 FROM sessions WHERE id = $1 AND revoked_at IS NULL)`
+    err := s.db.QueryRowContext(ctx, query, sessionID).Scan(&active)
+    return active, queryError(ctx, err)
+}
+
+// RevokeSession revokes a single session belonging to the given user.
+// It returns sql.ErrNoRows if no active session matched.
+func (s *PostgresStore) RevokeSession(ctx context.Context, sessionID string, userID string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `UPDATE sessions SET revoked_at = now() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+    result, err := s.db.ExecContext(ctx, query, sessionID, userID)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    if rowsAffected == 0 {
+        return sql.ErrNoRows
+    }
+
+    return nil
+}
+
+// RevokeUserSessions revokes every active session of the given user.
+func (s *PostgresStore) RevokeUserSessions(ctx context.Context, userID string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`
+    _, err := s.db.ExecContext(ctx, query, userID)
+    return queryError(ctx, err)
+}
+
+// RevokeOtherSessions revokes every active session of the given user except keepSessionID,
+// returning the number of sessions revoked.
+func (s *PostgresStore) RevokeOtherSessions(ctx context.Context, userID string, keepSessionID string) (int64, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL`
+    result, err := s.db.ExecContext(ctx, query, userID, keepSessionID)
+    if err != nil {
+        return 0, queryError(ctx, err)
+    }
+    return result.RowsAffected()
+}
+
+// CreateRefreshToken stores the hash of a newly minted refresh token for a session.
+func (s *PostgresStore) CreateRefreshToken(ctx context.Context, sessionID string, tokenHash string, expiresAt time.Time) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `INSERT INTO refresh_tokens (session_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+    _, err := s.db.ExecContext(ctx, query, sessionID, tokenHash, expiresAt)
+    return queryError(ctx, err)
+}
+
+// GetRefreshTokenByHash looks up a refresh token by the hash of its value,
+// together with the owning session's user and revocation state.
+func (s *PostgresStore) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    var token RefreshToken
+    query := `
+        SELECT rt.id, rt.session_id, s.user_id, rt.expires_at, rt.used_at, s.revoked_at
+        FROM refresh_tokens rt
+        JOIN sessions s ON s.id = rt.session_id
+        WHERE rt.token_hash = $1
+    `
+    err := s.db.QueryRowContext(ctx, query, tokenHash).Scan(
+        &token.ID,
+        &token.SessionID,
+        &token.UserID,
+        &token.ExpiresAt,
+        &token.UsedAt,
+        &token.SessionRevokedAt,
+    )
+    if err != nil {
+        return nil, queryError(ctx, err)
+    }
+    return &token, nil
+}
+
+// MarkRefreshTokenUsed atomically marks a refresh token as exchanged.
+// It returns false if the token had already been used, which indicates reuse.
+func (s *PostgresStore) MarkRefreshTokenUsed(ctx context.Context, tokenID string) (bool, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `UPDATE refresh_tokens SET used_at = now() WHERE id = $1 AND used_at IS NULL`
+    result, err := s.db.ExecContext(ctx, query, tokenID)
+    if err != nil {
+        return false, queryError(ctx, err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return false, queryError(ctx, err)
+    }
+    return rowsAffected == 1, nil
+}
@@ -0,0 +1,94 @@
+// models/share_link.go
+
+package models
+
+import (
+    "context"
+    "time"
+)
+
+// ShareLink gives anyone holding its token a read-only view of an aquarium without
+// signing in. Links can be revoked and may expire. Only the SHA-256 hash of the token is stored.
+//
+// The schema is defined by migration 0014_aquarium_share_links in internal/migrate.
+type ShareLink struct {
+    ID         string     `json:"id"`         // Unique identifier of the link
+    AquariumID string     `json:"aquariumId"` // Aquarium the link shows
+    CreatedBy  string     `json:"createdBy"`  // User who created the link
+    CreatedAt  time.Time  `json:"createdAt"`  // When the link was created
+    ExpiresAt  *time.Time `json:"expiresAt"`  // When the link stops working, nil if it never expires
+    LastUsedAt *time.Time `json:"lastUsedAt"` // When the link was last opened
+}
+
+// CreateShareLink stores a new share link, setting its ID and creation time.
+//
+// Params:
+//   - link: the link to store; ID and CreatedAt are filled in
+//   - tokenHash: the hash of the token handed to the user
+func (s *PostgresStore) CreateShareLink(ctx context.Context, link *ShareLink, tokenHash string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        INSERT INTO aquarium_share_links (aquarium_id, token_hash, created_by, expires_at)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, created_at
+    `
+    return queryError(ctx, s.db.QueryRowContext(ctx, query, link.AquariumID, tokenHash, link.CreatedBy, link.ExpiresAt).Scan(&link.ID, &link.CreatedAt))
+}
+
+// ListShareLinks retrieves the unrevoked share links of an aquarium, including expired ones.
+func (s *PostgresStore) ListShareLinks(ctx context.Context, aquariumID string) ([]ShareLink, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        SELECT id, aquarium_id, COALESCE(created_by::text, ''), created_at, expires_at, last_used_at
+        FROM aquarium_share_links
+        WHERE aquarium_id = $1 AND revoked_at IS NULL
+        ORDER BY created_at
+    `
+    rows, err := s.db.QueryContext(ctx, query, aquariumID)
+    if err != nil {
+        return nil, queryError(ctx, err)
+    }
+    defer rows.Close()
+
+    links := []ShareLink{}
+    for rows.Next() {
+        var link ShareLink
+        err := rows.Scan(&link.ID, &link.AquariumID, &link.CreatedBy, &link.CreatedAt, &link.ExpiresAt, &link.LastUsedAt)
+        if err != nil {
+            return nil, queryError(ctx, err)
+        }
+        links = append(links, link)
+    }
+    return links, queryError(ctx, rows.Err())
+}
+
+// GetAquariumIDByShareToken resolves the token of an unrevoked, unexpired share link to
+// the aquarium it shows and records that the link was used.
+// It returns sql.ErrNoRows if no such link exists.
+func (s *PostgresStore) GetAquariumIDByShareToken(ctx context.Context, tokenHash string) (string, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        UPDATE aquarium_share_links SET last_used_at = now()
+        WHERE token_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())
+        RETURNING aquarium_id
+    `
+    var aquariumID string
+    err := s.db.QueryRowContext(ctx, query, tokenHash).Scan(&aquariumID)
+    return aquariumID, queryError(ctx, err)
+}
+
+// RevokeShareLink revokes a share link of an aquarium.
+// It returns sql.ErrNoRows if no unrevoked link matched.
+func (s *PostgresStore) RevokeShareLink(ctx context.Context, aquariumID string, linkID string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `UPDATE aquarium_share_links SET revoked_at = now() WHERE id = $1 AND aquarium_id = $2 AND revoked_at IS NULL`
+    return s.execAffectingRow(ctx, query, linkID, aquariumID)
+}
@@ -0,0 +1,305 @@
+// models/sharing.go
+
+package models
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "strings"
+    "time"
+)
+
+// Aquariums can be shared with other users, who become members with a role on that
+// aquarium. The user who created an aquarium (aquariums.user_id) is its primary owner;
+// the primary owner is not stored in aquarium_members and cannot be removed or demoted.
+// Users are added by invitation: an owner invites an email address and whoever holds
+// that address accepts with the token sent to it. Only the SHA-256 hash of an
+// invitation token is stored.
+//
+// The schema is defined by migration 0013_aquarium_sharing in internal/migrate.
+
+// Roles a user can hold on an aquarium, from least to most privileged.
+const (
+    AquariumRoleViewer = "viewer" // Can see the aquarium and its parameter entries
+    AquariumRoleEditor = "editor" // Can also change the aquarium and record parameter entries
+    AquariumRoleOwner  = "owner"  // Can also delete the aquarium and manage who it is shared with
+)
+
+// aquariumRoleRank orders the aquarium roles by privilege.
+var aquariumRoleRank = map[string]int{
+    AquariumRoleViewer: 1,
+    AquariumRoleEditor: 2,
+    AquariumRoleOwner:  3,
+}
+
+// ValidAquariumRole reports whether role is one of the aquarium roles.
+func ValidAquariumRole(role string) bool {
+    return aquariumRoleRank[role] > 0
+}
+
+// AquariumRoleAtLeast reports whether role grants everything the required role does.
+func AquariumRoleAtLeast(role string, required string) bool {
+    return ValidAquariumRole(role) && aquariumRoleRank[role] >= aquariumRoleRank[required]
+}
+
+// ErrInvitationEmailMismatch is returned when an invitation is accepted by a user
+// whose email address differs from the invited one.
+var ErrInvitationEmailMismatch = errors.New("invitation was sent to a different email address")
+
+// AquariumMember is a user with access to an aquarium.
+type AquariumMember struct {
+    UserID    string     `json:"userId"`    // ID of the member
+    Email     string     `json:"email"`     // Email address of the member
+    FirstName string     `json:"firstName"` // First name of the member
+    Role      string     `json:"role"`      // One of the AquariumRole constants
+    Primary   bool       `json:"primary"`   // Whether the member created the aquarium
+    JoinedAt  *time.Time `json:"joinedAt"`  // When the member accepted their invitation, nil for the primary owner
+}
+
+// AquariumInvitation is a pending invitation to share an aquarium.
+type AquariumInvitation struct {
+    ID         string    `json:"id"`         // Unique identifier of the invitation
+    AquariumID string    `json:"aquariumId"` // Aquarium being shared
+    Email      string    `json:"email"`      // Email address the invitation was sent to
+    Role       string    `json:"role"`       // Role granted on acceptance
+    InvitedBy  string    `json:"invitedBy"`  // User who sent the invitation
+    CreatedAt  time.Time `json:"createdAt"`  // When the invitation was sent
+    ExpiresAt  time.Time `json:"expiresAt"`  // When the invitation stops working
+}
+
+// GetAquariumRole returns the role a user holds on an aquarium, or "" if the aquarium
+// is not shared with them. It returns sql.ErrNoRows if the aquarium does not exist.
+func (s *PostgresStore) GetAquariumRole(ctx context.Context, aquariumID string, userID string) (string, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        SELECT CASE WHEN a.user_id = $2 THEN 'owner' ELSE COALESCE(m.role, '') END
+        FROM aquariums a
+        LEFT JOIN aquarium_members m ON m.aquarium_id = a.id AND m.user_id = $2
+        WHERE a.id = $1
+    `
+    var role string
+    err := s.db.QueryRowContext(ctx, query, aquariumID, userID).Scan(&role)
+    return role, queryError(ctx, err)
+}
+
+// ListAquariumMembers lists everyone with access to an aquarium, primary owner first.
+func (s *PostgresStore) ListAquariumMembers(ctx context.Context, aquariumID string) ([]AquariumMember, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        SELECT u.id, u.email, COALESCE(u.first_name, ''), 'owner', true, NULL::timestamptz
+        FROM aquariums a
+        JOIN users u ON u.id = a.user_id
+        WHERE a.id = $1
+        UNION ALL
+        SELECT u.id, u.email, COALESCE(u.first_name, ''), m.role, false, m.created_at
+        FROM aquarium_members m
+        JOIN users u ON u.id = m.user_id
+        WHERE m.aquarium_id = $1
+        ORDER BY 5 DESC, 6
+    `
+    rows, err := s.db.QueryContext(ctx, query, aquariumID)
+    if err != nil {
+        return nil, queryError(ctx, err)
+    }
+    defer rows.Close()
+
+    members := []AquariumMember{}
+    for rows.Next() {
+        var member AquariumMember
+        err := rows.Scan(&member.UserID, &member.Email, &member.FirstName, &member.Role, &member.Primary, &member.JoinedAt)
+        if err != nil {
+            return nil, queryError(ctx, err)
+        }
+        members = append(members, member)
+    }
+    return members, queryError(ctx, rows.Err())
+}
+
+// SetAquariumMemberRole changes the role of a member of an aquarium.
+// It returns sql.ErrNoRows if the user is not a member.
+func (s *PostgresStore) SetAquariumMemberRole(ctx context.Context, aquariumID string, userID string, role string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `UPDATE aquarium_members SET role = $3 WHERE aquarium_id = $1 AND user_id = $2`
+    return s.execAffectingRow(ctx, query, aquariumID, userID, role)
+}
+
+// RemoveAquariumMember revokes a member's access to an aquarium.
+// It returns sql.ErrNoRows if the user is not a member.
+func (s *PostgresStore) RemoveAquariumMember(ctx context.Context, aquariumID string, userID string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `DELETE FROM aquarium_members WHERE aquarium_id = $1 AND user_id = $2`
+    return s.execAffectingRow(ctx, query, aquariumID, userID)
+}
+
+// execAffectingRow executes a statement and returns sql.ErrNoRows if it changed no rows.
+func (s *PostgresStore) execAffectingRow(ctx context.Context, query string, args ...interface{}) error {
+    result, err := s.db.ExecContext(ctx, query, args...)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    if rowsAffected == 0 {
+        return sql.ErrNoRows
+    }
+    return nil
+}
+
+// CreateAquariumInvitation stores a new invitation, setting its ID and creation time.
+// Pending invitations of the same email address to the same aquarium are replaced.
+//
+// Params:
+//   - invitation: the invitation to store; ID and CreatedAt are filled in
+//   - tokenHash: the hash of the token sent to the invited address
+func (s *PostgresStore) CreateAquariumInvitation(ctx context.Context, invitation *AquariumInvitation, tokenHash string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    defer tx.Rollback()
+
+    _, err = tx.ExecContext(ctx, `DELETE FROM aquarium_invitations WHERE aquarium_id = $1 AND lower(email) = lower($2)`,
+        invitation.AquariumID, invitation.Email)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+
+    query := `
+        INSERT INTO aquarium_invitations (aquarium_id, email, role, token_hash, invited_by, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id, created_at
+    `
+    err = tx.QueryRowContext(ctx, query, invitation.AquariumID, invitation.Email, invitation.Role, tokenHash, invitation.InvitedBy, invitation.ExpiresAt).
+        Scan(&invitation.ID, &invitation.CreatedAt)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+
+    return queryError(ctx, tx.Commit())
+}
+
+// ListAquariumInvitations lists the unexpired invitations to an aquarium, newest first.
+func (s *PostgresStore) ListAquariumInvitations(ctx context.Context, aquariumID string) ([]AquariumInvitation, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        SELECT id, aquarium_id, email, role, COALESCE(invited_by::text, ''), created_at, expires_at
+        FROM aquarium_invitations
+        WHERE aquarium_id = $1 AND expires_at > now()
+        ORDER BY created_at DESC
+    `
+    rows, err := s.db.QueryContext(ctx, query, aquariumID)
+    if err != nil {
+        return nil, queryError(ctx, err)
+    }
+    defer rows.Close()
+
+    invitations := []AquariumInvitation{}
+    for rows.Next() {
+        var invitation AquariumInvitation
+        err := rows.Scan(
+            &invitation.ID,
+            &invitation.AquariumID,
+            &invitation.Email,
+            &invitation.Role,
+            &invitation.InvitedBy,
+            &invitation.CreatedAt,
+            &invitation.ExpiresAt,
+        )
+        if err != nil {
+            return nil, queryError(ctx, err)
+        }
+        invitations = append(invitations, invitation)
+    }
+    return invitations, queryError(ctx, rows.Err())
+}
+
+// RevokeAquariumInvitation deletes an invitation to an aquarium.
+// It returns sql.ErrNoRows if there is no such invitation.
+func (s *PostgresStore) RevokeAquariumInvitation(ctx context.Context, aquariumID string, invitationID string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `DELETE FROM aquarium_invitations WHERE id = $1 AND aquarium_id = $2`
+    return s.execAffectingRow(ctx, query, invitationID, aquariumID)
+}
+
+// AcceptAquariumInvitation consumes an invitation and makes the user a member of the
+// aquarium with the invited role. A user who already has access gets the invited role
+// instead, except for the primary owner, whose role never changes.
+//
+// Params:
+//   - tokenHash: the hash of the invitation token presented by the user
+//   - userID: the user accepting the invitation
+//   - email: the email address of the user, which must match the invited address
+//
+// Returns:
+//   - *AquariumInvitation: the accepted invitation
+//   - error: sql.ErrNoRows if the token is unknown or expired, ErrInvitationEmailMismatch
+//     if the invitation was sent to another address, otherwise any database error
+func (s *PostgresStore) AcceptAquariumInvitation(ctx context.Context, tokenHash string, userID string, email string) (*AquariumInvitation, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return nil, queryError(ctx, err)
+    }
+    defer tx.Rollback()
+
+    var invitation AquariumInvitation
+    query := `
+        SELECT id, aquarium_id, email, role, COALESCE(invited_by::text, ''), created_at, expires_at
+        FROM aquarium_invitations
+        WHERE token_hash = $1 AND expires_at > now()
+        FOR UPDATE
+    `
+    err = tx.QueryRowContext(ctx, query, tokenHash).Scan(
+        &invitation.ID,
+        &invitation.AquariumID,
+        &invitation.Email,
+        &invitation.Role,
+        &invitation.InvitedBy,
+        &invitation.CreatedAt,
+        &invitation.ExpiresAt,
+    )
+    if err != nil {
+        return nil, queryError(ctx, err)
+    }
+    if !strings.EqualFold(invitation.Email, email) {
+        return nil, ErrInvitationEmailMismatch
+    }
+
+    _, err = tx.ExecContext(ctx, `DELETE FROM aquarium_invitations WHERE id = $1`, invitation.ID)
+    if err != nil {
+        return nil, queryError(ctx, err)
+    }
+
+    query = `
+        INSERT INTO aquarium_members (aquarium_id, user_id, role, invited_by)
+        SELECT $1, $2, $3, NULLIF($4, '')::uuid
+        WHERE NOT EXISTS (SELECT 1 FROM aquariums WHERE id = $1 AND user_id = $2)
+        ON CONFLICT (aquarium_id, user_id) DO UPDATE SET role = EXCLUDED.role
+    `
+    _, err = tx.ExecContext(ctx, query, invitation.AquariumID, userID, invitation.Role, invitation.InvitedBy)
+    if err != nil {
+        return nil, queryError(ctx, err)
+    }
+
+    return &invitation, queryError(ctx, tx.Commit())
+}
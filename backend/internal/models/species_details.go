@@ -1,45 +1,41 @@
 package models
 
 import (
-    "fmt"
-    "strings"
-)
-
-// GetSpeciesDetailsByIDs retrieves the details of species by their IDs.
-func GetSpeciesDetailsByIDs(speciesIDs []string) ([]Species, error) {
-    if len(speciesIDs) == 0 {
-        return nil, nil
-    }
+    "context"
 
-    // Create a placeholder string for SQL IN clause
-    placeholders := make([]string, len(speciesIDs))
-    args := make([]interface{}, len(speciesIDs))
-    for i, id := range speciesIDs {
-        placeholders[i] = fmt.Sprintf("$%d", i+1)
-        args[i] = id
-    }
+    "github.com/lib/pq"
+)
 
-    query := fmt.Sprintf(`
-        SELECT 
-            id, name, role, type, description, feeding_habits, tank_requirements,
-            min_tank_size, compatibility, lifespan, size, water_parameters,
-            breeding_info, behavior, care_level, dietary_restrictions, native_habitat,
-            stocking_recommendations, special_considerations, image_url, scientific_name,
-            wikipedia_link
-        FROM species
-        WHERE id IN (%s)
-    `, strings.Join(placeholders, ", "))
+// getAquariumSpecies retrieves the catalog details of the species kept in the given
+// aquariums, in the order they were listed, keyed by aquarium ID. Each detail carries the
+// count kept in its aquarium.
+func (s *PostgresStore) getAquariumSpecies(ctx context.Context, aquariumIDs []string) (map[string][]Species, error) {
+    query := `
+        SELECT
+            k.aquarium_id, k.count, c.id, c.name, c.role, c.type, c.description, c.feeding_habits,
+            c.tank_requirements, c.min_tank_size, c.compatibility, c.lifespan, c.size,
+            c.water_parameters, c.breeding_info, c.behavior, c.care_level,
+            c.dietary_restrictions, c.native_habitat, c.stocking_recommendations,
+            c.special_considerations, c.image_url, c.scientific_name, c.wikipedia_link
+        FROM aquarium_species k
+        JOIN species c ON c.id = k.species_id
+        WHERE k.aquarium_id = ANY($1::uuid[])
+        ORDER BY k.aquarium_id, k.position
+    `
 
-    rows, err := db.Query(query, args...)
+    rows, err := s.db.QueryContext(ctx, query, pq.Array(aquariumIDs))
     if err != nil {
-        return nil, err
+        return nil, queryError(ctx, err)
     }
     defer rows.Close()
 
-    var speciesList []Species
+    speciesByAquarium := make(map[string][]Species)
     for rows.Next() {
+        var aquariumID string
         var species Species
         err := rows.Scan(
+            &aquariumID,
+            &species.Count,
             &species.Id,
             &species.Name,
             &species.Role,
@@ -64,10 +60,10 @@ func GetSpeciesDetailsByIDs(speciesIDs []string) ([]Species, error) {
             &species.WikipediaLink,
         )
         if err != nil {
-            return nil, err
+            return nil, queryError(ctx, err)
         }
-        speciesList = append(speciesList, species)
+        speciesByAquarium[aquariumID] = append(speciesByAquarium[aquariumID], species)
     }
 
-    return speciesList, nil
+    return speciesByAquarium, queryError(ctx, rows.Err())
 }
@@ -0,0 +1,227 @@
+// models/store.go
+
+package models
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "time"
+)
+
+// Every store reports a missing row with sql.ErrNoRows, whatever its backing storage,
+// so callers can handle "not found" the same way for every implementation.
+//
+// Every store call takes the context of the request it serves. A call interrupted
+// because that context ended fails with ErrQueryCanceled or ErrQueryTimeout, wrapping
+// whatever error the storage returned, so callers can tell a client that went away or
+// an overloaded database apart from a failed query.
+
+// ErrQueryCanceled is returned when the context of a store call is canceled before the
+// call completes, typically because the client of the request disconnected.
+var ErrQueryCanceled = errors.New("query canceled")
+
+// ErrQueryTimeout is returned when a store call does not complete before its deadline,
+// either the query timeout of the store or a deadline set on the context.
+var ErrQueryTimeout = errors.New("query timed out")
+
+// UserStore persists user accounts and everything used to prove who a user is:
+// passwords, email verification, password reset tokens, TOTP enrollment and linked
+// external identities.
+type UserStore interface {
+    CreateUser(ctx context.Context, email, password, first_name string, username string, subscribe string, created_at string) (string, error)
+    GetUserByEmail(ctx context.Context, email string) (*User, error)
+    GetUserByID(ctx context.Context, id string) (*User, error)
+    UserExists(ctx context.Context, email string) bool
+    ListUsers(ctx context.Context) ([]User, error)
+    SetUserRoles(ctx context.Context, userID string, roles []string) error
+    GrantRoleByEmail(ctx context.Context, email string, role string) error
+
+    GetUserProfile(ctx context.Context, userID string) (*Profile, error)
+    UpdateUserProfile(ctx context.Context, userID string, update ProfileUpdate) error
+    ChangeUserPassword(ctx context.Context, userID string, passwordHash string, keepSessionID string) error
+    DeleteUser(ctx context.Context, userID string) error
+
+    MarkUserVerified(ctx context.Context, userID string, email string) error
+    ReserveVerificationEmail(ctx context.Context, userID string, minInterval time.Duration) (bool, error)
+    ClaimUnverifiedAccount(ctx context.Context, userID string, passwordHash string) error
+    CreatePasswordResetToken(ctx context.Context, userID string, tokenHash string, expiresAt time.Time) error
+    ResetPassword(ctx context.Context, tokenHash string, passwordHash string) (string, error)
+
+    GetTOTPState(ctx context.Context, userID string) (*TOTPState, error)
+    SetPendingTOTPSecret(ctx context.Context, userID string, secret string) error
+    EnableTOTP(ctx context.Context, userID string, step int64, codeHashes []string) error
+    ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error
+    RecordTOTPStep(ctx context.Context, userID string, step int64) (bool, error)
+    UseRecoveryCode(ctx context.Context, userID string, codeHash string) (bool, error)
+    DisableTOTP(ctx context.Context, userID string) error
+
+    GetUserByIdentity(ctx context.Context, provider string, subject string) (*User, error)
+    LinkIdentity(ctx context.Context, userID string, provider string, subject string, email string) error
+    CreateUserWithIdentity(ctx context.Context, email, password, firstName string, username string, subscribe string, createdAt string, identity Identity, verified bool) (string, error)
+    ListIdentities(ctx context.Context, userID string) ([]Identity, error)
+    UnlinkIdentity(ctx context.Context, userID string, provider string, subject string) error
+}
+
+// SessionStore persists what a user holds after signing in: sessions with their
+// refresh tokens and personal access tokens. It also keeps the failed login counters
+// used to throttle password guessing.
+type SessionStore interface {
+    CreateSession(ctx context.Context, userID string, userAgent string, ip string) (*Session, error)
+    ListActiveSessions(ctx context.Context, userID string) ([]Session, error)
+    TouchSession(ctx context.Context, sessionID string, ip string) error
+    IsSessionActive(ctx context.Context, sessionID string) (bool, error)
+    RevokeSession(ctx context.Context, sessionID string, userID string) error
+    RevokeUserSessions(ctx context.Context, userID string) error
+    RevokeOtherSessions(ctx context.Context, userID string, keepSessionID string) (int64, error)
+
+    CreateRefreshToken(ctx context.Context, sessionID string, tokenHash string, expiresAt time.Time) error
+    GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*RefreshToken, error)
+    MarkRefreshTokenUsed(ctx context.Context, tokenID string) (bool, error)
+
+    CreatePersonalAccessToken(ctx context.Context, token *PersonalAccessToken, tokenHash string) error
+    GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*PersonalAccessToken, error)
+    ListPersonalAccessTokens(ctx context.Context, userID string) ([]PersonalAccessToken, error)
+    TouchPersonalAccessToken(ctx context.Context, tokenID string) error
+    RevokePersonalAccessToken(ctx context.Context, tokenID string, userID string) error
+
+    RecordLoginFailure(ctx context.Context, key string, resetAfter time.Duration) (int, error)
+    SetLoginLockout(ctx context.Context, key string, until time.Time) error
+    GetLoginLockout(ctx context.Context, key string) (time.Time, error)
+    ClearLoginFailures(ctx context.Context, key string) error
+}
+
+// AuditStore persists the append-only audit log.
+type AuditStore interface {
+    RecordAuditEvent(ctx context.Context, event AuditEvent) error
+    ListAuditEvents(ctx context.Context, filter AuditFilter) ([]AuditEvent, error)
+    ListSecurityActivity(ctx context.Context, userID string, limit int) ([]AuditEvent, error)
+}
+
+// AquariumStore persists aquariums together with who they are shared with, through
+// memberships, invitations and public share links.
+type AquariumStore interface {
+    CreateAquarium(ctx context.Context, aquarium *Aquarium, actor Actor) error
+    GetAquariumsByUserID(ctx context.Context, userID string, options AquariumListOptions) ([]AquariumResponse, error)
+    GetAquariumByID(ctx context.Context, id string) (*AquariumResponse, error)
+    UpdateAquarium(ctx context.Context, aquarium *Aquarium, actor Actor) error
+    AdjustAquariumStock(ctx context.Context, adjustment *StockAdjustment, actor Actor) error
+    ListAquariumRevisions(ctx context.Context, aquariumID string, limit int) ([]AquariumRevision, error)
+    GetAquariumRevision(ctx context.Context, aquariumID string, version int64) (*AquariumRevision, error)
+    GetAquariumRevisionAt(ctx context.Context, aquariumID string, at time.Time) (*AquariumRevision, error)
+    RestoreAquariumRevision(ctx context.Context, aquariumID string, revision int64, version int64, actor Actor) (int64, error)
+    DeleteAquarium(ctx context.Context, id string) error
+
+    GetAquariumRole(ctx context.Context, aquariumID string, userID string) (string, error)
+    ListAquariumMembers(ctx context.Context, aquariumID string) ([]AquariumMember, error)
+    SetAquariumMemberRole(ctx context.Context, aquariumID string, userID string, role string) error
+    RemoveAquariumMember(ctx context.Context, aquariumID string, userID string) error
+    CreateAquariumInvitation(ctx context.Context, invitation *AquariumInvitation, tokenHash string) error
+    ListAquariumInvitations(ctx context.Context, aquariumID string) ([]AquariumInvitation, error)
+    RevokeAquariumInvitation(ctx context.Context, aquariumID string, invitationID string) error
+    AcceptAquariumInvitation(ctx context.Context, tokenHash string, userID string, email string) (*AquariumInvitation, error)
+
+    CreateShareLink(ctx context.Context, link *ShareLink, tokenHash string) error
+    ListShareLinks(ctx context.Context, aquariumID string) ([]ShareLink, error)
+    GetAquariumIDByShareToken(ctx context.Context, tokenHash string) (string, error)
+    RevokeShareLink(ctx context.Context, aquariumID string, linkID string) error
+}
+
+// CatalogStore persists the catalog of species, plants and equipment. Every change is
+// recorded in the audit log together with the change itself.
+type CatalogStore interface {
+    GetDetailByID(ctx context.Context, id string, detailType string) (interface{}, error)
+    GetAllDetails(ctx context.Context, detailType string) (interface{}, error)
+    CreateSpecies(ctx context.Context, species *Species, actor Actor) error
+    UpdateSpecies(ctx context.Context, species *Species, actor Actor) error
+    CreatePlant(ctx context.Context, plant *Plant, actor Actor) error
+    UpdatePlant(ctx context.Context, plant *Plant, actor Actor) error
+    CreateEquipment(ctx context.Context, equipment *Equipment, actor Actor) error
+    UpdateEquipment(ctx context.Context, equipment *Equipment, actor Actor) error
+    DeleteDetail(ctx context.Context, detailType string, id string, actor Actor) error
+}
+
+// ParameterStore persists the water parameter entries recorded for aquariums.
+type ParameterStore interface {
+    CreateWaterParameterEntry(ctx context.Context, entry *WaterParameterEntry) error
+    GetWaterParameterEntriesByAquariumID(ctx context.Context, aquariumID string) ([]WaterParameterEntry, error)
+}
+
+// HealthChecker reports on the storage backing the stores, for diagnostics.
+type HealthChecker interface {
+    Ping(ctx context.Context) error
+    DBStats() sql.DBStats
+}
+
+// Store combines every store. Implementations keep all data in one place, so
+// operations spanning several stores, such as deleting a user, stay consistent.
+type Store interface {
+    UserStore
+    SessionStore
+    AuditStore
+    AquariumStore
+    CatalogStore
+    ParameterStore
+    HealthChecker
+}
+
+// PostgresStore implements Store on a PostgreSQL database whose schema is managed by
+// internal/migrate.
+type PostgresStore struct {
+    db           *sql.DB
+    queryTimeout time.Duration
+}
+
+// NewPostgresStore returns a Store using the given database connection pool.
+//
+// Params:
+//   - db: the connection pool to query
+//   - queryTimeout: how long each store call may take, including the statements of its
+//     transaction; 0 leaves calls bounded only by the deadline of their context
+func NewPostgresStore(db *sql.DB, queryTimeout time.Duration) *PostgresStore {
+    return &PostgresStore{db: db, queryTimeout: queryTimeout}
+}
+
+// withTimeout derives the context of one store call, bounded by the query timeout.
+func (s *PostgresStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+    if s.queryTimeout <= 0 {
+        return context.WithCancel(ctx)
+    }
+    return context.WithTimeout(ctx, s.queryTimeout)
+}
+
+// queryError reports err as ErrQueryCanceled or ErrQueryTimeout when ctx ended before
+// the call that returned it completed. The database driver reports an interrupted
+// statement with errors of its own, so the context is what tells why it failed.
+func queryError(ctx context.Context, err error) error {
+    if err == nil || errors.Is(err, ErrQueryCanceled) || errors.Is(err, ErrQueryTimeout) {
+        return err
+    }
+    switch ctx.Err() {
+    case context.Canceled:
+        return fmt.Errorf("%w: %v", ErrQueryCanceled, err)
+    case context.DeadlineExceeded:
+        return fmt.Errorf("%w: %v", ErrQueryTimeout, err)
+    }
+    return err
+}
+
+// DBStats returns connection pool statistics for diagnostics.
+func (s *PostgresStore) DBStats() sql.DBStats {
+    return s.db.Stats()
+}
+
+// Ping verifies the database connection is alive.
+func (s *PostgresStore) Ping(ctx context.Context) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    return queryError(ctx, s.db.PingContext(ctx))
+}
+
+// Both implementations must provide every store.
+var (
+    _ Store = (*PostgresStore)(nil)
+    _ Store = (*MemoryStore)(nil)
+)
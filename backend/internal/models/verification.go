@@ -0,0 +1,125 @@
+// models/verification.go
+
+package models
+
+import (
+    "context"
+    "database/sql"
+    "time"
+)
+
+// Email verification state is kept on the users table.
+//
+// The schema is defined by migration 0006_email_verification in internal/migrate.
+
+// MarkUserVerified records that the user's current email address has been verified.
+// Verifying an already verified user keeps the original timestamp.
+//
+// Params:
+//   - userID: the ID of the user
+//   - email: the address that was verified; nothing changes if the user's email no longer matches
+//
+// Returns:
+//   - error: sql.ErrNoRows if no user with that ID and email exists, otherwise any database error
+func (s *PostgresStore) MarkUserVerified(ctx context.Context, userID string, email string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `UPDATE users SET verified_at = COALESCE(verified_at, now()) WHERE id = $1 AND email = $2`
+    result, err := s.db.ExecContext(ctx, query, userID, email)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    if rowsAffected == 0 {
+        return sql.ErrNoRows
+    }
+
+    return nil
+}
+
+// ReserveVerificationEmail records that a verification email is about to be sent to an
+// unverified user, unless one was already sent within minInterval.
+//
+// Returns:
+//   - bool: true if the email may be sent, false if the user is verified or was emailed too recently
+//   - error: an error if the update fails
+func (s *PostgresStore) ReserveVerificationEmail(ctx context.Context, userID string, minInterval time.Duration) (bool, error) {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        UPDATE users
+        SET verification_sent_at = now()
+        WHERE id = $1
+          AND verified_at IS NULL
+          AND (verification_sent_at IS NULL OR verification_sent_at < now() - make_interval(secs => $2))
+    `
+    result, err := s.db.ExecContext(ctx, query, userID, minInterval.Seconds())
+    if err != nil {
+        return false, queryError(ctx, err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return false, queryError(ctx, err)
+    }
+    return rowsAffected == 1, nil
+}
+
+// ClaimUnverifiedAccount hands an unverified, password-registered account over to the
+// person who just proved ownership of its email address through an identity provider.
+// The unknown password is replaced, the email is marked verified and every existing
+// session is revoked, so whoever registered the address without owning it loses access.
+// Everything else they could have set up to keep access goes too: linked identities,
+// personal access tokens, two-factor authentication, aquarium memberships held by the
+// account or granted on its aquariums, invitations and share links. Nothing changes if
+// the account was verified in the meantime.
+func (s *PostgresStore) ClaimUnverifiedAccount(ctx context.Context, userID string, passwordHash string) error {
+    ctx, cancel := s.withTimeout(ctx)
+    defer cancel()
+
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    defer tx.Rollback()
+
+    query := `
+        UPDATE users
+        SET password = $1, verified_at = now(), totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL
+        WHERE id = $2 AND verified_at IS NULL
+    `
+    result, err := tx.ExecContext(ctx, query, passwordHash, userID)
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return queryError(ctx, err)
+    }
+    if rowsAffected == 0 {
+        return nil
+    }
+
+    statements := []string{
+        `UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`,
+        `DELETE FROM user_identities WHERE user_id = $1`,
+        `DELETE FROM personal_access_tokens WHERE user_id = $1`,
+        `DELETE FROM mfa_recovery_codes WHERE user_id = $1`,
+        `DELETE FROM aquarium_members WHERE user_id = $1 OR aquarium_id IN (SELECT id FROM aquariums WHERE user_id = $1)`,
+        `DELETE FROM aquarium_invitations WHERE invited_by = $1 OR aquarium_id IN (SELECT id FROM aquariums WHERE user_id = $1)`,
+        `DELETE FROM aquarium_share_links WHERE created_by = $1 OR aquarium_id IN (SELECT id FROM aquariums WHERE user_id = $1)`,
+    }
+    for _, statement := range statements {
+        if _, err := tx.ExecContext(ctx, statement, userID); err != nil {
+            return queryError(ctx, err)
+        }
+    }
+
+    return queryError(ctx, tx.Commit())
+}
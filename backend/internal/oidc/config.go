@@ -0,0 +1,68 @@
+package oidc
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Google's issuer. Google ID tokens may carry the issuer with or without the scheme.
+const (
+	GoogleIssuer    = "https://accounts.google.com"
+	googleAltIssuer = "accounts.google.com"
+)
+
+// ProvidersFromEnv builds the configured identity providers, keyed by name.
+//
+// Environment:
+//   - CLIENT_ID: Google client ID; configures the "google" provider
+//   - GOOGLE_CLIENT_SECRET: Google client secret, needed only for authorization codes
+//   - GITHUB_CLIENT_ID, GITHUB_CLIENT_SECRET: configure the "github" provider
+//   - OIDC_PROVIDERS: comma-separated names of further OpenID Connect providers. Each
+//     name is configured with OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID and optionally
+//     OIDC_<NAME>_CLIENT_SECRET.
+func ProvidersFromEnv() (map[string]Provider, error) {
+	providers := make(map[string]Provider)
+
+	if clientID := os.Getenv("CLIENT_ID"); clientID != "" {
+		providers["google"] = &OIDCProvider{
+			ProviderName: "google",
+			IssuerURL:    GoogleIssuer,
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+			ExtraIssuers: []string{googleAltIssuer},
+		}
+	}
+
+	if clientID := os.Getenv("GITHUB_CLIENT_ID"); clientID != "" {
+		providers["github"] = &GitHubProvider{
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
+		}
+	}
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if _, exists := providers[name]; exists {
+			return nil, fmt.Errorf("identity provider %s is configured twice", name)
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		issuer := os.Getenv(prefix + "ISSUER")
+		clientID := os.Getenv(prefix + "CLIENT_ID")
+		if issuer == "" || clientID == "" {
+			return nil, fmt.Errorf("identity provider %s needs %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+		}
+		providers[name] = &OIDCProvider{
+			ProviderName: name,
+			IssuerURL:    issuer,
+			ClientID:     clientID,
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+		}
+	}
+
+	return providers, nil
+}
@@ -0,0 +1,107 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default GitHub endpoints.
+const (
+	GitHubTokenURL = "https://github.com/login/oauth/access_token"
+	GitHubAPIURL   = "https://api.github.com"
+)
+
+// GitHubProvider signs users in with GitHub. GitHub does not issue ID tokens, so the
+// authorization code is exchanged for an access token and the user is read from the REST API.
+type GitHubProvider struct {
+	ClientID     string       // OAuth app client ID
+	ClientSecret string       // OAuth app client secret
+	TokenURL     string       // Token endpoint, empty for GitHubTokenURL
+	APIURL       string       // REST API base URL, empty for GitHubAPIURL
+	HTTPClient   *http.Client // Client for token and API requests, nil for a default client
+}
+
+// Name returns "github".
+func (p *GitHubProvider) Name() string {
+	return "github"
+}
+
+func (p *GitHubProvider) client() *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
+	}
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+// Authenticate exchanges the authorization code and looks up the GitHub user and their
+// primary email address.
+func (p *GitHubProvider) Authenticate(ctx context.Context, cred Credential) (*Identity, error) {
+	if cred.Code == "" {
+		return nil, ErrInvalidCredential
+	}
+
+	tokenURL := p.TokenURL
+	if tokenURL == "" {
+		tokenURL = GitHubTokenURL
+	}
+	apiURL := strings.TrimSuffix(p.APIURL, "/")
+	if apiURL == "" {
+		apiURL = GitHubAPIURL
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	form := url.Values{
+		"code":          {cred.Code},
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+	}
+	if cred.RedirectURI != "" {
+		form.Set("redirect_uri", cred.RedirectURI)
+	}
+	if err := postForm(ctx, p.client(), tokenURL, form, &token); err != nil {
+		return nil, err
+	}
+	// GitHub reports a bad code with 200 OK and an error field
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCredential, token.Error)
+	}
+
+	var user struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := getJSON(ctx, p.client(), apiURL+"/user", token.AccessToken, &user); err != nil {
+		return nil, fmt.Errorf("fetching GitHub user: %w", err)
+	}
+	if user.ID == 0 {
+		return nil, ErrInvalidCredential
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, p.client(), apiURL+"/user/emails", token.AccessToken, &emails); err != nil {
+		return nil, fmt.Errorf("fetching GitHub emails: %w", err)
+	}
+
+	identity := &Identity{Provider: p.Name(), Subject: strconv.FormatInt(user.ID, 10)}
+	identity.GivenName, _, _ = strings.Cut(strings.TrimSpace(user.Name), " ")
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = email.Email
+			identity.EmailVerified = email.Verified
+			break
+		}
+	}
+	return identity, nil
+}
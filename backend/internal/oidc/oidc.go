@@ -0,0 +1,365 @@
+// Package oidc signs users in through external identity providers. Any OpenID Connect
+// issuer can be configured from its discovery document; GitHub, which only speaks plain
+// OAuth2, is supported through its REST API. Handlers only see the Provider interface
+// and the Identity it returns.
+package oidc
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ErrInvalidCredential is returned when a token or code is rejected by the provider or fails verification.
+var ErrInvalidCredential = errors.New("invalid credential")
+
+// Identity is a user as asserted by an external identity provider.
+type Identity struct {
+	Provider      string // Name of the provider that asserted the identity
+	Subject       string // Stable, provider-unique user identifier
+	Email         string // Email address, may be empty
+	EmailVerified bool   // Whether the provider vouches for the email address
+	GivenName     string // First name, may be empty
+}
+
+// Credential is what a client obtained from a provider's sign-in flow. Providers
+// accept an ID token, an authorization code, or both.
+type Credential struct {
+	IDToken     string `json:"id_token,omitempty"`     // ID token from an implicit or client-side flow
+	Code        string `json:"code,omitempty"`         // Authorization code to exchange
+	RedirectURI string `json:"redirect_uri,omitempty"` // Redirect URI the code was issued for
+	Nonce       string `json:"nonce,omitempty"`        // Nonce the ID token must carry, if one was sent
+}
+
+// Provider authenticates users against an external identity provider.
+type Provider interface {
+	// Name returns the provider's configured name, e.g. "google".
+	Name() string
+	// Authenticate verifies the credential and returns the identity it proves.
+	Authenticate(ctx context.Context, cred Credential) (*Identity, error)
+}
+
+// Discovery is the subset of an OpenID Provider's discovery document that is used.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// jwk is a single key of a provider's JSON Web Key Set.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// jwksRefreshInterval limits how often an unknown key ID triggers a JWKS refetch.
+const jwksRefreshInterval = time.Minute
+
+// OIDCProvider is a provider configured from an OpenID Connect discovery document.
+// Discovery and key retrieval happen lazily on first use, so an unreachable issuer
+// does not prevent the service from starting.
+type OIDCProvider struct {
+	ProviderName string       // Name used in routes and stored identities
+	IssuerURL    string       // Issuer URL; the discovery document is read from IssuerURL/.well-known/openid-configuration
+	ClientID     string       // Client ID, which ID tokens must be issued to
+	ClientSecret string       // Client secret for exchanging authorization codes, empty if codes are not used
+	ExtraIssuers []string     // Additional "iss" values accepted, e.g. "accounts.google.com"
+	HTTPClient   *http.Client // Client for discovery, key and token requests, nil for a default client
+
+	mu          sync.Mutex
+	discovery   *Discovery
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+// Name returns the provider's configured name.
+func (p *OIDCProvider) Name() string {
+	return p.ProviderName
+}
+
+func (p *OIDCProvider) client() *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
+	}
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+// Discover fetches and caches the provider's discovery document.
+func (p *OIDCProvider) Discover(ctx context.Context) (*Discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.discoverLocked(ctx)
+}
+
+func (p *OIDCProvider) discoverLocked(ctx context.Context) (*Discovery, error) {
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var doc Discovery
+	wellKnown := strings.TrimSuffix(p.IssuerURL, "/") + "/.well-known/openid-configuration"
+	if err := getJSON(ctx, p.client(), wellKnown, "", &doc); err != nil {
+		return nil, fmt.Errorf("fetching discovery document: %w", err)
+	}
+	if doc.Issuer != p.IssuerURL {
+		return nil, fmt.Errorf("discovery document issuer %q does not match %q", doc.Issuer, p.IssuerURL)
+	}
+	if doc.JWKSURI == "" {
+		return nil, errors.New("discovery document has no jwks_uri")
+	}
+
+	p.discovery = &doc
+	return p.discovery, nil
+}
+
+// publicKey returns the RSA key with the given kid, refetching the key set if the
+// kid is unknown, since providers rotate keys regularly.
+func (p *OIDCProvider) publicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+
+	discovery, err := p.discoverLocked(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(ctx, p.client(), discovery.JWKSURI, "", &set); err != nil {
+		return nil, fmt.Errorf("fetching JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		key, err := parseRSAKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	return key, nil
+}
+
+// parseRSAKey decodes the modulus and exponent of an RSA JWK.
+func parseRSAKey(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("decoding modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("decoding exponent: %w", err)
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("unsupported exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+// Authenticate verifies an ID token, exchanging the authorization code for one first
+// if no ID token was given.
+func (p *OIDCProvider) Authenticate(ctx context.Context, cred Credential) (*Identity, error) {
+	idToken := cred.IDToken
+	if idToken == "" {
+		if cred.Code == "" {
+			return nil, ErrInvalidCredential
+		}
+		var err error
+		idToken, err = p.exchangeCode(ctx, cred)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p.VerifyIDToken(ctx, idToken, cred.Nonce)
+}
+
+// exchangeCode redeems an authorization code at the token endpoint and returns the ID token.
+func (p *OIDCProvider) exchangeCode(ctx context.Context, cred Credential) (string, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	if discovery.TokenEndpoint == "" {
+		return "", errors.New("provider has no token endpoint")
+	}
+
+	var response struct {
+		IDToken string `json:"id_token"`
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {cred.Code},
+		"redirect_uri":  {cred.RedirectURI},
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+	}
+	if err := postForm(ctx, p.client(), discovery.TokenEndpoint, form, &response); err != nil {
+		return "", err
+	}
+	if response.IDToken == "" {
+		return "", ErrInvalidCredential
+	}
+	return response.IDToken, nil
+}
+
+// VerifyIDToken checks an RS256 ID token's signature against the provider's keys and
+// validates its issuer, audience, lifetime and, if nonce is not empty, its nonce.
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, idToken string, nonce string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method.Alg() != jwt.SigningMethodRS256.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredential, err)
+	}
+
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	issuer, _ := claims["iss"].(string)
+	if issuer != discovery.Issuer && !contains(p.ExtraIssuers, issuer) {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidCredential, issuer)
+	}
+	if !audienceContains(claims["aud"], p.ClientID) {
+		return nil, fmt.Errorf("%w: token not issued to this client", ErrInvalidCredential)
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("%w: token has no expiry", ErrInvalidCredential)
+	}
+	if nonce != "" {
+		if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+			return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidCredential)
+		}
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: token has no subject", ErrInvalidCredential)
+	}
+
+	identity := &Identity{Provider: p.ProviderName, Subject: subject}
+	identity.Email, _ = claims["email"].(string)
+	identity.GivenName, _ = claims["given_name"].(string)
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		// Some providers encode the flag as a string
+		identity.EmailVerified = verified == "true"
+	}
+	return identity, nil
+}
+
+// audienceContains reports whether the "aud" claim, a string or an array of strings, contains clientID.
+func audienceContains(aud interface{}, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// getJSON performs a GET request and decodes the JSON response. A non-empty bearer
+// token is sent in the Authorization header.
+func getJSON(ctx context.Context, client *http.Client, endpoint string, bearer string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	return doJSON(client, req, v)
+}
+
+// postForm posts a form and decodes the JSON response.
+func postForm(ctx context.Context, client *http.Client, endpoint string, form url.Values, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	return doJSON(client, req, v)
+}
+
+// maxResponseSize bounds the size of provider responses that are read.
+const maxResponseSize = 1 << 20
+
+func doJSON(client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("%w: %s returned %s", ErrInvalidCredential, req.URL.Host, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,280 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	testClientID = "test-client"
+	testKeyID    = "test-key"
+)
+
+// fakeIssuer is a local OpenID Connect provider serving a discovery document, a JWKS and
+// a token endpoint, and signing ID tokens with its test key.
+type fakeIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	// idToken is returned by the token endpoint for the code "good-code".
+	idToken string
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	issuer := &fakeIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:        issuer.server.URL,
+			TokenEndpoint: issuer.server.URL + "/token",
+			JWKSURI:       issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []jwk{{
+				Kty: "RSA",
+				Kid: testKeyID,
+				Alg: "RS256",
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "good-code" || r.PostFormValue("client_id") != testClientID {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": issuer.idToken})
+	})
+
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+// provider returns a provider configured for the fake issuer.
+func (f *fakeIssuer) provider() *OIDCProvider {
+	return &OIDCProvider{
+		ProviderName: "test",
+		IssuerURL:    f.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: "secret",
+		HTTPClient:   f.server.Client(),
+	}
+}
+
+// claims returns the claims of a valid ID token, to be altered by each test.
+func (f *fakeIssuer) claims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            f.server.URL,
+		"aud":            testClientID,
+		"sub":            "user-123",
+		"email":          "user@example.com",
+		"email_verified": true,
+		"given_name":     "Ada",
+		"nonce":          "expected-nonce",
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+}
+
+// sign signs claims as an RS256 ID token with the given key and key ID.
+func sign(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return signed
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	provider := issuer.provider()
+
+	identity, err := provider.VerifyIDToken(context.Background(), sign(t, issuer.key, testKeyID, issuer.claims()), "expected-nonce")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	want := Identity{Provider: "test", Subject: "user-123", Email: "user@example.com", EmailVerified: true, GivenName: "Ada"}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestVerifyIDTokenRejectsInvalidTokens(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(claims jwt.MapClaims)
+		key    *rsa.PrivateKey
+		kid    string
+		nonce  string
+	}{
+		{
+			name:   "bad issuer",
+			change: func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" },
+		},
+		{
+			name:   "bad audience",
+			change: func(claims jwt.MapClaims) { claims["aud"] = "another-client" },
+		},
+		{
+			name:   "audience list without the client",
+			change: func(claims jwt.MapClaims) { claims["aud"] = []string{"another-client", "third-client"} },
+		},
+		{
+			name:   "expired",
+			change: func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() },
+		},
+		{
+			name:   "no expiry",
+			change: func(claims jwt.MapClaims) { delete(claims, "exp") },
+		},
+		{
+			name:   "bad nonce",
+			change: func(claims jwt.MapClaims) { claims["nonce"] = "replayed-nonce" },
+		},
+		{
+			name:   "missing nonce",
+			change: func(claims jwt.MapClaims) { delete(claims, "nonce") },
+		},
+		{
+			name:   "no subject",
+			change: func(claims jwt.MapClaims) { delete(claims, "sub") },
+		},
+		{
+			name: "signed by another key",
+			key:  otherKey,
+		},
+		{
+			name: "unknown key ID",
+			kid:  "rotated-away",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := issuer.claims()
+			if test.change != nil {
+				test.change(claims)
+			}
+			key, kid := issuer.key, testKeyID
+			if test.key != nil {
+				key = test.key
+			}
+			if test.kid != "" {
+				kid = test.kid
+			}
+
+			_, err := issuer.provider().VerifyIDToken(context.Background(), sign(t, key, kid, claims), "expected-nonce")
+			if !errors.Is(err, ErrInvalidCredential) {
+				t.Errorf("VerifyIDToken error = %v, want ErrInvalidCredential", err)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenRejectsOtherAlgorithms(t *testing.T) {
+	issuer := newFakeIssuer(t)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, issuer.claims())
+	token.Header["kid"] = testKeyID
+	signed, err := token.SignedString([]byte("shared-secret"))
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+
+	_, err = issuer.provider().VerifyIDToken(context.Background(), signed, "")
+	if !errors.Is(err, ErrInvalidCredential) {
+		t.Errorf("VerifyIDToken error = %v, want ErrInvalidCredential", err)
+	}
+}
+
+func TestVerifyIDTokenOptionalClaims(t *testing.T) {
+	issuer := newFakeIssuer(t)
+
+	claims := issuer.claims()
+	delete(claims, "given_name")
+	claims["email_verified"] = "false"
+	claims["aud"] = []string{"another-client", testClientID}
+
+	// Without an expected nonce, the nonce of the token is not checked
+	identity, err := issuer.provider().VerifyIDToken(context.Background(), sign(t, issuer.key, testKeyID, claims), "")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if identity.GivenName != "" {
+		t.Errorf("GivenName = %q, want empty", identity.GivenName)
+	}
+	if identity.EmailVerified {
+		t.Error("EmailVerified = true, want false")
+	}
+	if identity.Subject != "user-123" || identity.Email != "user@example.com" {
+		t.Errorf("identity = %+v", *identity)
+	}
+}
+
+func TestAuthenticateExchangesCode(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	issuer.idToken = sign(t, issuer.key, testKeyID, issuer.claims())
+	provider := issuer.provider()
+
+	identity, err := provider.Authenticate(context.Background(), Credential{Code: "good-code", RedirectURI: "https://app.example.com/callback", Nonce: "expected-nonce"})
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if identity.Subject != "user-123" {
+		t.Errorf("Subject = %q, want user-123", identity.Subject)
+	}
+
+	_, err = provider.Authenticate(context.Background(), Credential{Code: "bad-code"})
+	if !errors.Is(err, ErrInvalidCredential) {
+		t.Errorf("Authenticate with a bad code: error = %v, want ErrInvalidCredential", err)
+	}
+
+	_, err = provider.Authenticate(context.Background(), Credential{})
+	if !errors.Is(err, ErrInvalidCredential) {
+		t.Errorf("Authenticate without a credential: error = %v, want ErrInvalidCredential", err)
+	}
+}
+
+func TestDiscoverRejectsMismatchedIssuer(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	provider := issuer.provider()
+	provider.IssuerURL = issuer.server.URL + "/"
+
+	if _, err := provider.Discover(context.Background()); err == nil {
+		t.Error("Discover accepted a discovery document for another issuer")
+	}
+}
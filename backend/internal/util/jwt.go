@@ -8,67 +8,55 @@ import (
     "github.com/dgrijalva/jwt-go"
     "errors"
     "strings"
-    "log"
-    "os"
-
-    "github.com/joho/godotenv"
 )
 
 // Claims represents the structure for JWT claims. It embeds the StandardClaims
-// from the JWT package and includes an Email field to store the user's email address.
+// from the JWT package, whose Subject holds the user's ID, and includes the
+// session the token was issued for and the roles granted to the user.
 type Claims struct {
-    Email string `json:"email"`           // The user's email address
-    jwt.StandardClaims                   // Embedded standard claims (e.g., expiration time)
+    SessionID string   `json:"sid"`             // The session the token was issued for
+    Roles     []string `json:"roles,omitempty"` // The roles granted to the user
+    jwt.StandardClaims                          // Embedded standard claims (subject, expiration time, ...)
 }
 
-// jwtKey is a global variable that stores the secret key for signing JWTs.
-var jwtKey []byte
-
-// init function is executed when the package is initialized.
-// It loads the environment variables and retrieves the JWT secret key once.
-func init() {
-    // Load environment variables from .env file (optional in case it's used locally)
-    err := godotenv.Load()
-    if err != nil {
-        log.Println("No .env file found, using system environment variables")
-    }
+// AccessTokenTTL is how long an access token stays valid. Access tokens are kept
+// short-lived and renewed with a refresh token, so a revoked session stops being
+// usable quickly even for callers that skip the session check.
+const AccessTokenTTL = 15 * time.Minute
 
-    // Get the JWT secret key from environment variables
-    jwtSecret := os.Getenv("JWT_SECRET")
-    if jwtSecret == "" {
-        log.Fatal("JWT_SECRET is not set in the environment")
-    }
-
-    // Set the secret key for JWT as a global variable
-    jwtKey = []byte(jwtSecret)
+// SigningKeyID returns the key ID new tokens are signed with.
+func (k *KeySet) SigningKeyID() string {
+    return k.signingKID
 }
 
-// GenerateJWT creates and signs a new JWT token for the given email.
-// The token is valid for 24 hours.
+// GenerateJWT creates and signs a new access token for the given user and session.
+// The token is valid for AccessTokenTTL.
 //
 // Params:
-//   - email: the email address to embed in the token claims.
+//   - userID: the ID of the user, stored as the token subject.
+//   - sessionID: the session the token belongs to; revoking it invalidates the token.
+//   - roles: the roles granted to the user.
 //
 // Returns:
 //   - string: the signed JWT token.
 //   - error: an error if the token generation fails.
-func GenerateJWT(email string) (string, error) {
-    // Set expiration time (e.g., 24 hours)
-    expirationTime := time.Now().Add(24 * time.Hour)
+func (k *KeySet) GenerateJWT(userID string, sessionID string, roles []string) (string, error) {
+    now := time.Now()
+    expirationTime := now.Add(AccessTokenTTL)
 
-    // Create the JWT claims, including the user's email and expiration time
+    // Create the JWT claims, including the user's ID, session, roles and expiration time
     claims := &Claims{
-        Email: email,
+        SessionID: sessionID,
+        Roles:     roles,
         StandardClaims: jwt.StandardClaims{
+            Subject:   userID,
+            IssuedAt:  now.Unix(),
             ExpiresAt: expirationTime.Unix(),
         },
     }
 
-    // Create the token with claims
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-    // Sign the token with the secret key (jwtKey)
-    tokenString, err := token.SignedString(jwtKey)
+    // Sign the token with the current signing key
+    tokenString, err := k.Sign(claims)
     if err != nil {
         return "", err
     }
@@ -84,18 +72,17 @@ func GenerateJWT(email string) (string, error) {
 //   - tokenString: the JWT token string to validate.
 //
 // Returns:
-//   - *Claims: the claims (including the email) if the token is valid.
+//   - *Claims: the claims (including the user ID) if the token is valid.
 //   - error: an error if the token is invalid or if there was an issue parsing it.
-func ValidateJWT(tokenString string) (*Claims, error) {
+func (k *KeySet) ValidateJWT(tokenString string) (*Claims, error) {
     claims := &Claims{}
 
-    // Parse the JWT string and store the result in `claims`
-    token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-        return jwtKey, nil // jwtKey is now accessible globally
-    })
+    // Parse the JWT string, resolving the verification key from its "kid" header
+    token, err := jwt.ParseWithClaims(tokenString, claims, k.Keyfunc)
 
-    // Check if there was an error in parsing or the token is invalid
-    if err != nil || !token.Valid {
+    // Check if there was an error in parsing or the token is invalid. Access tokens always
+    // carry a session, which also keeps single-purpose tokens from being used as access tokens.
+    if err != nil || !token.Valid || claims.SessionID == "" {
         return nil, errors.New("invalid token")
     }
 
@@ -103,28 +90,16 @@ func ValidateJWT(tokenString string) (*Claims, error) {
     return claims, nil
 }
 
-// ExtractEmailFromJWT extracts the email from the JWT token in the Authorization header.
-func ExtractEmailFromJWT(authHeader string) (string, error) {
+// ExtractClaimsFromJWT validates the JWT token in the Authorization header and returns its claims.
+func (k *KeySet) ExtractClaimsFromJWT(authHeader string) (*Claims, error) {
     if authHeader == "" {
-        return "", errors.New("authorization header is empty")
+        return nil, errors.New("authorization header is empty")
     }
 
     parts := strings.Split(authHeader, " ")
     if len(parts) != 2 || parts[0] != "Bearer" {
-        return "", errors.New("invalid authorization header format")
+        return nil, errors.New("invalid authorization header format")
     }
 
-    tokenStr := parts[1]
-
-    claims := &Claims{}
-
-    token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-        return jwtKey, nil
-    })
-
-    if err != nil || !token.Valid {
-        return "", errors.New("invalid token")
-    }
-
-    return claims.Email, nil
-}
\ No newline at end of file
+    return k.ValidateJWT(parts[1])
+}
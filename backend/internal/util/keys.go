@@ -0,0 +1,288 @@
+package utils
+
+import (
+    "crypto"
+    "crypto/ed25519"
+    "crypto/rsa"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "math/big"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+
+    "github.com/dgrijalva/jwt-go"
+)
+
+// Keys are loaded from the directory named by JWT_KEY_DIR. Each file is named after
+// its key ID (kid):
+//
+//   - <kid>.pem      a PKCS#8 RSA or Ed25519 private key, usable for signing and verification
+//   - <kid>.pub.pem  a PKIX public key, usable for verification only
+//
+// The signing key is the one named by JWT_SIGNING_KEY_ID, or, if unset, the private
+// key whose kid sorts last. Using date-based kids (e.g. 2024-11-01) therefore makes
+// the newest key the signer automatically.
+//
+// Rotation procedure:
+//
+//  1. Generate a new key with a kid that sorts after the current one, e.g.
+//     `openssl genpkey -algorithm ed25519 -out 2024-12-01.pem`, and add it to the key directory.
+//  2. Restart auth-service. New tokens are signed with the new key; tokens signed with
+//     the old key still verify because the old key is still loaded, and both keys are
+//     published on /.well-known/jwks.json.
+//  3. Once the longest-lived token signed by the old key has expired, replace the old
+//     <kid>.pem with its public half (`openssl pkey -in old.pem -pubout -out old.pub.pem`)
+//     or remove it entirely.
+
+// verificationKey is a public key that tokens can be verified against.
+type verificationKey struct {
+    kid    string
+    method jwt.SigningMethod
+    public crypto.PublicKey
+}
+
+// KeySet holds the key used to sign new tokens and every key accepted for verification.
+type KeySet struct {
+    signingKID string
+    signingKey crypto.PrivateKey
+    signing    jwt.SigningMethod
+    verifying  map[string]*verificationKey
+}
+
+// JWK is a single JSON Web Key as published on the JWKS endpoint.
+type JWK struct {
+    Kty string `json:"kty"`           // Key type: "RSA" or "OKP"
+    Kid string `json:"kid"`           // Key ID matching the token "kid" header
+    Use string `json:"use"`           // Always "sig"
+    Alg string `json:"alg"`           // "RS256" or "EdDSA"
+    N   string `json:"n,omitempty"`   // RSA modulus
+    E   string `json:"e,omitempty"`   // RSA public exponent
+    Crv string `json:"crv,omitempty"` // Ed25519 curve name
+    X   string `json:"x,omitempty"`   // Ed25519 public key
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+    Keys []JWK `json:"keys"`
+}
+
+// LoadKeySet reads every key in dir and selects the signing key.
+//
+// Params:
+//   - dir: the directory containing the PEM encoded keys.
+//   - signingKID: the kid of the key to sign with, or "" to use the last private key.
+//
+// Returns:
+//   - *KeySet: the loaded keys.
+//   - error: an error if a key cannot be parsed or no signing key is available.
+func LoadKeySet(dir string, signingKID string) (*KeySet, error) {
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        return nil, fmt.Errorf("reading key directory: %w", err)
+    }
+
+    set := &KeySet{verifying: make(map[string]*verificationKey)}
+    private := make(map[string]crypto.PrivateKey)
+
+    for _, entry := range entries {
+        name := entry.Name()
+        if entry.IsDir() || !strings.HasSuffix(name, ".pem") {
+            continue
+        }
+
+        data, err := os.ReadFile(filepath.Join(dir, name))
+        if err != nil {
+            return nil, fmt.Errorf("reading key %s: %w", name, err)
+        }
+        block, _ := pem.Decode(data)
+        if block == nil {
+            return nil, fmt.Errorf("key %s is not PEM encoded", name)
+        }
+
+        var public crypto.PublicKey
+        var kid string
+        if strings.HasSuffix(name, ".pub.pem") {
+            kid = strings.TrimSuffix(name, ".pub.pem")
+            public, err = x509.ParsePKIXPublicKey(block.Bytes)
+            if err != nil {
+                return nil, fmt.Errorf("parsing public key %s: %w", name, err)
+            }
+        } else {
+            kid = strings.TrimSuffix(name, ".pem")
+            key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+            if err != nil {
+                return nil, fmt.Errorf("parsing private key %s: %w", name, err)
+            }
+            signer, ok := key.(crypto.Signer)
+            if !ok {
+                return nil, fmt.Errorf("private key %s cannot sign", name)
+            }
+            private[kid] = key
+            public = signer.Public()
+        }
+
+        method, err := signingMethodFor(public)
+        if err != nil {
+            return nil, fmt.Errorf("key %s: %w", name, err)
+        }
+        if _, exists := set.verifying[kid]; exists {
+            return nil, fmt.Errorf("duplicate key ID %s", kid)
+        }
+        set.verifying[kid] = &verificationKey{kid: kid, method: method, public: public}
+    }
+
+    if signingKID == "" {
+        kids := make([]string, 0, len(private))
+        for kid := range private {
+            kids = append(kids, kid)
+        }
+        if len(kids) == 0 {
+            return nil, errors.New("no private key found in key directory")
+        }
+        sort.Strings(kids)
+        signingKID = kids[len(kids)-1]
+    }
+
+    key, ok := private[signingKID]
+    if !ok {
+        return nil, fmt.Errorf("signing key %s not found in key directory", signingKID)
+    }
+    set.signingKID = signingKID
+    set.signingKey = key
+    set.signing = set.verifying[signingKID].method
+
+    return set, nil
+}
+
+// NewKeySet returns a key set signing with the given private key, which is also the only
+// key accepted for verification. It suits keys generated at runtime, such as in tests.
+//
+// Params:
+//   - kid: the key ID set in the "kid" header of signed tokens.
+//   - key: an RSA or Ed25519 private key.
+//
+// Returns:
+//   - *KeySet: the key set.
+//   - error: an error if the key type is not supported.
+func NewKeySet(kid string, key crypto.PrivateKey) (*KeySet, error) {
+    signer, ok := key.(crypto.Signer)
+    if !ok {
+        return nil, fmt.Errorf("private key %s cannot sign", kid)
+    }
+    method, err := signingMethodFor(signer.Public())
+    if err != nil {
+        return nil, fmt.Errorf("key %s: %w", kid, err)
+    }
+    return &KeySet{
+        signingKID: kid,
+        signingKey: key,
+        signing:    method,
+        verifying:  map[string]*verificationKey{kid: {kid: kid, method: method, public: signer.Public()}},
+    }, nil
+}
+
+// signingMethodFor maps a public key type to the JWT algorithm used with it.
+func signingMethodFor(public crypto.PublicKey) (jwt.SigningMethod, error) {
+    switch public.(type) {
+    case *rsa.PublicKey:
+        return jwt.SigningMethodRS256, nil
+    case ed25519.PublicKey:
+        return SigningMethodEdDSA, nil
+    default:
+        return nil, fmt.Errorf("unsupported key type %T", public)
+    }
+}
+
+// Sign signs the claims with the current signing key and sets the "kid" header.
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+    token := jwt.NewWithClaims(k.signing, claims)
+    token.Header["kid"] = k.signingKID
+    return token.SignedString(k.signingKey)
+}
+
+// Keyfunc resolves the verification key for a token from its "kid" header.
+// Tokens whose algorithm does not match the key's algorithm are rejected.
+func (k *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+    kid, _ := token.Header["kid"].(string)
+    key, ok := k.verifying[kid]
+    if !ok {
+        return nil, fmt.Errorf("unknown key ID %q", kid)
+    }
+    if token.Method.Alg() != key.method.Alg() {
+        return nil, fmt.Errorf("unexpected signing method %s for key %s", token.Method.Alg(), kid)
+    }
+    return key.public, nil
+}
+
+// JWKS returns the public half of every verification key.
+func (k *KeySet) JWKS() JWKS {
+    kids := make([]string, 0, len(k.verifying))
+    for kid := range k.verifying {
+        kids = append(kids, kid)
+    }
+    sort.Strings(kids)
+
+    set := JWKS{Keys: make([]JWK, 0, len(kids))}
+    for _, kid := range kids {
+        key := k.verifying[kid]
+        jwk := JWK{Kid: kid, Use: "sig", Alg: key.method.Alg()}
+        switch public := key.public.(type) {
+        case *rsa.PublicKey:
+            jwk.Kty = "RSA"
+            jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+            jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+        case ed25519.PublicKey:
+            jwk.Kty = "OKP"
+            jwk.Crv = "Ed25519"
+            jwk.X = base64.RawURLEncoding.EncodeToString(public)
+        }
+        set.Keys = append(set.Keys, jwk)
+    }
+    return set
+}
+
+// SigningMethodEdDSA implements the EdDSA (Ed25519) JWT algorithm, which jwt-go does not provide.
+var SigningMethodEdDSA = &signingMethodEd25519{}
+
+type signingMethodEd25519 struct{}
+
+func init() {
+    jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+        return SigningMethodEdDSA
+    })
+}
+
+// Alg returns the JWT algorithm name.
+func (m *signingMethodEd25519) Alg() string {
+    return "EdDSA"
+}
+
+// Sign signs the signing string with an ed25519.PrivateKey.
+func (m *signingMethodEd25519) Sign(signingString string, key interface{}) (string, error) {
+    privateKey, ok := key.(ed25519.PrivateKey)
+    if !ok {
+        return "", jwt.ErrInvalidKeyType
+    }
+    return jwt.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
+
+// Verify checks the signature with an ed25519.PublicKey.
+func (m *signingMethodEd25519) Verify(signingString, signature string, key interface{}) error {
+    publicKey, ok := key.(ed25519.PublicKey)
+    if !ok {
+        return jwt.ErrInvalidKeyType
+    }
+    sig, err := jwt.DecodeSegment(signature)
+    if err != nil {
+        return err
+    }
+    if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+        return jwt.ErrSignatureInvalid
+    }
+    return nil
+}
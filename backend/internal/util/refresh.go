@@ -0,0 +1,57 @@
+package utils
+
+import (
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "time"
+)
+
+// RefreshTokenTTL is how long a refresh token can be exchanged for a new token pair.
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+// GenerateRefreshToken creates a new opaque refresh token.
+// Only the returned hash should be persisted; the token itself is handed to the client.
+//
+// Returns:
+//   - string: the refresh token to return to the client.
+//   - string: the hash of the token to store in the database.
+//   - error: an error if random bytes could not be generated.
+func GenerateRefreshToken() (string, string, error) {
+    return GenerateOpaqueToken()
+}
+
+// GenerateOpaqueToken creates a random, URL-safe token suitable for refresh tokens,
+// password reset links and similar single-use secrets, along with its hash.
+func GenerateOpaqueToken() (string, string, error) {
+    bytes := make([]byte, 32)
+    if _, err := rand.Read(bytes); err != nil {
+        return "", "", err
+    }
+
+    token := base64.RawURLEncoding.EncodeToString(bytes)
+    return token, HashToken(token), nil
+}
+
+// HashToken returns the hex encoded SHA-256 hash of an opaque token.
+// Opaque tokens are high-entropy, so a fast hash is sufficient for lookups.
+func HashToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
+
+// PersonalAccessTokenPrefix starts every personal access token, so they can be told apart
+// from JWTs and recognized by secret scanners.
+const PersonalAccessTokenPrefix = "aqm_"
+
+// GeneratePersonalAccessToken creates a new personal access token along with its hash.
+func GeneratePersonalAccessToken() (string, string, error) {
+    token, _, err := GenerateOpaqueToken()
+    if err != nil {
+        return "", "", err
+    }
+
+    token = PersonalAccessTokenPrefix + token
+    return token, HashToken(token), nil
+}
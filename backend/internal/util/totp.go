@@ -0,0 +1,143 @@
+package utils
+
+import (
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha1"
+    "crypto/subtle"
+    "encoding/base32"
+    "encoding/binary"
+    "fmt"
+    "net/url"
+    "strings"
+    "time"
+)
+
+// TOTP parameters (RFC 6238). These are the defaults every authenticator app supports.
+const (
+    TOTPPeriod = 30 // Seconds per time step
+    TOTPDigits = 6  // Digits per code
+    TOTPSkew   = 1  // Time steps of clock drift tolerated in either direction
+)
+
+// totpEncoding is the unpadded base32 alphabet used for shared secrets.
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret creates a new random 160-bit shared secret, base32 encoded.
+func GenerateTOTPSecret() (string, error) {
+    secret := make([]byte, 20)
+    if _, err := rand.Read(secret); err != nil {
+        return "", err
+    }
+    return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPProvisioningURI builds the otpauth:// URI that authenticator apps import,
+// usually by scanning it as a QR code.
+//
+// Params:
+//   - secret: the base32 encoded shared secret.
+//   - account: the account name shown in the app, e.g. the user's email.
+//   - issuer: the service name shown in the app.
+func TOTPProvisioningURI(secret string, account string, issuer string) string {
+    values := url.Values{}
+    values.Set("secret", secret)
+    values.Set("issuer", issuer)
+    values.Set("algorithm", "SHA1")
+    values.Set("digits", fmt.Sprintf("%d", TOTPDigits))
+    values.Set("period", fmt.Sprintf("%d", TOTPPeriod))
+
+    label := url.PathEscape(issuer + ":" + account)
+    return "otpauth://totp/" + label + "?" + values.Encode()
+}
+
+// hotp computes the HOTP value (RFC 4226) for a counter.
+func hotp(key []byte, counter int64) string {
+    var msg [8]byte
+    binary.BigEndian.PutUint64(msg[:], uint64(counter))
+
+    mac := hmac.New(sha1.New, key)
+    mac.Write(msg[:])
+    sum := mac.Sum(nil)
+
+    offset := sum[len(sum)-1] & 0x0f
+    value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+    mod := uint32(1)
+    for i := 0; i < TOTPDigits; i++ {
+        mod *= 10
+    }
+    return fmt.Sprintf("%0*d", TOTPDigits, value%mod)
+}
+
+// TOTPStep returns the time step containing t.
+func TOTPStep(t time.Time) int64 {
+    return t.Unix() / TOTPPeriod
+}
+
+// TOTPCode computes the code for the time step containing t.
+func TOTPCode(secret string, t time.Time) (string, error) {
+    key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+    if err != nil {
+        return "", err
+    }
+    return hotp(key, TOTPStep(t)), nil
+}
+
+// ValidateTOTP checks a code against the secret, tolerating TOTPSkew steps of clock drift.
+// Callers must remember the returned step and reject codes for steps at or before it,
+// so that an observed code cannot be replayed.
+//
+// Returns:
+//   - int64: the time step the code matched.
+//   - bool: whether the code is valid.
+func ValidateTOTP(secret string, code string, t time.Time) (int64, bool) {
+    key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+    if err != nil {
+        return 0, false
+    }
+
+    code = strings.ReplaceAll(code, " ", "")
+    if len(code) != TOTPDigits {
+        return 0, false
+    }
+
+    current := TOTPStep(t)
+    for step := current - TOTPSkew; step <= current+TOTPSkew; step++ {
+        if subtle.ConstantTimeCompare([]byte(hotp(key, step)), []byte(code)) == 1 {
+            return step, true
+        }
+    }
+    return 0, false
+}
+
+// GenerateRecoveryCodes creates n one-time recovery codes formatted as xxxxx-xxxxx.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+    const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+    codes := make([]string, n)
+    for i := range codes {
+        raw := make([]byte, 10)
+        if _, err := rand.Read(raw); err != nil {
+            return nil, err
+        }
+        var b strings.Builder
+        for j, r := range raw {
+            if j == 5 {
+                b.WriteByte('-')
+            }
+            b.WriteByte(alphabet[int(r)%len(alphabet)])
+        }
+        codes[i] = b.String()
+    }
+    return codes, nil
+}
+
+// NormalizeRecoveryCode canonicalizes a recovery code as typed by a user before hashing.
+func NormalizeRecoveryCode(code string) string {
+    code = strings.ToLower(strings.TrimSpace(code))
+    code = strings.ReplaceAll(code, " ", "")
+    if len(code) == 10 && !strings.Contains(code, "-") {
+        code = code[:5] + "-" + code[5:]
+    }
+    return code
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+    "testing"
+    "time"
+)
+
+// rfc6238Secret is the SHA-1 secret of the test vectors of RFC 6238, Appendix B,
+// "12345678901234567890", base32 encoded.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The SHA-1 test vectors of RFC 6238, Appendix B, truncated to TOTPDigits digits.
+var rfc6238Vectors = []struct {
+    unix int64
+    code string
+}{
+    {59, "287082"},
+    {1111111109, "081804"},
+    {1111111111, "050471"},
+    {1234567890, "005924"},
+    {2000000000, "279037"},
+    {20000000000, "353130"},
+}
+
+func TestHOTP(t *testing.T) {
+    for _, vector := range rfc6238Vectors {
+        step := vector.unix / TOTPPeriod
+        if code := hotp([]byte("12345678901234567890"), step); code != vector.code {
+            t.Errorf("hotp(step %d) = %s, want %s", step, code, vector.code)
+        }
+    }
+}
+
+func TestTOTPCode(t *testing.T) {
+    for _, vector := range rfc6238Vectors {
+        code, err := TOTPCode(rfc6238Secret, time.Unix(vector.unix, 0))
+        if err != nil {
+            t.Fatalf("TOTPCode: %v", err)
+        }
+        if code != vector.code {
+            t.Errorf("TOTPCode at %d = %s, want %s", vector.unix, code, vector.code)
+        }
+    }
+}
+
+func TestValidateTOTP(t *testing.T) {
+    for _, vector := range rfc6238Vectors {
+        at := time.Unix(vector.unix, 0)
+        want := vector.unix / TOTPPeriod
+
+        // Codes are accepted for TOTPSkew steps of clock drift either way
+        for _, drift := range []time.Duration{0, -TOTPPeriod * time.Second, TOTPPeriod * time.Second} {
+            step, ok := ValidateTOTP(rfc6238Secret, vector.code, at.Add(drift))
+            if !ok || step != want {
+                t.Errorf("ValidateTOTP(%s) at %d%+v = %d, %v, want %d, true", vector.code, vector.unix, drift, step, ok, want)
+            }
+        }
+        if _, ok := ValidateTOTP(rfc6238Secret, vector.code, at.Add(2*TOTPPeriod*time.Second)); ok {
+            t.Errorf("ValidateTOTP(%s) accepted the code two steps late", vector.code)
+        }
+    }
+
+    at := time.Unix(59, 0)
+    for _, code := range []string{"287 082", "287082"} {
+        if _, ok := ValidateTOTP("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", code, at); !ok {
+            t.Errorf("ValidateTOTP(%q) with a lower case secret was refused", code)
+        }
+    }
+    for _, code := range []string{"", "28708", "2870820", "287083"} {
+        if _, ok := ValidateTOTP(rfc6238Secret, code, at); ok {
+            t.Errorf("ValidateTOTP(%q) was accepted", code)
+        }
+    }
+}
@@ -9,6 +9,7 @@ export interface Aquarium {
     equipment: Equipment[];
     parameterEntries?: WaterParameterEntry[];
     owner?: string; // User id of the aquarium owner
+    version?: number; // Incremented by the server on every update; sent back in If-Match
   }
 
 export interface Fish {
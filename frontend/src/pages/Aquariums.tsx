@@ -131,7 +131,8 @@ const Aquariums: React.FC = () => {
    * @param {Aquarium} aquariumToAdd - The aquarium to add.
    */
   const handleAddAquarium = (aquariumToAdd: Aquarium): void => {
-    addAquarium(aquariumToAdd);
+    // New aquariums start at version 1 on the server
+    addAquarium({ ...aquariumToAdd, version: 1 });
 
     try {
       createAquarium(aquariumToAdd);
@@ -142,15 +143,46 @@ const Aquariums: React.FC = () => {
     }
   };
 
+  /**
+   * Keeps the version assigned by the server to a saved aquarium, which the next update
+   * must be based on.
+   *
+   * @param {Aquarium} savedAquarium - The aquarium as it was sent to the server.
+   * @param {Aquarium} response - The aquarium returned by the server.
+   */
+  const applySavedVersion = (savedAquarium: Aquarium, response: Aquarium): void => {
+    const synced = { ...savedAquarium, version: response.version };
+    updateAquarium(synced);
+    setCurrentAquarium((current) => (current && current.id === synced.id ? synced : current));
+  };
+
+  /**
+   * Replaces an aquarium changed elsewhere since it was loaded with the current state
+   * returned by the server, so the user can redo their change on top of it.
+   *
+   * @param {any} error - The error of the failed update.
+   */
+  const applyUpdateConflict = (error: any): void => {
+    if (error?.response?.status !== 412) {
+      return;
+    }
+    const current: Aquarium = error.response.data;
+    updateAquarium(current);
+    setCurrentAquarium((selected) => (selected && selected.id === current.id ? current : selected));
+    handleSnackbar('This aquarium was changed on another device. Please redo your change.', 'warning', true);
+  };
+
   // Function to handle saving the updated aquariums
   const handleSaveAquarium = (updatedAquarium: Aquarium) => {
     updateAquarium(updatedAquarium);
     apiUpdateAquarium(updatedAquarium.id, updatedAquarium)
-      .then(() => {
+      .then((response) => {
         console.log('Successfully updated aquarium!');
+        applySavedVersion(updatedAquarium, response);
       })
       .catch(error => {
         console.error('Failed to update aquarium:', error);
+        applyUpdateConflict(error);
       });
     setIsEditDialogOpen(false);
   };
@@ -192,9 +224,11 @@ const Aquariums: React.FC = () => {
       apiUpdateAquarium(updatedAquarium.id, updatedAquarium)
         .then((response) => {
           console.log('API updated aquarium:', response);
+          applySavedVersion(updatedAquarium, response);
         })
         .catch((error) => {
           console.error('Failed to update aquarium via API:', error);
+          applyUpdateConflict(error);
         });
     }
   };
@@ -210,9 +244,11 @@ const Aquariums: React.FC = () => {
       apiUpdateAquarium(updatedAquarium.id, updatedAquarium)
         .then(response => {
           console.log('API updated aquarium:', response);
+          applySavedVersion(updatedAquarium, response);
         })
         .catch(error => {
           console.error('Failed to update aquarium via API:', error);
+          applyUpdateConflict(error);
         });
       console.log('Updated aquarium:', updatedAquarium);
     }
@@ -229,9 +265,11 @@ const Aquariums: React.FC = () => {
       apiUpdateAquarium(updatedAquarium.id, updatedAquarium)
         .then(response => {
           console.log('API updated aquarium:', response);
+          applySavedVersion(updatedAquarium, response);
         })
         .catch(error => {
           console.error('Failed to update aquarium via API:', error);
+          applyUpdateConflict(error);
         });
       console.log('Updated aquarium:', updatedAquarium);
     }
@@ -248,9 +286,11 @@ const Aquariums: React.FC = () => {
       apiUpdateAquarium(updatedAquarium.id, updatedAquarium)
         .then(response => {
           console.log('API updated aquarium:', response);
+          applySavedVersion(updatedAquarium, response);
         })
         .catch(error => {
           console.error('Failed to update aquarium via API:', error);
+          applyUpdateConflict(error);
         });
       console.log('Updated aquarium:', updatedAquarium);
     }
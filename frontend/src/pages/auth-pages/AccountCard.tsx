@@ -38,6 +38,7 @@ const generateRandomHex = (length: number) => {
 interface LoginResponse {
   email: string;
   token: string;
+  refresh_token: string;
 }
 
 
@@ -99,11 +100,11 @@ const AccountCard: React.FC = () => {
       const OAuthResponse = await OAuthGoogle(OAuthRequest);
 
       // Call login from AuthContext and store the token and email
-      const { token, email } = OAuthResponse as LoginResponse;
+      const { token, refresh_token, email } = OAuthResponse as LoginResponse;
       const userToStore = {
         email,
       }
-      login({ user: userToStore, token });
+      login({ user: userToStore, token, refreshToken: refresh_token });
 
       // Navigate to dashboard after successful registration
       navigate('/aquariums');
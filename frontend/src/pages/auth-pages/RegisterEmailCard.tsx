@@ -99,6 +99,7 @@ const RegisterEmailCard: React.FC = () => {
   interface LoginResponse {
       email: string;
       token: string;
+      refresh_token: string;
     }
 
   /**
@@ -145,8 +146,8 @@ const RegisterEmailCard: React.FC = () => {
 
 
       // Call login from AuthContext and store the token and email
-      const { token } = response as LoginResponse;
-      login({ user: userToStore, token });
+      const { token, refresh_token } = response as LoginResponse;
+      login({ user: userToStore, token, refreshToken: refresh_token });
 
       // Navigate to dashboard after successful registration
       navigate('/aquariums');
@@ -96,6 +96,7 @@ const SignInEmailCard: React.FC = () => {
   interface LoginResponse {
     email: string;
     token: string;
+    refresh_token: string;
   }
 
   /**
@@ -130,8 +131,8 @@ const SignInEmailCard: React.FC = () => {
       }
 
       // Call login from AuthContext and store the token and email
-      const { token } = response as LoginResponse;
-      login({ user: userToStore, token });
+      const { token, refresh_token } = response as LoginResponse;
+      login({ user: userToStore, token, refreshToken: refresh_token });
 
       // Show success and navigate to dashboard if login is successful
       showSnackbar('Login successful!', 'success');
@@ -22,6 +22,85 @@ const baseURL =
 
 const openaiKey = process.env.REACT_APP_OPENAI_API_KEY;
 
+/**
+ * Name of the window event dispatched when the session ended and its tokens could not be
+ * refreshed. AuthContext listens for it to log the user out.
+ */
+export const SESSION_EXPIRED_EVENT = "aquamind:session-expired";
+
+// The refresh in progress, shared by every request refused while it runs
+let refreshInProgress = null;
+
+/**
+ * Exchanges the stored refresh token for a new token pair and stores both tokens.
+ * A refresh token can only be used once; using it again revokes the session. Concurrent
+ * callers therefore share a single refresh request.
+ *
+ * @async
+ * @function refreshTokens
+ * @returns {Promise<string>} The new access token.
+ * @throws Will throw an error if there is no refresh token or the session has ended.
+ */
+const refreshTokens = () => {
+  if (!refreshInProgress) {
+    const refreshToken = localStorage.getItem("refresh_token");
+    const request = refreshToken
+      ? axios.post(`${baseURL}/token/refresh`, { refresh_token: refreshToken })
+      : Promise.reject(new Error("No refresh token stored"));
+
+    refreshInProgress = request
+      .then((response) => {
+        localStorage.setItem("token", response.data.token);
+        localStorage.setItem("refresh_token", response.data.refresh_token);
+        return response.data.token;
+      })
+      .finally(() => {
+        refreshInProgress = null;
+      });
+  }
+  return refreshInProgress;
+};
+
+/**
+ * Sends an authenticated request. If it is refused with 401 because the access token
+ * expired, the tokens are refreshed and the request is sent once more with the new access
+ * token. If they cannot be refreshed, SESSION_EXPIRED_EVENT is dispatched.
+ *
+ * @async
+ * @function withTokenRefresh
+ * @param {function} send - Sends the request with the given options.
+ * @param {Object} options - The request configuration, including its headers.
+ * @returns {Promise<Object>} The response to the request.
+ * @throws Will throw an error if the request fails.
+ */
+const withTokenRefresh = async (send, options) => {
+  try {
+    return await send(options);
+  } catch (error) {
+    const authorization = options.headers && options.headers.Authorization;
+    if (!authorization || !error.response || error.response.status !== 401) {
+      throw error;
+    }
+
+    // Another request may have refreshed the tokens since this one was sent
+    let token = localStorage.getItem("token");
+    if (!token || authorization === `Bearer ${token}`) {
+      try {
+        token = await refreshTokens();
+      } catch (refreshError) {
+        console.error("Unable to refresh the session:", refreshError);
+        window.dispatchEvent(new Event(SESSION_EXPIRED_EVENT));
+        throw error;
+      }
+    }
+
+    return send({
+      ...options,
+      headers: { ...options.headers, Authorization: `Bearer ${token}` },
+    });
+  }
+};
+
 /**
  * Sends a GET request to a specified API endpoint.
  *
@@ -39,7 +118,7 @@ const getFromAPI = async (endpoint, options = {}) => {
   console.log("Making GET request to:", url);
 
   try {
-    const response = await axios.get(url, options);
+    const response = await withTokenRefresh((config) => axios.get(url, config), options);
 
     // Log the response status and data
     console.log("Response Status:", response.status);
@@ -70,7 +149,7 @@ const postToAPI = async (endpoint, data, options = {}) => {
   console.log("Request Headers:", options.headers || {});
 
   try {
-    const response = await axios.post(url, data, options);
+    const response = await withTokenRefresh((config) => axios.post(url, data, config), options);
 
     console.log("Response Status:", response.status);
     console.log("Response Data:", response.data);
@@ -100,7 +179,7 @@ const putToAPI = async (endpoint, data, options = {}) => {
   console.log("Request Data:", data);
 
   try {
-    const response = await axios.put(url, data, options);
+    const response = await withTokenRefresh((config) => axios.put(url, data, config), options);
 
     console.log("Response Status:", response.status);
     console.log("Response Data:", response.data);
@@ -127,7 +206,7 @@ const delFromAPI = async (endpoint, options = {}) => {
   console.log("Making DELETE request to:", url);
 
   try {
-    const response = await axios.delete(url, options);
+    const response = await withTokenRefresh((config) => axios.delete(url, config), options);
 
     console.log("Response Status:", response.status);
 
@@ -231,6 +310,22 @@ export const loginUser = async (userData) => {
   return postToAPI("/login", userData);
 };
 
+/**
+ * Logs out by revoking the session of the stored tokens. If the access token expired, it is
+ * refreshed with the refresh token first, so the session is revoked either way.
+ *
+ * @async
+ * @function logoutUser
+ * @returns {Promise<Object>} Response data from the API.
+ */
+export const logoutUser = async () => {
+  return postToAPI("/logout", null, {
+    headers: {
+      Authorization: `Bearer ${localStorage.getItem("token")}`,
+    },
+  });
+};
+
 /**
  * Creates an aquarium by sending a POST request to the API.
  *
@@ -249,14 +344,14 @@ export const createAquarium = async (aquariumData) => {
 };
 
 /**
- * Retrieves all aquariums for the authenticated user.
+ * Retrieves all aquariums for the authenticated user, with their most recent parameter entries.
  *
  * @async
  * @function getUserAquariums
  * @returns {Promise<Array>} An array of aquarium objects.
  */
 export const getUserAquariums = async () => {
-  return getFromAPI("/user/aquariums", {
+  return getFromAPI("/user/aquariums?include=parameters", {
     headers: {
       "Content-Type": "application/json",
       Authorization: `Bearer ${localStorage.getItem("token")}`,
@@ -320,11 +415,13 @@ export const getAllDetails = async (type) => {
 
 /**
  * Updates an existing aquarium by sending a PUT request to the API.
+ * The update is based on the version of aquariumData; if the aquarium was changed since,
+ * the request fails with status 412 and the current aquarium as response data.
  *
  * @async
  * @function updateAquarium
  * @param {string} aquariumId - The ID of the aquarium to update.
- * @param {Object} aquariumData - The updated aquarium data.
+ * @param {Object} aquariumData - The updated aquarium data, including its version.
  * @returns {Promise<Object>} Response data from the API.
  */
 export const updateAquarium = async (aquariumId, aquariumData) => {
@@ -351,6 +448,7 @@ export const updateAquarium = async (aquariumId, aquariumData) => {
     headers: {
       "Content-Type": "application/json",
       Authorization: `Bearer ${localStorage.getItem("token")}`,
+      "If-Match": `"${aquariumData.version}"`,
     },
   });
 };
@@ -10,6 +10,7 @@
 
 import React, { createContext, useState, useContext, ReactNode } from 'react';
 import { User } from '../interfaces/Auth';
+import { logoutUser, SESSION_EXPIRED_EVENT } from '../services/APIServices';
 
 /**
  * AuthContextType defines the structure of the authentication context.
@@ -17,14 +18,14 @@ import { User } from '../interfaces/Auth';
  * @property {string | null} user - The logged-in user's email, or null if not logged in.
  * @property {string | null} token - The authentication token, or null if not logged in.
  * @property {boolean} isLoggedIn - Boolean indicating if the user is logged in.
- * @property {function} login - Function to log the user in, stores user data and token.
- * @property {function} logout - Function to log the user out, clears user data and token.
+ * @property {function} login - Function to log the user in, stores user data and tokens.
+ * @property {function} logout - Function to log the user out, revokes the session and clears user data and tokens.
  */
 interface AuthContextType {
   user: User | null;
   token: string | null;
   isLoggedIn: boolean;
-  login: (userData: { user: User; token: string }) => void;
+  login: (userData: { user: User; token: string; refreshToken?: string }) => void;
   logout: () => void;
   loading: boolean;
 
@@ -64,31 +65,57 @@ export const AuthProvider: React.FC<{ children: ReactNode }> = ({ children }) =>
   const isLoggedIn = !!user && !!token;
 
   /**
-   * Login function to store user data and authentication token.
+   * Login function to store user data and authentication tokens.
+   * The access token expires after 15 minutes; API requests renew it with the refresh token.
    * 
-   * @param {Object} userData - The user data containing user object and token.
+   * @param {Object} userData - The user data containing user object and tokens.
    * @param {User} userData.user - The user object.
-   * @param {string} userData.token - The authentication token.
+   * @param {string} userData.token - The access token.
+   * @param {string} [userData.refreshToken] - The refresh token of the session.
    */
-  const login = ({ user, token }: { user: User; token: string }) => {
+  const login = ({ user, token, refreshToken }: { user: User; token: string; refreshToken?: string }) => {
     setUser( user );
     setToken(token);
     localStorage.setItem('token', token); // Store token in local storage
+    if (refreshToken) {
+      localStorage.setItem('refresh_token', refreshToken); // Store refresh token in local storage
+    }
     localStorage.setItem('user', JSON.stringify(user)); // Store user in local storage
   };
 
   /**
-   * Logout function to clear user data and token from both state and local storage.
+   * Clears user data and tokens from both state and local storage.
    */
-  const logout = () => {
+  const clearSession = () => {
     setUser(null);
     setToken(null);
     localStorage.clear(); // Clear all local storage
     sessionStorage.clear();
+  };
+
+  /**
+   * Logout function to revoke the session on the server, then clear user data and tokens.
+   * The user is logged out locally even if the server cannot be reached.
+   */
+  const logout = async () => {
+    try {
+      await logoutUser();
+    } catch (error) {
+      console.error('Error revoking the session:', error);
+    }
+    clearSession();
 
     window.location.reload(); // Reload the page to clear any remaining state
   };
 
+  /**
+   * useEffect hook to log the user out when their session ended and could not be refreshed.
+   */
+  React.useEffect(() => {
+    window.addEventListener(SESSION_EXPIRED_EVENT, clearSession);
+    return () => window.removeEventListener(SESSION_EXPIRED_EVENT, clearSession);
+  }, []);
+
   /**
    * useEffect hook to check if user data (email and token) is saved in localStorage
    * when the app loads. If found, it restores the session.